@@ -1,9 +1,11 @@
 module github.com/baetyl/baetyl-go/v2
 
-go 1.13
+go 1.16
 
 require (
 	github.com/256dpi/gomqtt v0.14.3
+	github.com/BurntSushi/toml v0.3.1
+	github.com/Masterminds/semver/v3 v3.1.1
 	github.com/containerd/containerd v1.3.4
 	github.com/creasty/defaults v1.4.0
 	github.com/docker/go-connections v0.4.0
@@ -29,9 +31,11 @@ require (
 	github.com/stretchr/testify v1.5.1
 	github.com/ulikunitz/xz v0.5.7 // indirect
 	github.com/valyala/fasthttp v1.9.0
+	github.com/xeipuuv/gojsonschema v1.2.0
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
 	go.uber.org/zap v1.16.0
 	google.golang.org/grpc v1.25.1
+	gopkg.in/inf.v0 v0.9.0
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 	gopkg.in/tomb.v2 v2.0.0-20161208151619-d5d1b5820637
 	gopkg.in/validator.v2 v2.0.0-20191107172027-c3144fdedc21
@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,6 +14,8 @@ import (
 )
 
 var jsonHeaders = map[string]string{"Content-Type": "application/json"}
+var syncHeaders = map[string]string{"Content-Type": SyncContentType}
+var gzipHeaders = map[string]string{"Content-Encoding": "gzip"}
 
 // Client client of http server
 type Client struct {
@@ -20,8 +23,15 @@ type Client struct {
 	http *gohttp.Client
 }
 
-// NewClient creates a new http client
-func NewClient(ops *ClientOptions) *Client {
+// NewClient creates a new http client, opts are applied to a copy of ops
+func NewClient(ops *ClientOptions, opts ...ClientOption) *Client {
+	if len(opts) > 0 {
+		cp := *ops
+		for _, opt := range opts {
+			opt(&cp)
+		}
+		ops = &cp
+	}
 	transport := &gohttp.Transport{
 		Proxy: gohttp.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
@@ -56,7 +66,25 @@ func (c *Client) Call(function string, payload []byte) ([]byte, error) {
 
 // PostJSON post data with json content type
 func (c *Client) PostJSON(url string, payload []byte, headers ...map[string]string) ([]byte, error) {
-	headers = append(headers, jsonHeaders)
+	return c.post(url, payload, jsonHeaders, headers...)
+}
+
+// PostSync post the sync payload with SyncContentType, which is json, or protobuf
+// if built with the tag baetyl_proto
+func (c *Client) PostSync(url string, payload []byte, headers ...map[string]string) ([]byte, error) {
+	return c.post(url, payload, syncHeaders, headers...)
+}
+
+func (c *Client) post(url string, payload []byte, contentHeaders map[string]string, headers ...map[string]string) ([]byte, error) {
+	headers = append(headers, contentHeaders)
+	if c.ops.Compression {
+		var err error
+		payload, err = compress(payload, c.ops.CompressionLevel)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		headers = append(headers, gzipHeaders)
+	}
 	r, err := c.PostURL(url, bytes.NewBuffer(payload), headers...)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -99,6 +127,21 @@ func (c *Client) SendUrl(method, url string, body io.Reader, header ...map[strin
 	return r, errors.Trace(err)
 }
 
+func compress(payload []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err = w.Write(payload); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = w.Close(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return buf.Bytes(), nil
+}
+
 // HandleResponse handles response
 func HandleResponse(r *gohttp.Response) ([]byte, error) {
 	defer r.Body.Close()
@@ -2,6 +2,10 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	gohttp "net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -97,3 +101,56 @@ func TestSendURL(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("Put"), data)
 }
+
+func TestClientWithCompression(t *testing.T) {
+	var encoding string
+	var body []byte
+	ts := httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		gr, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		body, err = ioutil.ReadAll(gr)
+		assert.NoError(t, err)
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	ops := NewClientOptions()
+	ops.Address = ts.URL
+	c := NewClient(ops, WithCompression(gzip.BestSpeed))
+	assert.False(t, ops.Compression)
+	data, err := c.PostJSON("v1", []byte(`{"a":"b"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+	assert.Equal(t, "gzip", encoding)
+	assert.Equal(t, `{"a":"b"}`, string(body))
+
+	c = NewClient(ops, WithCompression(100))
+	_, err = c.PostJSON("v1", []byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestClientContentType(t *testing.T) {
+	var contentType string
+	ts := httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		contentType = r.Header.Get("Content-Type")
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	ops := NewClientOptions()
+	ops.Address = ts.URL
+	c := NewClient(ops)
+	_, err := c.PostJSON("v1", []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", contentType)
+	_, err = c.Call("v1", []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", contentType)
+	_, err = c.GetJSON(ts.URL + "/v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", contentType)
+	_, err = c.PostSync("v1", []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, SyncContentType, contentType)
+}
@@ -0,0 +1,7 @@
+//go:build !baetyl_proto
+// +build !baetyl_proto
+
+package http
+
+// SyncContentType the content type of the sync payload posted by Client.PostSync
+const SyncContentType = "application/json"
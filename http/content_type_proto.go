@@ -0,0 +1,8 @@
+//go:build baetyl_proto
+// +build baetyl_proto
+
+package http
+
+// SyncContentType the content type of the sync payload posted by Client.PostSync,
+// which is protobuf if built with the tag baetyl_proto
+const SyncContentType = "application/protobuf"
@@ -31,6 +31,20 @@ type ClientOptions struct {
 	IdleConnTimeout       time.Duration
 	TLSHandshakeTimeout   time.Duration
 	ExpectContinueTimeout time.Duration
+	// Compression gzip the json payload posted by client at CompressionLevel if enabled
+	Compression      bool
+	CompressionLevel int
+}
+
+// ClientOption the option to modify client options when creating client
+type ClientOption func(*ClientOptions)
+
+// WithCompression enables gzip compression of the json payload posted by client at level
+func WithCompression(level int) ClientOption {
+	return func(ops *ClientOptions) {
+		ops.Compression = true
+		ops.CompressionLevel = level
+	}
 }
 
 // NewClientOptions creates client options with default values
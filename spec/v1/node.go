@@ -1,10 +1,17 @@
 package v1
 
 import (
+	"bytes"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
+	"io"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/evanphx/json-patch"
@@ -28,6 +35,11 @@ const (
 	KeySysApps                  = "sysapps"
 	KeyAppStats                 = "appstats"
 	KeySysAppStats              = "sysappstats"
+	KeyNode                     = "node"
+	KeyNodeStats                = "nodestats"
+	KeyTime                     = "time"
+	KeySectionSources           = "__sources"
+	KeySchemaVersion            = "schemaVersion"
 	KeyAccelerator              = "accelerator"
 	KeyCluster                  = "cluster"
 	KeyOptionalSysApps          = "optionalSysApps"
@@ -36,32 +48,374 @@ const (
 	KeyGPUUsedMemory            = "usedMemory"
 	KeyGPUTotalMemory           = "totalMemory"
 	KeyGPUPercent               = "percent"
+	KeyGPUCount                 = "count"
+	KeyGPUProcesses             = "processes"
+
+	// ReportSchemaVersion the current schema version of report, the report without
+	// version is taken as version "0.0", which may be of single node
+	ReportSchemaVersion = "1.0"
+
+	// NodeRoleMaster the role of primary node, which is also set on the node translated from single node
+	NodeRoleMaster = "master"
 
 	BaetylCoreFrequency = "BaetylCoreFrequency"
 	BaetylCoreAPIPort   = "BaetylCoreAPIPort"
+
+	// SignificantUsageChange the relative change of usage reported as instance change
+	SignificantUsageChange = 0.1
+
+	// CoreReportTolerance the multiple of core frequency the core may miss reporting within
+	CoreReportTolerance = 3
 )
 
 type SyncMode string
 
-// ErrJSONLevelExceedsLimit the level of json exceeds the max limit
+// NegativeUsagePolicy the policy to handle negative resource usage of instance
+type NegativeUsagePolicy string
+
+const (
+	// NegativeUsageClamp clamps negative usage to zero, it is the default policy
+	NegativeUsageClamp NegativeUsagePolicy = "clamp"
+	// NegativeUsageReject fails the view with ErrNegativeResourceUsage
+	NegativeUsageReject NegativeUsagePolicy = "reject"
+)
+
+// ReadySource the timestamp which drives the readiness of node view
+type ReadySource string
+
+const (
+	// ReadyByReportTime the readiness is driven by the overall report time, it is the default
+	ReadyByReportTime ReadySource = "report"
+	// ReadyByNodeStatsTime the readiness is driven by the time of node stats, the node is
+	// not ready if the stats of any node is stale. Node stats without time fall back to the
+	// overall report time
+	ReadyByNodeStatsTime ReadySource = "nodestats"
+)
+
+// TimeFormat the format of times in marshaled node view
+type TimeFormat string
+
+const (
+	// TimeFormatRFC3339 formats times as RFC3339 strings, it is the default
+	TimeFormatRFC3339 TimeFormat = "rfc3339"
+	// TimeFormatEpochMillis formats times as milliseconds since epoch
+	TimeFormatEpochMillis TimeFormat = "epochMillis"
+)
+
+// NodeViewOptions node view options
+type NodeViewOptions struct {
+	// the node is not ready if it does not report within the timeout
+	Timeout time.Duration
+	// the policy to handle negative resource usage of instance
+	NegativeUsage NegativeUsagePolicy
+	// the timestamp which drives the readiness
+	ReadyBy ReadySource
+	// the format of times when the view is marshaled
+	TimeFormat TimeFormat
+	// the fixed number of decimals of resource percents if positive,
+	// otherwise percents are formatted in the shortest representation
+	PercentPrecision int
+	// the node is marked under disk pressure if the usage fraction of any disk
+	// exceeds the threshold if positive, see NodeStats.UnderDiskPressure
+	DiskPressureThreshold float64
+	// the top-level json keys of report view to retain, all keys are retained if empty
+	Projection []string
+	// the key paths of report masked before translated into the view, the paths should
+	// point to the string values, see Report.Mask
+	MaskPolicy MaskPolicy
+}
+
+// NodeViewOption the option to modify the options of node view
+type NodeViewOption func(*NodeViewOptions)
+
+// WithReadyTimeout sets the timeout within which the node must report to be ready
+func WithReadyTimeout(d time.Duration) NodeViewOption {
+	return func(ops *NodeViewOptions) {
+		ops.Timeout = d
+	}
+}
+
+// WithFieldProjection sets the top-level json keys of report view to retain, such as "nodestats"
+func WithFieldProjection(keys []string) NodeViewOption {
+	return func(ops *NodeViewOptions) {
+		ops.Projection = keys
+	}
+}
+
+// WithMaskPolicy sets the key paths of report masked before translated into the view
+func WithMaskPolicy(p MaskPolicy) NodeViewOption {
+	return func(ops *NodeViewOptions) {
+		ops.MaskPolicy = p
+	}
+}
+
+// TelemetryScrubbedNodeInfo the identity fields of node info (json keys)
+// which are dropped from the report uploaded as telemetry
+var TelemetryScrubbedNodeInfo = []string{"machineID", "systemUUID", "address", "fingerprint"}
+
+// volatileKeys the registry of dot-separated key paths skipped by DiffVolatileAware
+var volatileKeys = struct {
+	sync.RWMutex
+	paths map[string]bool
+}{paths: map[string]bool{}}
+
+// reportMigrations the registry of report migrations keyed by the source schema version
+var reportMigrations = struct {
+	sync.RWMutex
+	steps map[string]reportMigration
+}{steps: map[string]reportMigration{}}
+
+type reportMigration struct {
+	to string
+	fn func(Report) (Report, error)
+}
+
+// the accelerators and the keys of their extensions of node stats
+const (
+	AMDAccelerator         = "amd"
+	KeyAMDGPUUsedMemory    = "usedVramMiB"
+	KeyAMDGPUTotalMemory   = "totalVramMiB"
+	KeyAMDGPUCount         = KeyGPUCount
+	IntelAccelerator       = "intel"
+	KeyIntelGPUUsedMemory  = "usedMemoryGB"
+	KeyIntelGPUTotalMemory = "totalMemoryGB"
+	KeyIntelGPUCount       = KeyGPUCount
+)
+
+// AcceleratorParser parses the vendor specific extension of node stats into the
+// gpu usage, capacity and percent of node stats, the memory is in bytes
+type AcceleratorParser func(s *NodeStats, extension interface{})
+
+// acceleratorParsers the registry of accelerator parsers keyed by the accelerator
+var acceleratorParsers = struct {
+	sync.RWMutex
+	parsers map[string]AcceleratorParser
+}{parsers: map[string]AcceleratorParser{}}
+
+func init() {
+	RegisterReportMigration("0.0", "1.0", migrateSingleNodeReport)
+	RegisterAcceleratorParser(NVAccelerator, populateGPUStats)
+	RegisterAcceleratorParser(AMDAccelerator, populateAMDGPUStats)
+	RegisterAcceleratorParser(IntelAccelerator, populateIntelGPUStats)
+}
+
+// RegisterAcceleratorParser registers the parser of accelerator, which is applied to
+// the node stats of nodes declaring the accelerator when the view is populated.
+// The parser registered before for the accelerator is replaced
+func RegisterAcceleratorParser(name string, fn AcceleratorParser) {
+	acceleratorParsers.Lock()
+	defer acceleratorParsers.Unlock()
+	acceleratorParsers.parsers[name] = fn
+}
+
+func acceleratorParser(name string) AcceleratorParser {
+	acceleratorParsers.RLock()
+	defer acceleratorParsers.RUnlock()
+	return acceleratorParsers.parsers[name]
+}
+
+// telemetryKeys the sections of report retained in telemetry
+var telemetryKeys = []string{KeyTime, KeyNode, KeyNodeStats, KeyAppStats, KeySysAppStats}
+
+// ErrJSONLevelExceedsLimit the level of json exceeds the default max limit, the errors of
+// the limits configured by WithMaxDepth match it by errors.Is
 var ErrJSONLevelExceedsLimit = fmt.Errorf("the level of json exceeds the max limit (%d)", maxJSONLevel)
 
+// jsonLevelError the level of json exceeds the limit configured by WithMaxDepth
+type jsonLevelError struct {
+	limit int
+}
+
+func (e *jsonLevelError) Error() string {
+	return fmt.Sprintf("the level of json exceeds the max limit (%d)", e.limit)
+}
+
+func (e *jsonLevelError) Is(target error) bool {
+	return target == ErrJSONLevelExceedsLimit
+}
+
+// errJSONLevelExceedsLimit returns the error of the limit, which is ErrJSONLevelExceedsLimit
+// for the default limit, and matches ErrJSONLevelExceedsLimit by errors.Is otherwise
+func errJSONLevelExceedsLimit(limit int) error {
+	if limit == maxJSONLevel {
+		return ErrJSONLevelExceedsLimit
+	}
+	return &jsonLevelError{limit: limit}
+}
+
+// MergeOption the option of Merge, Diff and Patch
+type MergeOption func(*mergeOptions)
+
+type mergeOptions struct {
+	maxDepth int
+	cordoned bool
+}
+
+// WithMaxDepth sets the max level of json instead of the default 5. Merge fails once
+// it reaches the level, while Diff and Patch, which are not limited by default, fail
+// if the documents are nested deeper than the level as counted by JSONDepth
+func WithMaxDepth(n int) MergeOption {
+	return func(o *mergeOptions) {
+		o.maxDepth = n
+	}
+}
+
+func newMergeOptions(opts []MergeOption) *mergeOptions {
+	o := &mergeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// mergeDepth returns the max level of json for merge
+func (o *mergeOptions) mergeDepth() int {
+	if o.maxDepth > 0 {
+		return o.maxDepth
+	}
+	return maxJSONLevel
+}
+
+// checkDepth checks the depth of documents if the max level is configured
+func (o *mergeOptions) checkDepth(docs ...map[string]interface{}) error {
+	if o.maxDepth <= 0 {
+		return nil
+	}
+	for _, doc := range docs {
+		if JSONDepth(doc) > o.maxDepth {
+			return malformed(errJSONLevelExceedsLimit(o.maxDepth))
+		}
+	}
+	return nil
+}
+
+// ErrSizeExceedsLimit the size of json exceeds the max limit
+var ErrSizeExceedsLimit = fmt.Errorf("the size of json exceeds the max limit")
+
+// ErrNegativeResourceUsage the resource usage of instance is negative
+var ErrNegativeResourceUsage = fmt.Errorf("the resource usage of instance is negative")
+
+// ErrPatchNullDocument the delta patches the whole document to null
+var ErrPatchNullDocument = fmt.Errorf("the delta patches the whole document to null")
+
+// ErrDeltaNotCoalescable the deltas can not be expressed as a single delta
+var ErrDeltaNotCoalescable = fmt.Errorf("the deltas can not be coalesced into a single delta")
+
+// ErrMalformedInput the category of errors caused by malformed data of client,
+// such as a report which can not be parsed or a delta which can not be applied
+var ErrMalformedInput = fmt.Errorf("malformed input")
+
+// ErrInternal the category of errors caused by internal failures,
+// such as a struct of its own which can not be marshaled
+var ErrInternal = fmt.Errorf("internal failure")
+
+// IsMalformedInput checks whether the error is caused by malformed input
+func IsMalformedInput(err error) bool {
+	return goerrors.Is(err, ErrMalformedInput)
+}
+
+// IsInternal checks whether the error is caused by internal failures
+func IsInternal(err error) bool {
+	return goerrors.Is(err, ErrInternal)
+}
+
+// categorizedError the error classified into a category, the message is left as it is
+type categorizedError struct {
+	err      error
+	category error
+}
+
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorizedError) Cause() error {
+	return e.err
+}
+
+func (e *categorizedError) Unwrap() error {
+	return e.err
+}
+
+func (e *categorizedError) Is(target error) bool {
+	return target == e.category
+}
+
+func (e *categorizedError) Format(s fmt.State, verb rune) {
+	if f, ok := e.err.(fmt.Formatter); ok {
+		f.Format(s, verb)
+		return
+	}
+	fmt.Fprintf(s, "%v", e.err)
+}
+
+// malformed classifies the error as malformed input unless it is classified already
+func malformed(err error) error {
+	return categorize(err, ErrMalformedInput)
+}
+
+// internal classifies the error as internal failure unless it is classified already
+func internal(err error) error {
+	return categorize(err, ErrInternal)
+}
+
+func categorize(err, category error) error {
+	if err == nil || IsMalformedInput(err) || IsInternal(err) {
+		return err
+	}
+	return &categorizedError{err: errors.Trace(err), category: category}
+}
+
+// ReportShapeError the section of report has an unexpected json type
+type ReportShapeError struct {
+	Section string
+	Type    string
+}
+
+func (e *ReportShapeError) Error() string {
+	return fmt.Sprintf("the section (%s) of report is expected to be an object, but got %s", e.Section, e.Type)
+}
+
+// AcceleratorMismatchError the declared accelerator of node does not match the reported gpu resources
+type AcceleratorMismatchError struct {
+	Accelerator string
+	GPUNodes    []string
+}
+
+func (e *AcceleratorMismatchError) Error() string {
+	if e.Accelerator == "" {
+		return fmt.Sprintf("no accelerator is declared, but gpu is reported by nodes (%s)", strings.Join(e.GPUNodes, ","))
+	}
+	return fmt.Sprintf("the accelerator (%s) is declared, but no gpu is reported", e.Accelerator)
+}
+
 // Node the spec of node
 type Node struct {
-	Namespace         string                 `json:"namespace,omitempty" yaml:"namespace,omitempty"`
-	Name              string                 `json:"name,omitempty" yaml:"name,omitempty" validate:"omitempty,resourceName"`
-	Version           string                 `json:"version,omitempty" yaml:"version,omitempty"`
-	CreationTimestamp time.Time              `json:"createTime,omitempty" yaml:"createTime,omitempty"`
-	Accelerator       string                 `json:"accelerator,omitempty" yaml:"accelerator,omitempty"`
-	Mode              SyncMode               `json:"mode,omitempty" yaml:"mode,omitempty"`
-	Cluster           bool                   `json:"cluster,omitempty" yaml:"cluster,omitempty"`
-	Labels            map[string]string      `json:"labels,omitempty" yaml:"labels,omitempty" validate:"omitempty,validLabels"`
-	Annotations       map[string]string      `json:"annotations,omitempty" yaml:"annotations,omitempty"`
-	Attributes        map[string]interface{} `json:"attr,omitempty" yaml:"attr,omitempty"`
-	Report            Report                 `json:"report,omitempty" yaml:"report,omitempty"`
-	Desire            Desire                 `json:"desire,omitempty" yaml:"desire,omitempty"`
-	SysApps           []string               `json:"sysApps,omitempty" yaml:"sysApps,omitempty"`
-	Description       string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Namespace         string                 `json:"namespace,omitempty" yaml:"namespace,omitempty" toml:"namespace,omitempty"`
+	Name              string                 `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty" validate:"omitempty,resourceName"`
+	Version           string                 `json:"version,omitempty" yaml:"version,omitempty" toml:"version,omitempty"`
+	CreationTimestamp time.Time              `json:"createTime,omitempty" yaml:"createTime,omitempty" toml:"createTime,omitempty"`
+	Accelerator       string                 `json:"accelerator,omitempty" yaml:"accelerator,omitempty" toml:"accelerator,omitempty"`
+	Mode              SyncMode               `json:"mode,omitempty" yaml:"mode,omitempty" toml:"mode,omitempty"`
+	Cluster           bool                   `json:"cluster,omitempty" yaml:"cluster,omitempty" toml:"cluster,omitempty"`
+	Labels            map[string]string      `json:"labels,omitempty" yaml:"labels,omitempty" toml:"labels,omitempty" validate:"omitempty,validLabels"`
+	Annotations       map[string]string      `json:"annotations,omitempty" yaml:"annotations,omitempty" toml:"annotations,omitempty"`
+	Attributes        map[string]interface{} `json:"attr,omitempty" yaml:"attr,omitempty" toml:"attr,omitempty"`
+	Report            Report                 `json:"report,omitempty" yaml:"report,omitempty" toml:"report,omitempty"`
+	Desire            Desire                 `json:"desire,omitempty" yaml:"desire,omitempty" toml:"desire,omitempty"`
+	SysApps           []string               `json:"sysApps,omitempty" yaml:"sysApps,omitempty" toml:"sysApps,omitempty"`
+	Description       string                 `json:"description,omitempty" yaml:"description,omitempty" toml:"description,omitempty"`
+	// SchemaVersion the schema version of report sent by the node, which takes precedence
+	// over the version recorded in report, see Report.SchemaVersion
+	SchemaVersion string `json:"schemaVersion,omitempty" yaml:"schemaVersion,omitempty" toml:"schemaVersion,omitempty"`
+	// Conditions the named conditions of node, see SetCondition
+	Conditions []Condition `json:"conditions,omitempty" yaml:"conditions,omitempty" toml:"conditions,omitempty"`
+	// Cordoned whether the node is cordoned, the new desire is not applied to a cordoned node, see Cordon
+	Cordoned bool `json:"cordoned,omitempty" yaml:"cordoned,omitempty" toml:"cordoned,omitempty"`
+	// CordonTimestamp the time when the node is cordoned
+	CordonTimestamp *time.Time `json:"cordonTime,omitempty" yaml:"cordonTime,omitempty" toml:"cordonTime,omitempty"`
+	// DrainTimeout the duration allowed to drain the node after it is cordoned
+	DrainTimeout time.Duration `json:"drainTimeout,omitempty" yaml:"drainTimeout,omitempty" toml:"drainTimeout,omitzero"`
 }
 
 type NodeView struct {
@@ -79,6 +433,13 @@ type NodeView struct {
 	Cluster           bool              `json:"cluster" yaml:"cluster"`
 	Ready             bool              `json:"ready"`
 	Mode              SyncMode          `json:"mode"`
+	// Conditions the conditions of node, with the standard conditions populated by the view
+	Conditions []Condition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+	Cordoned   bool        `json:"cordoned,omitempty" yaml:"cordoned,omitempty"`
+	// DrainDeadline the cordon time plus the drain timeout, set if the node is cordoned with a drain timeout
+	DrainDeadline *time.Time `json:"drainDeadline,omitempty" yaml:"drainDeadline,omitempty"`
+
+	timeFormat TimeFormat
 }
 
 type ReportView struct {
@@ -93,6 +454,75 @@ type ReportView struct {
 	NodeInsNum  map[string]int        `json:"nodeinsnum,omitempty" yaml:"nodeinsnum,omitempty"`
 }
 
+// HealthWeights the weights of the factors of node health score
+type HealthWeights struct {
+	// the weight of node readiness
+	Ready float64 `json:"ready,omitempty" yaml:"ready,omitempty"`
+	// the weight of resource pressure, which is the max cpu or memory percent across nodes
+	Pressure float64 `json:"pressure,omitempty" yaml:"pressure,omitempty"`
+	// the weight of the ratio of failed instances to all instances
+	Failure float64 `json:"failure,omitempty" yaml:"failure,omitempty"`
+}
+
+// DefaultHealthWeights the default weights of node health score
+var DefaultHealthWeights = HealthWeights{Ready: 40, Pressure: 30, Failure: 30}
+
+// AcceleratorUsage the accelerator usage of a node, the total and used memory are in bytes
+// for all accelerators, as normalized by the accelerator parsers
+type AcceleratorUsage struct {
+	NodeName string  `json:"nodeName,omitempty" yaml:"nodeName,omitempty"`
+	Resource string  `json:"resource,omitempty" yaml:"resource,omitempty"`
+	Total    float64 `json:"total" yaml:"total"`
+	Used     float64 `json:"used" yaml:"used"`
+	Percent  float64 `json:"percent" yaml:"percent"`
+	InUse    bool    `json:"inUse" yaml:"inUse"`
+}
+
+// FailedInstance the failed instance of app
+type FailedInstance struct {
+	AppName      string `json:"appName,omitempty" yaml:"appName,omitempty"`
+	InstanceName string `json:"instanceName,omitempty" yaml:"instanceName,omitempty"`
+	NodeName     string `json:"nodeName,omitempty" yaml:"nodeName,omitempty"`
+	Cause        string `json:"cause,omitempty" yaml:"cause,omitempty"`
+}
+
+// AppHealthSummary the numbers of apps of node bucketed by derived status
+type AppHealthSummary struct {
+	Total    int `json:"total" yaml:"total"`
+	Healthy  int `json:"healthy" yaml:"healthy"`
+	Degraded int `json:"degraded" yaml:"degraded"`
+	Failed   int `json:"failed" yaml:"failed"`
+	Unknown  int `json:"unknown" yaml:"unknown"`
+}
+
+// AllHealthy checks whether all apps are healthy
+func (s AppHealthSummary) AllHealthy() bool {
+	return s.Healthy == s.Total
+}
+
+// InstanceChange the change of instance between two reports
+type InstanceChange struct {
+	AppName      string   `json:"appName,omitempty" yaml:"appName,omitempty"`
+	InstanceName string   `json:"instanceName,omitempty" yaml:"instanceName,omitempty"`
+	OldStatus    Status   `json:"oldStatus,omitempty" yaml:"oldStatus,omitempty"`
+	NewStatus    Status   `json:"newStatus,omitempty" yaml:"newStatus,omitempty"`
+	Usage        []string `json:"usage,omitempty" yaml:"usage,omitempty"`
+}
+
+// PlacedInstance the instance of app with its placement
+type PlacedInstance struct {
+	AppName      string     `json:"appName,omitempty" yaml:"appName,omitempty"`
+	InstanceName string     `json:"instanceName,omitempty" yaml:"instanceName,omitempty"`
+	NodeName     string     `json:"nodeName,omitempty" yaml:"nodeName,omitempty"`
+	Placement    *Placement `json:"placement,omitempty" yaml:"placement,omitempty"`
+}
+
+// AppVersionSpread the desired version and the number of nodes per reported version of an app
+type AppVersionSpread struct {
+	Desired  string         `json:"desired,omitempty" yaml:"desired,omitempty"`
+	Reported map[string]int `json:"reported,omitempty" yaml:"reported,omitempty"`
+}
+
 // Report report data
 type Report map[string]interface{}
 
@@ -103,347 +533,3140 @@ type Desire map[string]interface{}
 type Delta map[string]interface{}
 
 // Merge merge new reported data
-func (r Report) Merge(reported Report) error {
-	return errors.Trace(merge(r, reported, 1, maxJSONLevel))
-}
-
-// Merge merge new reported data
-func (d Desire) Merge(desired Desire) error {
-	return errors.Trace(merge(d, desired, 1, maxJSONLevel))
-}
-
-// Diff diff with reported data, return the delta for desire
-func (d Desire) Diff(reported Report) (Desire, error) {
-	res, err := diff(d, reported, true)
-	return res, errors.Trace(err)
+func (r Report) Merge(reported Report, opts ...MergeOption) error {
+	return errors.Trace(merge(r, reported, 1, newMergeOptions(opts).mergeDepth()))
 }
 
-// Diff desire diff with report data, return the delta for desire
-// and do not clean nil in delta
-func (d Desire) DiffWithNil(report Report) (Delta, error) {
-	res, err := diff(d, report, false)
-	return res, errors.Trace(err)
+// MergeWithMask merge new reported data like Merge, but only the top-level keys listed in
+// mask are merged and the others are ignored, all keys are merged if mask is empty
+func (r Report) MergeWithMask(reported Report, mask []string) error {
+	return errors.Trace(merge(r, maskKeys(reported, mask), 1, newMergeOptions(nil).mergeDepth()))
 }
 
-// Patch patch desire with delta, get the new desire
-func (d Desire) Patch(delta Delta) (Desire, error) {
-	return patch(d, delta)
+// MergeWithConflictHandler merge new reported data like Merge, but handler is invoked for
+// every key whose existing and incoming values are both non-null and of different kinds,
+// with the dot-separated key path such as "node.cpu", and the value returned by handler
+// is merged. The incoming value wins if handler is nil
+func (r Report) MergeWithConflictHandler(incoming Report, handler ConflictHandler) error {
+	return errors.Trace(mergeWithHandler(r, incoming, 1, newMergeOptions(nil).mergeDepth(), "", handler))
 }
 
-// Patch patch report with delta, get the new report
-func (r Report) Patch(delta Delta) (Report, error) {
-	return patch(r, delta)
+// MergeChanged merge new reported data like Merge, and returns whether the receiver
+// is actually modified by the merge, the receiver is left untouched if any error is returned
+func (r Report) MergeChanged(reported Report) (bool, error) {
+	merged := Report(copyMap(r))
+	if err := merge(merged, reported, 1, newMergeOptions(nil).mergeDepth()); err != nil {
+		return false, errors.Trace(err)
+	}
+	if reflect.DeepEqual(map[string]interface{}(r), map[string]interface{}(merged)) {
+		return false, nil
+	}
+	for k, v := range merged {
+		r[k] = v
+	}
+	return true, nil
 }
 
-func patch(doc, delta map[string]interface{}) (map[string]interface{}, error) {
-	docData, err := json.Marshal(doc)
-	if err != nil {
-		return nil, err
+// MergeWithSizeLimit merge new reported data if the serialized size of the merged
+// report does not exceed maxBytes, otherwise returns ErrSizeExceedsLimit. The merge
+// is atomic, the receiver is left untouched if any error is returned
+func (r Report) MergeWithSizeLimit(reported Report, maxBytes int) error {
+	merged := Report(copyMap(r))
+	if err := merge(merged, reported, 1, newMergeOptions(nil).mergeDepth()); err != nil {
+		return errors.Trace(err)
 	}
-	deltaData, err := json.Marshal(delta)
+	data, err := json.Marshal(merged)
 	if err != nil {
-		return nil, err
+		return malformed(err)
 	}
-	patchData, err := jsonpatch.MergePatch(docData, deltaData)
-	if err != nil {
-		return nil, err
+	if len(data) > maxBytes {
+		return malformed(ErrSizeExceedsLimit)
 	}
-	var newDoc map[string]interface{}
-	if err = json.Unmarshal(patchData, &newDoc); err != nil {
-		return nil, err
+	for k, v := range merged {
+		r[k] = v
 	}
-	return newDoc, nil
+	return nil
 }
 
-func getDeviceInfos(data map[string]interface{}) []DeviceInfo {
-	if data == nil {
-		return nil
-	}
-	devs, ok := data[KeyDevices]
-	if !ok || devs == nil {
-		return nil
-	}
-	res, ok := devs.([]DeviceInfo)
-	if ok {
-		return res
-	}
-	res = []DeviceInfo{}
-	dis, ok := devs.([]interface{})
-	if !ok {
-		return nil
+// Merge merge new reported data
+func (d Desire) Merge(desired Desire, opts ...MergeOption) error {
+	return errors.Trace(merge(d, desired, 1, newMergeOptions(opts).mergeDepth()))
+}
+
+// MergePreserving merge new desired data, but the top-level keys listed in
+// preserveKeys are never removed or overwritten if the receiver holds them
+func (d Desire) MergePreserving(desired Desire, preserveKeys []string) error {
+	filtered := Desire{}
+	for k, v := range desired {
+		filtered[k] = v
 	}
-	for _, di := range dis {
-		dim := di.(map[string]interface{})
-		if dim == nil {
-			return nil
+	for _, k := range preserveKeys {
+		if _, ok := d[k]; ok {
+			delete(filtered, k)
 		}
-		res = append(res, DeviceInfo{Name: dim["name"].(string), Version: dim["version"].(string)})
 	}
-	return res
+	return errors.Trace(merge(d, filtered, 1, newMergeOptions(nil).mergeDepth()))
 }
 
-func (r Report) DeviceInfos() []DeviceInfo {
-	return getDeviceInfos(r)
+// MergeWithMask merge new desired data like Merge, but only the top-level keys listed in
+// mask are merged and the others are ignored, all keys are merged if mask is empty
+func (d Desire) MergeWithMask(desired Desire, mask []string) error {
+	return errors.Trace(merge(d, maskKeys(desired, mask), 1, newMergeOptions(nil).mergeDepth()))
 }
 
-func (r Report) SetDeviceInfos(devs []DeviceInfo) {
-	r[KeyDevices] = devs
+// maskKeys returns the top-level keys of m listed in mask, m itself if mask is empty
+func maskKeys(m map[string]interface{}, mask []string) map[string]interface{} {
+	if len(mask) == 0 {
+		return m
+	}
+	res := map[string]interface{}{}
+	for _, k := range mask {
+		if v, ok := m[k]; ok {
+			res[k] = v
+		}
+	}
+	return res
 }
 
-func (d Desire) DeviceInfos() []DeviceInfo {
-	return getDeviceInfos(d)
+// Diff diff with reported data, return the delta for desire
+func (d Desire) Diff(reported Report, opts ...MergeOption) (Desire, error) {
+	res, err := diff(d, reported, true, newMergeOptions(opts).maxDepth)
+	return res, errors.Trace(err)
 }
 
-func (d Desire) SetDeviceInfos(devs []DeviceInfo) {
-	d[KeyDevices] = devs
+// RegisterVolatileKey registers the dot-separated key path, such as "time" or
+// "node.master.time", which is skipped by DiffVolatileAware
+func RegisterVolatileKey(path string) {
+	volatileKeys.Lock()
+	defer volatileKeys.Unlock()
+	volatileKeys.paths[path] = true
 }
 
-func (r Report) AppInfos(isSys bool) []AppInfo {
-	if isSys {
-		return getAppInfos(KeySysApps, r)
-	} else {
-		return getAppInfos(KeyApps, r)
-	}
+// UnregisterVolatileKey removes the key path registered by RegisterVolatileKey
+func UnregisterVolatileKey(path string) {
+	volatileKeys.Lock()
+	defer volatileKeys.Unlock()
+	delete(volatileKeys.paths, path)
 }
 
-func (r Report) SetAppInfos(isSys bool, apps []AppInfo) {
-	if isSys {
-		r[KeySysApps] = apps
-	} else {
-		r[KeyApps] = apps
+// DiffVolatileAware same as Diff, but the key paths registered by RegisterVolatileKey
+// are stripped from the delta, the objects emptied by stripping are removed as well
+func (d Desire) DiffVolatileAware(reported Report) (Desire, error) {
+	res, err := diff(d, reported, true, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
 	}
-}
-
-func (d Desire) AppInfos(isSys bool) []AppInfo {
-	if isSys {
-		return getAppInfos(KeySysApps, d)
-	} else {
-		return getAppInfos(KeyApps, d)
+	volatileKeys.RLock()
+	defer volatileKeys.RUnlock()
+	for path := range volatileKeys.paths {
+		removePath(res, strings.Split(path, "."))
 	}
+	return res, nil
 }
 
-func (d Desire) SetAppInfos(isSys bool, apps []AppInfo) {
-	if isSys {
-		d[KeySysApps] = apps
-	} else {
-		d[KeyApps] = apps
+// removePath removes the value of path from m, and removes the parent objects
+// emptied by the removal, returns whether m becomes empty
+func removePath(m map[string]interface{}, path []string) bool {
+	if len(path) == 1 {
+		delete(m, path[0])
+		return len(m) == 0
 	}
-}
-
-func (r Report) SetAppStats(isSys bool, stats []AppStats) {
-	if isSys {
-		r[KeySysAppStats] = stats
-	} else {
-		r[KeyAppStats] = stats
+	sub, ok := m[path[0]].(map[string]interface{})
+	if !ok {
+		return false
 	}
-}
-
-func (d Desire) SetAppStats(isSys bool, stats []AppStats) {
-	if isSys {
-		d[KeySysAppStats] = stats
-	} else {
-		d[KeyAppStats] = stats
+	if removePath(sub, path[1:]) {
+		delete(m, path[0])
 	}
+	return len(m) == 0
 }
 
-func (r Report) AppStats(isSys bool) []AppStats {
-	if isSys {
-		return getAppStats(KeySysAppStats, r)
-	} else {
-		return getAppStats(KeyAppStats, r)
+// DiffSegmented same as Diff, but diffs each top-level key separately to bound the
+// peak memory of large reports, the combined delta equals the one of Diff
+func (d Desire) DiffSegmented(reported Report) (Delta, error) {
+	res := Delta{}
+	for k, dv := range d {
+		segment, err := diff(map[string]interface{}{k: dv}, map[string]interface{}{k: reported[k]}, true, 0)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if v, ok := segment[k]; ok {
+			res[k] = v
+		}
 	}
+	return res, nil
 }
 
-func (d Desire) AppStats(isSys bool) []AppStats {
-	if isSys {
-		return getAppStats(KeySysAppStats, d)
-	} else {
-		return getAppStats(KeyAppStats, d)
-	}
+// Diff desire diff with report data, return the delta for desire
+// and do not clean nil in delta
+func (d Desire) DiffWithNil(report Report, opts ...MergeOption) (Delta, error) {
+	res, err := diff(d, report, false, newMergeOptions(opts).maxDepth)
+	return res, errors.Trace(err)
 }
 
-func (n *Node) View(timeout time.Duration) (*NodeView, error) {
-	err := n.compatibleSingleNode()
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-	view := new(NodeView)
-	nodeStr, err := json.Marshal(n)
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-	err = json.Unmarshal(nodeStr, view)
+// Normalize returns a canonical copy of the desire so that semantically equal desires
+// produce no delta, the normalizations applied are:
+//  1. typed values are converted into generic json values, and numbers into float64
+//  2. empty maps are dropped recursively
+//  3. the apps, sysapps and devices lists are sorted by name
+func (d Desire) Normalize() (Desire, error) {
+	data, err := json.Marshal(d)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	if err = view.populateNodeStats(timeout); err != nil {
+	res := Desire{}
+	if err = json.Unmarshal(data, &res); err != nil {
 		return nil, errors.Trace(err)
 	}
-	if report := view.Report; report != nil {
-		if err = report.translateServiceResourceQuantity(); err != nil {
-			return nil, errors.Trace(err)
+	dropEmptyMaps(res)
+	for k, keyFunc := range unorderedKeys {
+		if list, ok := res[k].([]interface{}); ok {
+			res[k] = sortedElements(list, keyFunc)
+		}
+	}
+	return res, nil
+}
+
+func dropEmptyMaps(m map[string]interface{}) {
+	for k, v := range m {
+		vm, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		dropEmptyMaps(vm)
+		if len(vm) == 0 {
+			delete(m, k)
+		}
+	}
+}
+
+// DiffIgnoreOrder same as Diff, but the apps, sysapps and devices lists holding
+// the same elements in different order produce no delta. The lists are compared
+// with numbers decoded as json.Number, while the delta holds float64 like Diff
+func (d Desire) DiffIgnoreOrder(reported Report) (Desire, error) {
+	var dm, rm map[string]interface{}
+	if err := normalizeWithNumber(d, &dm); err != nil {
+		return nil, malformed(err)
+	}
+	if err := normalizeWithNumber(reported, &rm); err != nil {
+		return nil, malformed(err)
+	}
+	for k, keyFunc := range unorderedKeys {
+		dv, dok := dm[k].([]interface{})
+		rv, rok := rm[k].([]interface{})
+		if dok && rok && equalUnordered(dv, rv, keyFunc) {
+			rm[k] = dm[k]
+		}
+	}
+	delta, err := diff(dm, rm, true, newMergeOptions(nil).maxDepth)
+	return delta, errors.Trace(err)
+}
+
+// DiffPrecise same as Diff, but decodes numbers as json.Number instead of float64,
+// so that large integers such as byte counts and timestamps keep their precision
+func (d Desire) DiffPrecise(reported Report) (Desire, error) {
+	res, err := diffPrecise(d, reported, true)
+	return res, errors.Trace(err)
+}
+
+// DiffWithConflicts diff with reported data like Diff, and detects the conflicts where the node
+// modified the keys of desire on its own. The conflicts map the dot-separated key paths, which
+// are changed in reported since the last acknowledged baseline and also present in desire, to
+// the reported values which differ from the desired ones, null for the removed keys
+func (d Desire) DiffWithConflicts(reported, baseline Report) (delta Desire, conflicts map[string]interface{}, err error) {
+	if delta, err = d.Diff(reported); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	var desired, r, b map[string]interface{}
+	if err = normalizeWithNumber(d, &desired); err != nil {
+		return nil, nil, malformed(err)
+	}
+	if err = normalizeWithNumber(reported, &r); err != nil {
+		return nil, nil, malformed(err)
+	}
+	if err = normalizeWithNumber(baseline, &b); err != nil {
+		return nil, nil, malformed(err)
+	}
+	delete(r, KeySectionSources)
+	delete(b, KeySectionSources)
+	conflicts = map[string]interface{}{}
+	collectConflicts(createMergePatch(b, r), desired, r, "", conflicts)
+	return delta, conflicts, nil
+}
+
+// collectConflicts collects the paths of local changes which are present in desired
+// with values different from the reported ones
+func collectConflicts(changes, desired, reported map[string]interface{}, prefix string, conflicts map[string]interface{}) {
+	for k, change := range changes {
+		dv, ok := desired[k]
+		if !ok {
+			continue
+		}
+		rv := reported[k]
+		cm, cok := change.(map[string]interface{})
+		dm, dok := dv.(map[string]interface{})
+		rm, rok := rv.(map[string]interface{})
+		if cok && dok && rok {
+			collectConflicts(cm, dm, rm, prefix+k+".", conflicts)
+			continue
+		}
+		if !reflect.DeepEqual(dv, rv) {
+			conflicts[prefix+k] = rv
+		}
+	}
+}
+
+// Patch patch desire with delta, get the new desire. A copy of the desire is
+// returned if the delta is nil or empty. The cordon guard is opt-in, ErrNodeCordoned
+// is returned only if the node passed by WithCordonCheck is cordoned
+func (d Desire) Patch(delta Delta, opts ...MergeOption) (Desire, error) {
+	return d.patch(delta, json.Unmarshal, opts)
+}
+
+func (d Desire) patch(delta Delta, unmarshal func([]byte, interface{}) error, opts []MergeOption) (Desire, error) {
+	o := newMergeOptions(opts)
+	if o.cordoned {
+		return nil, errors.Trace(ErrNodeCordoned)
+	}
+	res, err := patch(d, delta, unmarshal)
+	if err != nil {
+		return nil, err
+	}
+	if err = o.checkDepth(res); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return res, nil
+}
+
+// Patch patch report with delta, get the new report. A copy of the report is
+// returned if the delta is nil or empty
+func (r Report) Patch(delta Delta, opts ...MergeOption) (Report, error) {
+	res, err := patch(r, delta, json.Unmarshal)
+	if err != nil {
+		return nil, err
+	}
+	if err = newMergeOptions(opts).checkDepth(res); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return res, nil
+}
+
+// PatchValidated patch desire with delta like Patch with opts, and returns the new desire
+// only if it passes validate, ValidateDesire is used if validate is nil. The receiver is
+// never modified
+func (d Desire) PatchValidated(delta Delta, validate func(Desire) error, opts ...MergeOption) (Desire, error) {
+	if validate == nil {
+		validate = ValidateDesire
+	}
+	res, err := d.Patch(delta, opts...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = validate(res); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return res, nil
+}
+
+// DryRunResult the result of Desire.DryRun, Errors holds the validation errors of the
+// projected report, which is valid if Errors is empty
+type DryRunResult struct {
+	Projected Report
+	Delta     Desire
+	Errors    []error
+}
+
+// DryRun computes the delta of desire against the current report by Diff, and applies it to
+// a copy of current to project the report after the desire is applied. The projected report is
+// checked against maxJSONLevel and the app constraints registered by RegisterAppConstraint, the
+// failures are collected in the result instead of returned as error. Neither the desire nor
+// current is modified
+func (d Desire) DryRun(current Report) (*DryRunResult, error) {
+	delta, err := d.Diff(current)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	projected, err := patch(current, Delta(delta), json.Unmarshal)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := &DryRunResult{Projected: projected, Delta: delta}
+	if JSONDepth(projected) > maxJSONLevel {
+		res.Errors = append(res.Errors, malformed(ErrJSONLevelExceedsLimit))
+	}
+	if constraints := registeredAppConstraints(); len(constraints) > 0 {
+		if err = Desire(projected).SatisfiesConstraints(constraints); err != nil {
+			var errs ValidationErrors
+			if goerrors.As(err, &errs) {
+				res.Errors = append(res.Errors, errs...)
+			} else {
+				res.Errors = append(res.Errors, err)
+			}
+		}
+	}
+	return res, nil
+}
+
+// ValidateDesire checks that the depth of desire does not exceed maxJSONLevel, and
+// the names of apps and sysapps are unique
+func ValidateDesire(d Desire) error {
+	if JSONDepth(d) > maxJSONLevel {
+		return malformed(ErrJSONLevelExceedsLimit)
+	}
+	for _, isSys := range []bool{false, true} {
+		names := map[string]bool{}
+		for _, app := range d.AppInfos(isSys) {
+			if names[app.Name] {
+				return malformed(errors.Errorf("app (%s) is duplicated in desire", app.Name))
+			}
+			names[app.Name] = true
+		}
+	}
+	return nil
+}
+
+// PatchPrecise same as Patch, but decodes numbers as json.Number instead of float64
+func (d Desire) PatchPrecise(delta Delta, opts ...MergeOption) (Desire, error) {
+	return d.patch(delta, unmarshalWithNumber, opts)
+}
+
+// PatchPrecise same as Patch, but decodes numbers as json.Number instead of float64
+func (r Report) PatchPrecise(delta Delta) (Report, error) {
+	return patch(r, delta, unmarshalWithNumber)
+}
+
+// patch applies delta to doc as json merge patch, the result is decoded by unmarshal
+func patch(doc, delta map[string]interface{}, unmarshal func([]byte, interface{}) error) (map[string]interface{}, error) {
+	if len(delta) == 0 {
+		if doc == nil {
+			return nil, nil
+		}
+		return copyMap(doc), nil
+	}
+	docData, err := json.Marshal(doc)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	deltaData, err := json.Marshal(delta)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	patchData, err := jsonpatch.MergePatch(docData, deltaData)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	var newDoc map[string]interface{}
+	if err = unmarshal(patchData, &newDoc); err != nil {
+		return nil, internal(err)
+	}
+	if newDoc == nil {
+		return nil, malformed(ErrPatchNullDocument)
+	}
+	return newDoc, nil
+}
+
+func unmarshalWithNumber(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// CoalesceDeltas merges deltas in order into a single delta, applying the result
+// equals applying each delta sequentially. A null value deletes the key as usual,
+// and a later delta may set the key again. Since a merge patch can not replace an
+// object as a whole, an object set on a key which an earlier delta deleted or set
+// to a non-object value returns ErrDeltaNotCoalescable
+func CoalesceDeltas(deltas []Delta) (Delta, error) {
+	res := Delta{}
+	for _, delta := range deltas {
+		if err := coalesce(res, delta); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return res, nil
+}
+
+// ValidateKnownKeys returns the sorted top-level keys of delta which are not in allowed,
+// such as a typo of apps or sysapps, it returns nil if all keys are known
+func (d Delta) ValidateKnownKeys(allowed []string) []string {
+	known := make(map[string]struct{}, len(allowed))
+	for _, k := range allowed {
+		known[k] = struct{}{}
+	}
+	var unknown []string
+	for k := range d {
+		if _, ok := known[k]; !ok {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func coalesce(left, right map[string]interface{}) error {
+	for rk, rv := range right {
+		rm, ok := rv.(map[string]interface{})
+		if !ok {
+			left[rk] = rv
+			continue
+		}
+		lv, ok := left[rk]
+		if !ok {
+			left[rk] = copyMap(rm)
+			continue
+		}
+		lm, ok := lv.(map[string]interface{})
+		if !ok {
+			return ErrDeltaNotCoalescable
+		}
+		if err := coalesce(lm, rm); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if vm, ok := v.(map[string]interface{}); ok {
+			res[k] = copyMap(vm)
+		} else {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// DeepCopy returns a deep copy of the node, the nested maps and slices of
+// attributes, report and desire are copied recursively without json round-trip
+func (n *Node) DeepCopy() *Node {
+	if n == nil {
+		return nil
+	}
+	res := *n
+	res.Labels = copyStringMap(n.Labels)
+	res.Annotations = copyStringMap(n.Annotations)
+	if n.Attributes != nil {
+		res.Attributes = deepCopyMap(n.Attributes)
+	}
+	res.Report = n.Report.DeepCopy()
+	res.Desire = n.Desire.DeepCopy()
+	if n.SysApps != nil {
+		res.SysApps = append([]string{}, n.SysApps...)
+	}
+	if n.Conditions != nil {
+		res.Conditions = append([]Condition{}, n.Conditions...)
+	}
+	if n.CordonTimestamp != nil {
+		t := *n.CordonTimestamp
+		res.CordonTimestamp = &t
+	}
+	return &res
+}
+
+// DeepCopy returns a deep copy of the report, nil is returned for a nil report
+func (r Report) DeepCopy() Report {
+	if r == nil {
+		return nil
+	}
+	return deepCopyMap(r)
+}
+
+// DeepCopy returns a deep copy of the desire, nil is returned for a nil desire
+func (d Desire) DeepCopy() Desire {
+	if d == nil {
+		return nil
+	}
+	return deepCopyMap(d)
+}
+
+func deepCopyMap(m map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = deepCopyValue(v)
+	}
+	return res
+}
+
+// deepCopyValue copies the value recursively, the types of report and desire are
+// copied by their DeepCopy methods, and the others are copied by reflection
+func deepCopyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		if t == nil {
+			return t
+		}
+		return deepCopyMap(t)
+	case []interface{}:
+		if t == nil {
+			return t
+		}
+		res := make([]interface{}, len(t))
+		for i, e := range t {
+			res[i] = deepCopyValue(e)
+		}
+		return res
+	case []AppInfo:
+		if t == nil {
+			return t
+		}
+		res := make([]AppInfo, len(t))
+		for i := range t {
+			res[i] = *t[i].DeepCopy()
+		}
+		return res
+	case []AppStats:
+		if t == nil {
+			return t
+		}
+		res := make([]AppStats, len(t))
+		for i := range t {
+			res[i] = *t[i].DeepCopy()
+		}
+		return res
+	case []DeviceInfo:
+		if t == nil {
+			return t
+		}
+		res := make([]DeviceInfo, len(t))
+		for i := range t {
+			res[i] = *t[i].DeepCopy()
+		}
+		return res
+	case map[string]*NodeInfo:
+		if t == nil {
+			return t
+		}
+		res := make(map[string]*NodeInfo, len(t))
+		for k, e := range t {
+			res[k] = e.DeepCopy()
+		}
+		return res
+	case map[string]*NodeStats:
+		if t == nil {
+			return t
+		}
+		res := make(map[string]*NodeStats, len(t))
+		for k, e := range t {
+			res[k] = e.DeepCopy()
+		}
+		return res
+	case *NodeInfo:
+		return t.DeepCopy()
+	case *NodeStats:
+		return t.DeepCopy()
+	case time.Time, string, bool, float64, int, int64, json.Number:
+		return t
+	}
+	return deepCopyReflect(reflect.ValueOf(v)).Interface()
+}
+
+// deepCopyReflect copies the maps, slices, pointers and exported struct fields
+// recursively, the unexported fields are copied as they are
+func deepCopyReflect(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		res := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			res.SetMapIndex(k, deepCopyReflect(v.MapIndex(k)))
+		}
+		return res
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		res := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			res.Index(i).Set(deepCopyReflect(v.Index(i)))
+		}
+		return res
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		res := reflect.New(v.Type().Elem())
+		res.Elem().Set(deepCopyReflect(v.Elem()))
+		return res
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		res := reflect.New(v.Type()).Elem()
+		res.Set(deepCopyReflect(v.Elem()))
+		return res
+	case reflect.Struct:
+		res := reflect.New(v.Type()).Elem()
+		res.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := res.Field(i); f.CanSet() {
+				f.Set(deepCopyReflect(v.Field(i)))
+			}
+		}
+		return res
+	}
+	return v
+}
+
+// TelemetryView returns a copy of the report for telemetry upload, which only
+// retains the node info and aggregate stats, with the identity fields listed
+// in TelemetryScrubbedNodeInfo dropped from node info
+func (r Report) TelemetryView() (Report, error) {
+	subset := Report{}
+	for _, k := range telemetryKeys {
+		if v, ok := r[k]; ok {
+			subset[k] = v
+		}
+	}
+	data, err := json.Marshal(subset)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := Report{}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return nil, errors.Trace(err)
+	}
+	node, ok := res[KeyNode].(map[string]interface{})
+	if !ok {
+		return res, nil
+	}
+	if !isClusterNodeInfo(node) {
+		scrubNodeInfo(node)
+		return res, nil
+	}
+	for _, v := range node {
+		if info, ok := v.(map[string]interface{}); ok {
+			scrubNodeInfo(info)
+		}
+	}
+	return res, nil
+}
+
+// WritePrometheus writes the metrics of report in the prometheus text format with
+// nodeLabels attached to every sample. The values are normalized as the view does,
+// cpu in cores and memory in bytes, the metrics are:
+//   - baetyl_node_resource_usage{node,resource}: the resource usage of node
+//   - baetyl_node_resource_capacity{node,resource}: the resource capacity of node
+//   - baetyl_node_resource_percent{node,resource}: the resource percent of node in [0,1]
+//   - baetyl_app_instances{app,system}: the number of instances of app
+//
+// The names of nodeLabels are sanitized into valid label names, a name which is empty,
+// reserved with the prefix "__", or collides with another name or the labels of the
+// metrics (node, resource, app and system) is rejected as malformed input. The resources
+// which are not numbers are skipped
+func (r Report) WritePrometheus(w io.Writer, nodeLabels map[string]string) error {
+	base, err := prometheusLabels(nodeLabels)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	view, err := (&Node{Report: r}).ViewWithOptions(nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	buf := &bytes.Buffer{}
+	var nodes []string
+	rv := view.Report
+	if rv == nil {
+		rv = &ReportView{}
+	}
+	for name := range rv.NodeStats {
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+	for _, metric := range []struct {
+		name, help string
+		values     func(s *NodeStats) map[string]string
+	}{
+		{"baetyl_node_resource_usage", "The resource usage of node, cpu in cores and memory in bytes.", func(s *NodeStats) map[string]string { return s.Usage }},
+		{"baetyl_node_resource_capacity", "The resource capacity of node, cpu in cores and memory in bytes.", func(s *NodeStats) map[string]string { return s.Capacity }},
+		{"baetyl_node_resource_percent", "The resource percent of node in [0,1].", func(s *NodeStats) map[string]string { return s.Percent }},
+	} {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n", metric.name, metric.help, metric.name)
+		for _, node := range nodes {
+			stats := rv.NodeStats[node]
+			if stats == nil {
+				continue
+			}
+			values := metric.values(stats)
+			resources := make([]string, 0, len(values))
+			for res := range values {
+				resources = append(resources, res)
+			}
+			sort.Strings(resources)
+			for _, res := range resources {
+				val, err := strconv.ParseFloat(values[res], 64)
+				if err != nil {
+					continue
+				}
+				labels := append(base, [2]string{"node", node}, [2]string{"resource", res})
+				writePrometheusSample(buf, metric.name, labels, val)
+			}
+		}
+	}
+	name := "baetyl_app_instances"
+	fmt.Fprintf(buf, "# HELP %s The number of instances of app.\n# TYPE %s gauge\n", name, name)
+	for _, isSys := range []bool{false, true} {
+		stats := rv.AppStats
+		if isSys {
+			stats = rv.SysAppStats
+		}
+		for _, stat := range stats {
+			labels := append(base, [2]string{"app", stat.Name}, [2]string{"system", strconv.FormatBool(isSys)})
+			writePrometheusSample(buf, name, labels, float64(len(stat.InstanceStats)))
+		}
+	}
+	_, err = w.Write(buf.Bytes())
+	return errors.Trace(err)
+}
+
+// prometheusMetricLabels the names of labels emitted by WritePrometheus itself
+var prometheusMetricLabels = map[string]bool{"node": true, "resource": true, "app": true, "system": true}
+
+// prometheusLabels returns the labels sorted by the sanitized names, the capacity
+// is trimmed so that appending to the result always copies
+func prometheusLabels(labels map[string]string) ([][2]string, error) {
+	res := make([][2]string, 0, len(labels))
+	names := map[string]string{}
+	for k, v := range labels {
+		name := sanitizeLabelName(k)
+		if name == "" || strings.HasPrefix(name, "__") {
+			return nil, malformed(errors.Errorf("label (%s) is not a valid label name", k))
+		}
+		if prometheusMetricLabels[name] {
+			return nil, malformed(errors.Errorf("label (%s) collides with the label of metrics", k))
+		}
+		if other, ok := names[name]; ok {
+			return nil, malformed(errors.Errorf("labels (%s) and (%s) collide after sanitization", other, k))
+		}
+		names[name] = k
+		res = append(res, [2]string{name, v})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i][0] < res[j][0] })
+	return res[:len(res):len(res)], nil
+}
+
+// sanitizeLabelName replaces the characters not allowed in label name with underscore
+func sanitizeLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		b[i] = '_'
+	}
+	return string(b)
+}
+
+var prometheusLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writePrometheusSample(buf *bytes.Buffer, name string, labels [][2]string, val float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		buf.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, `%s="%s"`, l[0], prometheusLabelValueReplacer.Replace(l[1]))
+		}
+		buf.WriteByte('}')
+	}
+	fmt.Fprintf(buf, " %s\n", strconv.FormatFloat(val, 'f', -1, 64))
+}
+
+// PruneStaleNodes removes the entries of nodes not in activeNodes from the node info,
+// node stats and the instances of app stats and sysapp stats, and returns the sorted
+// names of removed nodes. Only the report of cluster is pruned, the report of single
+// node is left untouched
+func (r Report) PruneStaleNodes(activeNodes []string) []string {
+	if !isClusterNodeInfo(r[KeyNode]) {
+		return nil
+	}
+	active := map[string]bool{}
+	for _, name := range activeNodes {
+		active[name] = true
+	}
+	removed := map[string]bool{}
+	for _, key := range []string{KeyNode, KeyNodeStats} {
+		v := reflect.ValueOf(r[key])
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			continue
+		}
+		for _, k := range v.MapKeys() {
+			if name := k.String(); !active[name] {
+				v.SetMapIndex(k, reflect.Value{})
+				removed[name] = true
+			}
+		}
+	}
+	for _, key := range []string{KeyAppStats, KeySysAppStats} {
+		switch stats := r[key].(type) {
+		case []AppStats:
+			for _, stat := range stats {
+				for name, ins := range stat.InstanceStats {
+					if ins.NodeName != "" && !active[ins.NodeName] {
+						delete(stat.InstanceStats, name)
+						removed[ins.NodeName] = true
+					}
+				}
+			}
+		case []interface{}:
+			for _, item := range stats {
+				stat, _ := item.(map[string]interface{})
+				instances, _ := stat["instances"].(map[string]interface{})
+				for name, v := range instances {
+					ins, _ := v.(map[string]interface{})
+					node, _ := ins["nodeName"].(string)
+					if node != "" && !active[node] {
+						delete(instances, name)
+						removed[node] = true
+					}
+				}
+			}
+		}
+	}
+	res := make([]string, 0, len(removed))
+	for name := range removed {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// MergeClusterReports consolidates the reports of single node reported by cluster members
+// into one report of cluster. The node info and node stats are keyed by member name, the
+// instances of app stats and sysapp stats are concatenated with node name defaulted to the
+// member name, and apps, sysapps and stats of the same app are united by app name. The
+// report time is the latest one, the other keys and duplicates are taken from the first
+// member in name order
+func MergeClusterReports(reports map[string]Report) (Report, error) {
+	members := make([]string, 0, len(reports))
+	for name := range reports {
+		members = append(members, name)
+	}
+	sort.Strings(members)
+
+	res := Report{}
+	nodes := map[string]*NodeInfo{}
+	nodeStats := map[string]*NodeStats{}
+	apps := map[string][]AppInfo{}
+	stats := map[string][]AppStats{}
+	var latest *time.Time
+	for _, member := range members {
+		var m struct {
+			Time        *time.Time `json:"time,omitempty"`
+			Node        *NodeInfo  `json:"node,omitempty"`
+			NodeStats   *NodeStats `json:"nodestats,omitempty"`
+			Apps        []AppInfo  `json:"apps,omitempty"`
+			SysApps     []AppInfo  `json:"sysapps,omitempty"`
+			AppStats    []AppStats `json:"appstats,omitempty"`
+			SysAppStats []AppStats `json:"sysappstats,omitempty"`
+		}
+		data, err := json.Marshal(reports[member])
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err = json.Unmarshal(data, &m); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if m.Time != nil && (latest == nil || m.Time.After(*latest)) {
+			latest = m.Time
+		}
+		if m.Node != nil {
+			nodes[member] = m.Node
+		}
+		if m.NodeStats != nil {
+			nodeStats[member] = m.NodeStats
+		}
+		apps[KeyApps] = uniteAppInfos(apps[KeyApps], m.Apps)
+		apps[KeySysApps] = uniteAppInfos(apps[KeySysApps], m.SysApps)
+		stats[KeyAppStats] = uniteAppStats(stats[KeyAppStats], m.AppStats, member)
+		stats[KeySysAppStats] = uniteAppStats(stats[KeySysAppStats], m.SysAppStats, member)
+		for k, v := range reports[member] {
+			if _, ok := res[k]; !ok {
+				res[k] = v
+			}
+		}
+	}
+	for _, k := range []string{KeyTime, KeyNode, KeyNodeStats, KeyApps, KeySysApps, KeyAppStats, KeySysAppStats} {
+		delete(res, k)
+	}
+	if latest != nil {
+		res[KeyTime] = *latest
+	}
+	if len(nodes) > 0 {
+		res[KeyNode] = nodes
+	}
+	if len(nodeStats) > 0 {
+		res[KeyNodeStats] = nodeStats
+	}
+	for k, v := range apps {
+		if v != nil {
+			res[k] = v
+		}
+	}
+	for k, v := range stats {
+		if v != nil {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+// uniteAppInfos appends the apps whose name is not in res yet
+func uniteAppInfos(res, apps []AppInfo) []AppInfo {
+	for _, app := range apps {
+		exist := false
+		for _, a := range res {
+			if a.Name == app.Name {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			res = append(res, app)
+		}
+	}
+	return res
+}
+
+// uniteAppStats appends the stats whose app name is not in res yet, and adds the
+// instances of the member to the stats of the same app
+func uniteAppStats(res, stats []AppStats, member string) []AppStats {
+	for _, stat := range stats {
+		idx := -1
+		for i := range res {
+			if res[i].Name == stat.Name {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			res = append(res, stat)
+			idx = len(res) - 1
+			res[idx].InstanceStats = nil
+		}
+		for name, ins := range stat.InstanceStats {
+			if res[idx].InstanceStats == nil {
+				res[idx].InstanceStats = map[string]InstanceStats{}
+			}
+			if _, ok := res[idx].InstanceStats[name]; ok {
+				continue
+			}
+			if ins.NodeName == "" {
+				ins.NodeName = member
+			}
+			res[idx].InstanceStats[name] = ins
+		}
+	}
+	return res
+}
+
+// DetectOSDrift returns the sorted names of nodes whose reported kernel version or os
+// image differs from the baseline, an empty baseline is not checked. The report of
+// single node is checked as the node of its hostname, and nil is returned if the node
+// info can not be parsed
+func DetectOSDrift(report Report, baselineKernel, baselineOSImage string) []string {
+	nodes, err := clusterNodeInfos(report)
+	if err != nil {
+		log.L().Warn("failed to parse node info to detect os drift", log.Error(err))
+		return nil
+	}
+	var res []string
+	for name, info := range nodes {
+		if info == nil {
+			continue
+		}
+		if (baselineKernel != "" && info.KernelVersion != baselineKernel) ||
+			(baselineOSImage != "" && info.OSImage != baselineOSImage) {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// clusterNodeInfos returns the node info of report keyed by node name
+func clusterNodeInfos(report Report) (map[string]*NodeInfo, error) {
+	report, err := (&Node{Report: report}).compatibleSingleNode()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	nodes := map[string]*NodeInfo{}
+	nodeInfo, ok := report[KeyNode]
+	if !ok || nodeInfo == nil {
+		return nodes, nil
+	}
+	data, err := json.Marshal(nodeInfo)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = json.Unmarshal(data, &nodes); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return nodes, nil
+}
+
+// isClusterNodeInfo checks whether the node info is keyed by node name
+func isClusterNodeInfo(nodeInfo interface{}) bool {
+	if nodeInfo == nil {
+		return false
+	}
+	if _, ok := nodeInfo.(map[string]*NodeInfo); ok {
+		return true
+	}
+	data, err := json.Marshal(nodeInfo)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, &map[string]*NodeInfo{}) == nil
+}
+
+func scrubNodeInfo(info map[string]interface{}) {
+	for _, k := range TelemetryScrubbedNodeInfo {
+		delete(info, k)
+	}
+}
+
+// SchemaVersion returns the schema version of report, "0.0" if not set
+func (r Report) SchemaVersion() string {
+	if v, ok := r[KeySchemaVersion].(string); ok && v != "" {
+		return v
+	}
+	return "0.0"
+}
+
+// SetSchemaVersion sets the schema version of report
+func (r Report) SetSchemaVersion(version string) {
+	r[KeySchemaVersion] = version
+}
+
+// RegisterReportMigration registers the migration of report from a schema version to
+// the next one, the migration registered later from the same version replaces the former
+func RegisterReportMigration(from, to string, fn func(Report) (Report, error)) {
+	reportMigrations.Lock()
+	defer reportMigrations.Unlock()
+	reportMigrations.steps[from] = reportMigration{to: to, fn: fn}
+}
+
+// MigrateReport migrates the report from a schema version to a newer one by applying the
+// registered migrations in chain, an error is returned before any migration is applied
+// if no migration is registered for any version in the chain. The report of the same or
+// a newer version than toVersion, such as sent by a newer agent, is returned as it is.
+// The migrations should not modify the given report
+func MigrateReport(fromVersion, toVersion string, r Report) (Report, error) {
+	if compareSchemaVersion(fromVersion, toVersion) >= 0 {
+		return r, nil
+	}
+	reportMigrations.RLock()
+	defer reportMigrations.RUnlock()
+	var chain []reportMigration
+	visited := map[string]bool{}
+	for version := fromVersion; version != toVersion; {
+		if visited[version] {
+			return nil, errors.Errorf("report migration from version (%s) loops", version)
+		}
+		visited[version] = true
+		step, ok := reportMigrations.steps[version]
+		if !ok {
+			return nil, errors.Errorf("no report migration registered from version (%s) to (%s)", version, toVersion)
+		}
+		chain = append(chain, step)
+		version = step.to
+	}
+	for _, step := range chain {
+		var err error
+		if r, err = step.fn(r); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return r, nil
+}
+
+// SetSectionSource records the subsystem which last wrote the top-level key of report,
+// the sources are stored under the reserved key KeySectionSources, which is excluded
+// from diffs and views
+func (r Report) SetSectionSource(key, source string) {
+	sources, ok := r[KeySectionSources].(map[string]interface{})
+	if !ok {
+		sources = map[string]interface{}{}
+		if typed, ok := r[KeySectionSources].(map[string]string); ok {
+			for k, v := range typed {
+				sources[k] = v
+			}
+		}
+		r[KeySectionSources] = sources
+	}
+	sources[key] = source
+}
+
+// SectionSource returns the subsystem which last wrote the top-level key of report
+func (r Report) SectionSource(key string) (string, bool) {
+	switch sources := r[KeySectionSources].(type) {
+	case map[string]interface{}:
+		source, ok := sources[key].(string)
+		return source, ok
+	case map[string]string:
+		source, ok := sources[key]
+		return source, ok
+	}
+	return "", false
+}
+
+// reportTime returns the report time
+func (r Report) reportTime() (time.Time, bool) {
+	switch v := r[KeyTime].(type) {
+	case time.Time:
+		return v, !v.IsZero()
+	case *time.Time:
+		if v != nil {
+			return *v, !v.IsZero()
+		}
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err == nil {
+			return t, !t.IsZero()
+		}
+	}
+	return time.Time{}, false
+}
+
+// InstanceDiff returns the instances of apps and sysapps whose status changed or whose
+// usage changed significantly from old report to new report, sorted by app and instance
+// name. Instances are matched by app name and instance name, an added instance has no
+// old status and a removed one has no new status. Usage lists the resources whose usage
+// changed more than SignificantUsageChange relatively
+func InstanceDiff(oldReport, newReport Report) []InstanceChange {
+	oldIns, newIns := reportInstances(oldReport), reportInstances(newReport)
+	keys := map[[2]string]struct{}{}
+	for k := range oldIns {
+		keys[k] = struct{}{}
+	}
+	for k := range newIns {
+		keys[k] = struct{}{}
+	}
+	var res []InstanceChange
+	for k := range keys {
+		o, n := oldIns[k], newIns[k]
+		change := InstanceChange{AppName: k[0], InstanceName: k[1], OldStatus: o.Status, NewStatus: n.Status}
+		for name := range n.Usage {
+			if significantUsageChange(o.Usage[name], n.Usage[name]) {
+				change.Usage = append(change.Usage, name)
+			}
+		}
+		for name := range o.Usage {
+			if _, ok := n.Usage[name]; !ok {
+				change.Usage = append(change.Usage, name)
+			}
+		}
+		if change.OldStatus == change.NewStatus && len(change.Usage) == 0 {
+			continue
+		}
+		sort.Strings(change.Usage)
+		res = append(res, change)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].AppName != res[j].AppName {
+			return res[i].AppName < res[j].AppName
+		}
+		return res[i].InstanceName < res[j].InstanceName
+	})
+	return res
+}
+
+// DiffCounts returns the number of changed leaf values per top-level section from old
+// report to new report, which counts the leaves of the merge patch between them, so
+// that a replaced list or a removed value counts as one. Unchanged sections are omitted
+func DiffCounts(oldReport, newReport Report) (map[string]int, error) {
+	delta, err := diff(newReport, oldReport, false, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := map[string]int{}
+	for k, v := range delta {
+		res[k] = countLeaves(v)
+	}
+	return res, nil
+}
+
+func countLeaves(v interface{}) int {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return 1
+	}
+	num := 0
+	for _, sub := range m {
+		num += countLeaves(sub)
+	}
+	return num
+}
+
+// reportInstances returns the instances of apps and sysapps keyed by app and instance name
+func reportInstances(r Report) map[[2]string]InstanceStats {
+	res := map[[2]string]InstanceStats{}
+	for _, stats := range [][]AppStats{r.AppStats(false), r.AppStats(true)} {
+		for _, stat := range stats {
+			for name, ins := range stat.InstanceStats {
+				res[[2]string{stat.Name, name}] = ins
+			}
+		}
+	}
+	return res
+}
+
+func significantUsageChange(oldUsage, newUsage string) bool {
+	if oldUsage == "" {
+		return newUsage != ""
+	}
+	o, err := resource.ParseQuantity(oldUsage)
+	if err != nil {
+		return oldUsage != newUsage
+	}
+	n, err := resource.ParseQuantity(newUsage)
+	if err != nil {
+		return true
+	}
+	ov, nv := float64(o.MilliValue()), float64(n.MilliValue())
+	if ov == 0 {
+		return nv != 0
+	}
+	return math.Abs(nv-ov)/math.Abs(ov) > SignificantUsageChange
+}
+
+// getDeviceInfos returns nil if the devices are absent, null or not a list,
+// otherwise a non-nil slice, the malformed entries are skipped
+func getDeviceInfos(data map[string]interface{}) []DeviceInfo {
+	if data == nil {
+		return nil
+	}
+	devs, ok := data[KeyDevices]
+	if !ok || devs == nil {
+		return nil
+	}
+	if res, ok := devs.([]DeviceInfo); ok {
+		if res == nil {
+			return []DeviceInfo{}
+		}
+		return res
+	}
+	dis, ok := devs.([]interface{})
+	if !ok {
+		return nil
+	}
+	res := []DeviceInfo{}
+	for _, di := range dis {
+		dim, ok := di.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		dev := DeviceInfo{}
+		dev.Name, _ = dim["name"].(string)
+		dev.Version, _ = dim["version"].(string)
+		dev.FirmwareVersion, _ = dim["firmwareVersion"].(string)
+		dev.Protocol, _ = dim["protocol"].(string)
+		status, _ := dim["status"].(string)
+		dev.Status = DeviceStatus(status)
+		// the agents reporting the connection state as a flag
+		if connected, ok := dim["connected"].(bool); ok && dev.Status == "" {
+			dev.Status = DeviceDisconnected
+			if connected {
+				dev.Status = DeviceConnected
+			}
+		}
+		switch t := dim["attributes"].(type) {
+		case map[string]string:
+			dev.Attributes = copyStringMap(t)
+		case map[string]interface{}:
+			dev.Attributes = map[string]string{}
+			for k, v := range t {
+				if v, ok := v.(string); ok {
+					dev.Attributes[k] = v
+				}
+			}
+		}
+		switch t := dim["lastSeen"].(type) {
+		case time.Time:
+			dev.LastSeen = &t
+		case string:
+			if ts, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				dev.LastSeen = &ts
+			}
+		}
+		res = append(res, dev)
+	}
+	return res
+}
+
+// DeviceInfos returns the devices, nil if absent and non-nil if the key holds a list
+func (r Report) DeviceInfos() []DeviceInfo {
+	return getDeviceInfos(r)
+}
+
+func (r Report) SetDeviceInfos(devs []DeviceInfo) {
+	r[KeyDevices] = devs
+}
+
+// DeviceByName returns a copy of the device of name, ok is false if not found
+func (r Report) DeviceByName(name string) (*DeviceInfo, bool) {
+	for _, dev := range r.DeviceInfos() {
+		if dev.Name == name {
+			return dev.DeepCopy(), true
+		}
+	}
+	return nil, false
+}
+
+// ConnectedDevices returns the devices reported as connected
+func (r Report) ConnectedDevices() []DeviceInfo {
+	var res []DeviceInfo
+	for _, dev := range r.DeviceInfos() {
+		if dev.Status == DeviceConnected {
+			res = append(res, *dev.DeepCopy())
+		}
+	}
+	return res
+}
+
+// DisconnectedDevices returns the devices reported as disconnected, or not seen within
+// timeout at now. The devices reported by older agents without status and last seen
+// time are not regarded as disconnected
+func (r Report) DisconnectedDevices(now time.Time, timeout time.Duration) []DeviceInfo {
+	var res []DeviceInfo
+	for _, dev := range r.DeviceInfos() {
+		if dev.Status == DeviceDisconnected || dev.LastSeen != nil && now.Sub(*dev.LastSeen) > timeout {
+			res = append(res, dev)
+		}
+	}
+	return res
+}
+
+// DeviceInfos returns the devices, nil if absent and non-nil if the key holds a list
+func (d Desire) DeviceInfos() []DeviceInfo {
+	return getDeviceInfos(d)
+}
+
+func (d Desire) SetDeviceInfos(devs []DeviceInfo) {
+	d[KeyDevices] = devs
+}
+
+// AppInfos returns the apps or sysapps, nil if absent and non-nil if the key holds a list
+func (r Report) AppInfos(isSys bool) []AppInfo {
+	if isSys {
+		return getAppInfos(KeySysApps, r)
+	} else {
+		return getAppInfos(KeyApps, r)
+	}
+}
+
+func (r Report) SetAppInfos(isSys bool, apps []AppInfo) {
+	if isSys {
+		r[KeySysApps] = apps
+	} else {
+		r[KeyApps] = apps
+	}
+}
+
+// AppInfos returns the apps or sysapps, nil if absent and non-nil if the key holds a list
+func (d Desire) AppInfos(isSys bool) []AppInfo {
+	if isSys {
+		return getAppInfos(KeySysApps, d)
+	} else {
+		return getAppInfos(KeyApps, d)
+	}
+}
+
+func (d Desire) SetAppInfos(isSys bool, apps []AppInfo) {
+	if isSys {
+		d[KeySysApps] = apps
+	} else {
+		d[KeyApps] = apps
+	}
+}
+
+// AppDelta returns the delta which only updates the version of the given app or sysapp.
+// Since a merge patch replaces lists as a whole, the delta targets the keyed
+// representation of the app list, which maps app name to the other fields of app,
+// and should be applied by PatchKeyedApps
+func (d Desire) AppDelta(appName, newVersion string) (Delta, error) {
+	for _, isSys := range []bool{false, true} {
+		for _, app := range d.AppInfos(isSys) {
+			if app.Name == appName {
+				return Delta{appsKey(isSys): map[string]interface{}{
+					appName: map[string]interface{}{"version": newVersion},
+				}}, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("app (%s) not found in desire", appName)
+}
+
+// RemoveApp removes the given app or sysapp from the desire, and returns the delta
+// which carries the remaining app list, since a merge patch replaces lists as a whole
+// the delta can be applied by Patch
+func (d Desire) RemoveApp(appName string) (Delta, error) {
+	for _, isSys := range []bool{false, true} {
+		apps := d.AppInfos(isSys)
+		for i, app := range apps {
+			if app.Name != appName {
+				continue
+			}
+			rest := make([]AppInfo, 0, len(apps)-1)
+			rest = append(rest, apps[:i]...)
+			rest = append(rest, apps[i+1:]...)
+			d.SetAppInfos(isSys, rest)
+			return Delta{appsKey(isSys): rest}, nil
+		}
+	}
+	return nil, errors.Errorf("app (%s) not found in desire", appName)
+}
+
+// PatchKeyedApps patch desire with delta, get the new desire, the apps and sysapps
+// of delta are in keyed representation produced by AppDelta, an app set to null
+// is removed and new apps are appended in order of name. The opts are passed to Patch
+func (d Desire) PatchKeyedApps(delta Delta, opts ...MergeOption) (Desire, error) {
+	rest := Delta{}
+	for k, v := range delta {
+		rest[k] = v
+	}
+	keyed := map[bool]map[string]interface{}{}
+	for _, isSys := range []bool{false, true} {
+		if v, ok := rest[appsKey(isSys)].(map[string]interface{}); ok {
+			keyed[isSys] = v
+			delete(rest, appsKey(isSys))
+		}
+	}
+	res, err := d.Patch(rest, opts...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for isSys, appsDelta := range keyed {
+		apps, err := patchKeyedApps(d.AppInfos(isSys), appsDelta)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		res.SetAppInfos(isSys, apps)
+	}
+	return res, nil
+}
+
+func patchKeyedApps(apps []AppInfo, delta map[string]interface{}) ([]AppInfo, error) {
+	doc := map[string]interface{}{}
+	names := make([]string, 0, len(apps))
+	for _, app := range apps {
+		data, err := json.Marshal(app)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		fields := map[string]interface{}{}
+		if err = json.Unmarshal(data, &fields); err != nil {
+			return nil, errors.Trace(err)
+		}
+		delete(fields, "name")
+		doc[app.Name] = fields
+		names = append(names, app.Name)
+	}
+	var added []string
+	for name := range delta {
+		if _, ok := doc[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	patched, err := patch(doc, delta, json.Unmarshal)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res := []AppInfo{}
+	for _, name := range append(names, added...) {
+		fields, ok := patched[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fields["name"] = name
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		var app AppInfo
+		if err = json.Unmarshal(data, &app); err != nil {
+			return nil, errors.Trace(err)
+		}
+		res = append(res, app)
+	}
+	return res, nil
+}
+
+func appsKey(isSys bool) string {
+	if isSys {
+		return KeySysApps
+	}
+	return KeyApps
+}
+
+// ValidateAppReferences returns the names of configs and secrets referenced by
+// the desired apps and sysapps but not available, sorted and deduplicated
+func (d Desire) ValidateAppReferences(available map[string]bool) []string {
+	missing := map[string]struct{}{}
+	for _, app := range append(d.AppInfos(false), d.AppInfos(true)...) {
+		for _, ref := range app.Refs {
+			if !available[ref] {
+				missing[ref] = struct{}{}
+			}
+		}
+	}
+	var res []string
+	for name := range missing {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// AppsPendingDeletion returns the desired apps and sysapps marked for deletion
+func (d Desire) AppsPendingDeletion() []AppInfo {
+	var res []AppInfo
+	for _, app := range append(d.AppInfos(false), d.AppInfos(true)...) {
+		if app.Deleting {
+			res = append(res, app)
+		}
+	}
+	return res
+}
+
+func (r Report) SetAppStats(isSys bool, stats []AppStats) {
+	if isSys {
+		r[KeySysAppStats] = stats
+	} else {
+		r[KeyAppStats] = stats
+	}
+}
+
+func (d Desire) SetAppStats(isSys bool, stats []AppStats) {
+	if isSys {
+		d[KeySysAppStats] = stats
+	} else {
+		d[KeyAppStats] = stats
+	}
+}
+
+// AppStats returns the stats of apps or sysapps, nil if absent and non-nil if the key holds a list
+func (r Report) AppStats(isSys bool) []AppStats {
+	if isSys {
+		return getAppStats(KeySysAppStats, r)
+	} else {
+		return getAppStats(KeyAppStats, r)
+	}
+}
+
+// AppStats returns the stats of apps or sysapps, nil if absent and non-nil if the key holds a list
+func (d Desire) AppStats(isSys bool) []AppStats {
+	if isSys {
+		return getAppStats(KeySysAppStats, d)
+	} else {
+		return getAppStats(KeyAppStats, d)
+	}
+}
+
+// CoreReportStale checks whether the core has missed its expected reporting window,
+// which is CoreReportTolerance times the frequency in attribute BaetylCoreFrequency
+// since the report time. A node without frequency or report time is not stale
+func (n *Node) CoreReportStale(now time.Time) bool {
+	freq, ok := n.coreFrequency()
+	if !ok {
+		return false
+	}
+	t, ok := n.Report.reportTime()
+	if !ok {
+		return false
+	}
+	return now.After(t.Add(freq * CoreReportTolerance))
+}
+
+// coreFrequency returns the report frequency of core, which may be set as
+// duration string such as "20s" or the number of seconds
+func (n *Node) coreFrequency() (time.Duration, bool) {
+	switch v := n.Attributes[BaetylCoreFrequency].(type) {
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d, d > 0
+		}
+		if sec, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(sec * float64(time.Second)), sec > 0
+		}
+	case float64:
+		return time.Duration(v * float64(time.Second)), v > 0
+	case int:
+		return time.Duration(v) * time.Second, v > 0
+	case time.Duration:
+		return v, v > 0
+	}
+	return 0, false
+}
+
+// ReplicaShortfall returns the number of missing ready instances of desired apps
+// and sysapps, see ReplicaShortfall
+func (n *Node) ReplicaShortfall() map[string]int {
+	res := ReplicaShortfall(n.Desire.AppInfos(false), n.Report.AppStats(false))
+	for name, num := range ReplicaShortfall(n.Desire.AppInfos(true), n.Report.AppStats(true)) {
+		res[name] = num
+	}
+	return res
+}
+
+// BuildAppVersionMatrix returns the version spread of apps and sysapps desired or
+// reported by the nodes, keyed by app name. If the nodes desire different versions
+// of an app, the one desired by most nodes is taken, ties are broken by version order
+func BuildAppVersionMatrix(nodes []*Node) map[string]AppVersionSpread {
+	desired := map[string]map[string]int{}
+	res := map[string]AppVersionSpread{}
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		for _, isSys := range []bool{false, true} {
+			for _, app := range n.Desire.AppInfos(isSys) {
+				if desired[app.Name] == nil {
+					desired[app.Name] = map[string]int{}
+				}
+				desired[app.Name][app.Version]++
+			}
+			for _, app := range n.Report.AppInfos(isSys) {
+				spread, ok := res[app.Name]
+				if !ok {
+					spread.Reported = map[string]int{}
+				}
+				spread.Reported[app.Version]++
+				res[app.Name] = spread
+			}
+		}
+	}
+	for name, versions := range desired {
+		spread, ok := res[name]
+		if !ok {
+			spread.Reported = map[string]int{}
+		}
+		for ver, num := range versions {
+			if top := versions[spread.Desired]; spread.Desired == "" || num > top || (num == top && ver < spread.Desired) {
+				spread.Desired = ver
+			}
+		}
+		res[name] = spread
+	}
+	return res
+}
+
+// CoerceAttributes validates the known attributes and coerces them to the expected types,
+// BaetylCoreAPIPort to an int port and BaetylCoreFrequency to a duration string, where
+// numbers of frequency are taken as seconds. Unknown attributes are left untouched, and
+// the attributes are left untouched if any error is returned
+func (n *Node) CoerceAttributes() error {
+	var port, freq interface{}
+	var err error
+	if v, ok := n.Attributes[BaetylCoreAPIPort]; ok {
+		if port, err = coercePort(v); err != nil {
+			return malformed(errors.Errorf("attribute (%s) is invalid: %s", BaetylCoreAPIPort, err.Error()))
+		}
+	}
+	if v, ok := n.Attributes[BaetylCoreFrequency]; ok {
+		if freq, err = coerceDuration(v); err != nil {
+			return malformed(errors.Errorf("attribute (%s) is invalid: %s", BaetylCoreFrequency, err.Error()))
+		}
+	}
+	if port != nil {
+		n.Attributes[BaetylCoreAPIPort] = port
+	}
+	if freq != nil {
+		n.Attributes[BaetylCoreFrequency] = freq
+	}
+	return nil
+}
+
+func coercePort(v interface{}) (int, error) {
+	var port float64
+	switch p := v.(type) {
+	case int:
+		port = float64(p)
+	case int64:
+		port = float64(p)
+	case float64:
+		port = p
+	case json.Number:
+		f, err := p.Float64()
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		port = f
+	case string:
+		i, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		port = float64(i)
+	default:
+		return 0, errors.Errorf("unexpected type %T", v)
+	}
+	if port != math.Trunc(port) || port <= 0 || port > 65535 {
+		return 0, errors.Errorf("port %v out of range", v)
+	}
+	return int(port), nil
+}
+
+func coerceDuration(v interface{}) (string, error) {
+	var d time.Duration
+	switch f := v.(type) {
+	case string:
+		var err error
+		if d, err = time.ParseDuration(f); err != nil {
+			sec, perr := strconv.ParseFloat(f, 64)
+			if perr != nil {
+				return "", errors.Trace(err)
+			}
+			d = time.Duration(sec * float64(time.Second))
+		}
+	case time.Duration:
+		d = f
+	case int:
+		d = time.Duration(f) * time.Second
+	case float64:
+		d = time.Duration(f * float64(time.Second))
+	case json.Number:
+		sec, err := f.Float64()
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		d = time.Duration(sec * float64(time.Second))
+	default:
+		return "", errors.Errorf("unexpected type %T", v)
+	}
+	if d <= 0 {
+		return "", errors.Errorf("duration %v is not positive", v)
+	}
+	return d.String(), nil
+}
+
+// OutOfSyncApps returns the desired apps and sysapps whose reported version
+// differs from the desired one, including those not reported yet
+func (n *Node) OutOfSyncApps() []AppInfo {
+	var res []AppInfo
+	for _, isSys := range []bool{false, true} {
+		reported := map[string]string{}
+		for _, app := range n.Report.AppInfos(isSys) {
+			reported[app.Name] = app.Version
+		}
+		for _, app := range n.Desire.AppInfos(isSys) {
+			if ver, ok := reported[app.Name]; !ok || ver != app.Version {
+				res = append(res, app)
+			}
+		}
+	}
+	return res
+}
+
+// ValidateAccelerator checks the declared accelerator against the gpu resources
+// in the reported node stats, and returns AcceleratorMismatchError if a gpu is
+// declared but not reported or reported but not declared. A node without node
+// stats reported is not checked
+func (n *Node) ValidateAccelerator() error {
+	report, err := n.compatibleSingleNode()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	nodeStats, ok := report[KeyNodeStats]
+	if !ok || nodeStats == nil {
+		return nil
+	}
+	data, err := json.Marshal(nodeStats)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	stats := map[string]*NodeStats{}
+	if err = json.Unmarshal(data, &stats); err != nil {
+		return errors.Trace(err)
+	}
+	var gpuNodes []string
+	parse := acceleratorParser(n.Accelerator)
+	for name, s := range stats {
+		if s == nil {
+			continue
+		}
+		if parse != nil && s.Extension != nil {
+			parse(s, s.Extension)
+		}
+		if _, _, ok := s.GPUCapacity(); ok {
+			gpuNodes = append(gpuNodes, name)
+		}
+	}
+	sort.Strings(gpuNodes)
+	if (n.Accelerator != "") == (len(gpuNodes) > 0) {
+		return nil
+	}
+	return &AcceleratorMismatchError{Accelerator: n.Accelerator, GPUNodes: gpuNodes}
+}
+
+// View translates the node into node view with the options
+func (n *Node) View(opts ...NodeViewOption) (*NodeView, error) {
+	ops := &NodeViewOptions{}
+	for _, opt := range opts {
+		opt(ops)
+	}
+	return n.ViewWithOptions(ops)
+}
+
+// ViewWithTimeout translates the node into node view with the ready timeout
+//
+// Deprecated: use View with WithReadyTimeout instead.
+func (n *Node) ViewWithTimeout(timeout time.Duration) (*NodeView, error) {
+	return n.View(WithReadyTimeout(timeout))
+}
+
+// ViewWithOptions translates the node into node view with options
+func (n *Node) ViewWithOptions(ops *NodeViewOptions) (*NodeView, error) {
+	if ops == nil {
+		ops = &NodeViewOptions{}
+	}
+	report, err := n.compatibleSingleNode()
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if len(ops.MaskPolicy) > 0 {
+		report = report.Mask(ops.MaskPolicy)
+	}
+	node := *n
+	node.Report = report
+	view := &NodeView{timeFormat: ops.TimeFormat}
+	nodeStr, err := json.Marshal(&node)
+	if err != nil {
+		return nil, internal(err)
+	}
+	err = json.Unmarshal(nodeStr, view)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	if err = view.populateNodeStats(ops); err != nil {
+		return nil, malformed(err)
+	}
+	view.DrainDeadline = n.drainDeadline()
+	if report := view.Report; report != nil {
+		if err = report.translateServiceResourceQuantity(ops.NegativeUsage); err != nil {
+			return nil, malformed(err)
 		}
 		if !view.Ready {
 			err = report.resetNodeAppStats()
 			if err != nil {
-				return nil, errors.Trace(err)
+				return nil, internal(err)
+			}
+		}
+		report.countInstanceNum()
+	}
+	var observed time.Time
+	if view.Report != nil && view.Report.Time != nil {
+		observed = *view.Report.Time
+	}
+	view.populateConditions(observed)
+	view.Report = view.Report.Project(ops.Projection)
+	return view, nil
+}
+
+// compatibleSingleNode migrates the report from the schema version of node, or of
+// report if not set, to ReportSchemaVersion, which translates the report of single
+// node into the report of cluster, the translated report is a copy and n.Report is
+// left unmodified
+func (n *Node) compatibleSingleNode() (Report, error) {
+	version := n.SchemaVersion
+	if version == "" {
+		version = n.Report.SchemaVersion()
+	}
+	report, err := MigrateReport(version, ReportSchemaVersion, n.Report)
+	return report, errors.Trace(err)
+}
+
+// migrateSingleNodeReport translates the report of single node into the report of
+// cluster, the report of cluster is kept as it is, and ReportSchemaVersion is set on
+// the copy returned
+func migrateSingleNodeReport(r Report) (Report, error) {
+	nodeInfo, ok := r["node"]
+	if !ok {
+		return stampSchemaVersion(r), nil
+	}
+	nodeInfoView := map[string]*NodeInfo{}
+	nodeInfoStr, err := json.Marshal(nodeInfo)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = checkObjectShape(KeyNode, nodeInfoStr); err != nil {
+		return nil, errors.Trace(err)
+	}
+	err = json.Unmarshal(nodeInfoStr, &nodeInfoView)
+	if err == nil {
+		return stampSchemaVersion(r), nil
+	}
+	singleNodeInfo := new(NodeInfo)
+	err = json.Unmarshal(nodeInfoStr, singleNodeInfo)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	log.L().Warn("translate the report of single node into the report of cluster", log.Any("hostname", singleNodeInfo.Hostname))
+	report := stampSchemaVersion(r)
+	edgeNodeName := singleNodeInfo.Hostname
+	singleNodeInfo.Role = NodeRoleMaster
+	report["node"] = map[string]*NodeInfo{
+		edgeNodeName: singleNodeInfo,
+	}
+
+	nodeStats, ok := r["nodestats"]
+	if ok {
+		nodeStatsStr, err := json.Marshal(nodeStats)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err = checkObjectShape(KeyNodeStats, nodeStatsStr); err != nil {
+			return nil, errors.Trace(err)
+		}
+		singleNodeStats := new(NodeStats)
+		err = json.Unmarshal(nodeStatsStr, singleNodeStats)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		report["nodestats"] = map[string]*NodeStats{
+			edgeNodeName: singleNodeStats,
+		}
+	}
+	return report, nil
+}
+
+// stampSchemaVersion returns a shallow copy of report with ReportSchemaVersion set
+func stampSchemaVersion(r Report) Report {
+	res := Report{}
+	for k, v := range r {
+		res[k] = v
+	}
+	res.SetSchemaVersion(ReportSchemaVersion)
+	return res
+}
+
+// compareSchemaVersion compares the dot-separated schema versions part by part, numerically
+// if both parts are numbers, otherwise lexically, the missing parts are taken as "0"
+func compareSchemaVersion(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case (xerr != nil || yerr != nil) && x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
+
+// checkObjectShape returns ReportShapeError if data is neither a json object nor null
+func checkObjectShape(section string, data []byte) error {
+	typ := jsonType(data)
+	if typ == "object" || typ == "null" {
+		return nil
+	}
+	return &ReportShapeError{Section: section, Type: typ}
+}
+
+func jsonType(data []byte) string {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return "empty"
+	}
+	switch data[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+func (view *NodeView) populateNodeStats(ops *NodeViewOptions) (err error) {
+	if view.Report == nil {
+		return nil
+	}
+
+	if stats := view.Report.NodeStats; stats != nil {
+		for _, s := range stats {
+			s.Percent = map[string]string{}
+			memory := string(coreV1.ResourceMemory)
+			if s.Percent[memory], err = s.processResourcePercent(s, memory, populateMemoryResource); err != nil {
+				return errors.Trace(err)
+			}
+
+			cpu := string(coreV1.ResourceCPU)
+			if s.Percent[cpu], err = s.processResourcePercent(s, cpu, populateCPUResource); err != nil {
+				return errors.Trace(err)
+			}
+			if err = s.translateMounts(); err != nil {
+				return errors.Trace(err)
+			}
+			s.populateNetworkPercent()
+			if ops.DiskPressureThreshold > 0 && s.UnderDiskPressure(ops.DiskPressureThreshold) {
+				s.DiskPressure = true
+			}
+			if parse := acceleratorParser(view.Accelerator); parse != nil && s.Extension != nil {
+				parse(s, s.Extension)
+			}
+			if ops.PercentPrecision > 0 {
+				s.formatPercent(ops.PercentPrecision)
+			}
+		}
+	}
+
+	if t := view.readyTime(ops.ReadyBy); t != nil {
+		view.Ready = time.Now().UTC().Before(t.Add(ops.Timeout))
+	}
+
+	return
+}
+
+// formatPercent formats all resource percents with the fixed number of decimals,
+// the percents which are not numbers are left as they are
+func (s *NodeStats) formatPercent(precision int) {
+	for k, v := range s.Percent {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+		s.Percent[k] = strconv.FormatFloat(f, 'f', precision, 64)
+	}
+}
+
+// readyTime returns the timestamp which drives the readiness
+func (view *NodeView) readyTime(source ReadySource) *time.Time {
+	if source != ReadyByNodeStatsTime {
+		return view.Report.Time
+	}
+	var res *time.Time
+	for _, s := range view.Report.NodeStats {
+		t := view.Report.Time
+		if s != nil && s.Time != nil {
+			t = s.Time
+		}
+		if t != nil && (res == nil || t.Before(*res)) {
+			res = t
+		}
+	}
+	if res == nil {
+		return view.Report.Time
+	}
+	return res
+}
+
+// populateGPUStats parses the extension of nvidia gpu, whose memory is in bytes already,
+// the percent reported by the extension takes precedence over the computed one
+func populateGPUStats(s *NodeStats, extension interface{}) {
+	stats, _ := extension.(map[string]interface{})
+	populateVendorGPUStats(s, extension, KeyGPUUsedMemory, KeyGPUTotalMemory, 1)
+	if val, ok := stats[KeyGPUPercent]; ok {
+		percent, _ := val.(float64)
+		s.Percent[ResourceGPU] = strconv.FormatFloat(percent, 'f', -1, 64)
+	}
+	if procs := decodeGPUProcesses(stats); len(procs) > 0 {
+		s.GPUProcessStats = procs
+	}
+}
+
+// GPUProcesses returns the gpu usage of processes populated by the view or decoded
+// from the gpu extension, an empty slice is returned if processes are not reported
+func (s *NodeStats) GPUProcesses() []GPUProcess {
+	if s.GPUProcessStats != nil {
+		return s.GPUProcessStats
+	}
+	stats, _ := s.Extension.(map[string]interface{})
+	return decodeGPUProcesses(stats)
+}
+
+// populateAMDGPUStats parses the extension of amd gpu, whose memory is in integer MiB
+func populateAMDGPUStats(s *NodeStats, extension interface{}) {
+	populateVendorGPUStats(s, extension, KeyAMDGPUUsedMemory, KeyAMDGPUTotalMemory, 1024*1024)
+}
+
+// populateIntelGPUStats parses the extension of intel gpu, whose memory is in float GB
+func populateIntelGPUStats(s *NodeStats, extension interface{}) {
+	populateVendorGPUStats(s, extension, KeyIntelGPUUsedMemory, KeyIntelGPUTotalMemory, 1000*1000*1000)
+}
+
+// populateVendorGPUStats sets the gpu usage and capacity in bytes converted by unit,
+// and the percent computed from them, the values which are not numbers are skipped
+func populateVendorGPUStats(s *NodeStats, extension interface{}, usedKey, totalKey string, unit float64) {
+	stats, _ := extension.(map[string]interface{})
+	initResourceMaps(s)
+	used, usedOk := numberValue(stats[usedKey])
+	if usedOk {
+		s.Usage[ResourceGPU] = strconv.FormatFloat(math.Round(used*unit), 'f', -1, 64)
+	}
+	total, totalOk := numberValue(stats[totalKey])
+	if totalOk {
+		s.Capacity[ResourceGPU] = strconv.FormatFloat(math.Round(total*unit), 'f', -1, 64)
+	}
+	if usedOk && totalOk && total != 0 {
+		s.Percent[ResourceGPU] = strconv.FormatFloat(used/total, 'f', -1, 64)
+	}
+}
+
+func initResourceMaps(s *NodeStats) {
+	if s.Usage == nil {
+		s.Usage = map[string]string{}
+	}
+	if s.Capacity == nil {
+		s.Capacity = map[string]string{}
+	}
+	if s.Percent == nil {
+		s.Percent = map[string]string{}
+	}
+}
+
+// numberValue converts the json number of any go type into float64
+func numberValue(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func decodeGPUProcesses(stats map[string]interface{}) []GPUProcess {
+	procs := []GPUProcess{}
+	val, ok := stats[KeyGPUProcesses]
+	if !ok || val == nil {
+		return procs
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return procs
+	}
+	if err = json.Unmarshal(data, &procs); err != nil {
+		log.L().Warn("failed to decode gpu processes", log.Error(err))
+		return []GPUProcess{}
+	}
+	return procs
+}
+
+// translateMounts translates the usage and capacity of mounts into bytes
+func (s *NodeStats) translateMounts() error {
+	for i := range s.Mounts {
+		m := &s.Mounts[i]
+		for _, q := range []*string{&m.Usage, &m.Capacity} {
+			if *q == "" {
+				continue
+			}
+			val, err := translateQuantityToDecimal(*q, false)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			*q = strconv.FormatInt(val, 10)
+		}
+	}
+	return nil
+}
+
+// populateNetworkPercent computes the bandwidth percents of interfaces with known capacity
+func (s *NodeStats) populateNetworkPercent() {
+	for _, n := range s.Networks {
+		if n == nil || n.CapacityBps <= 0 {
+			continue
+		}
+		n.RxBandwidthPercent = float64(n.RxBps) / float64(n.CapacityBps)
+		n.TxBandwidthPercent = float64(n.TxBps) / float64(n.CapacityBps)
+	}
+}
+
+// TotalNetworkRx returns the received bytes summed across all interfaces
+func (s *NodeStats) TotalNetworkRx() int64 {
+	var total int64
+	for _, n := range s.Networks {
+		if n != nil {
+			total += n.RxBytes
+		}
+	}
+	return total
+}
+
+// TotalNetworkTx returns the transmitted bytes summed across all interfaces
+func (s *NodeStats) TotalNetworkTx() int64 {
+	var total int64
+	for _, n := range s.Networks {
+		if n != nil {
+			total += n.TxBytes
+		}
+	}
+	return total
+}
+
+// DiskUsagePercent returns the used fraction of the capacity of disk, which is
+// (total - available) / total, "0" is returned if the total is unknown
+func (s *NodeStats) DiskUsagePercent(device string) (string, error) {
+	d, ok := s.Disks[device]
+	if !ok || d == nil {
+		return "", errors.Errorf("disk (%s) not found", device)
+	}
+	if d.Total <= 0 {
+		return "0", nil
+	}
+	return strconv.FormatFloat(float64(d.Total-d.Available)/float64(d.Total), 'f', -1, 64), nil
+}
+
+// UnderDiskPressure checks whether the used fraction of the capacity of any disk exceeds threshold
+func (s *NodeStats) UnderDiskPressure(threshold float64) bool {
+	for _, d := range s.Disks {
+		if d == nil || d.Total <= 0 {
+			continue
+		}
+		if float64(d.Total-d.Available)/float64(d.Total) > threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// MountPercent returns the utilization of the mount of path, ok is false if the
+// mount is missing or its usage or capacity is invalid
+func (s *NodeStats) MountPercent(path string) (float64, bool) {
+	for _, m := range s.Mounts {
+		if m.Path != path {
+			continue
+		}
+		usage, err := translateQuantityToDecimal(m.Usage, false)
+		if err != nil {
+			return 0, false
+		}
+		total, err := translateQuantityToDecimal(m.Capacity, false)
+		if err != nil || total == 0 {
+			return 0, false
+		}
+		return float64(usage) / float64(total), true
+	}
+	return 0, false
+}
+
+// GPUCapacity returns the number of gpus and the total gpu memory in bytes,
+// which are parsed from the gpu capacity and the gpu extension, ok is false
+// if the node does not report gpu capacity
+func (s *NodeStats) GPUCapacity() (count int, memoryBytes int64, ok bool) {
+	stats, _ := s.Extension.(map[string]interface{})
+	if val, exist := s.Capacity[ResourceGPU]; exist {
+		total, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		memoryBytes, ok = int64(total), true
+	} else if val, exist := stats[KeyGPUTotalMemory]; exist {
+		total, isNum := val.(float64)
+		if !isNum {
+			return 0, 0, false
+		}
+		memoryBytes, ok = int64(total), true
+	}
+	if !ok {
+		return 0, 0, false
+	}
+	if val, exist := stats[KeyGPUCount]; exist {
+		num, _ := val.(float64)
+		count = int(num)
+	}
+	return count, memoryBytes, true
+}
+
+func (s *NodeStats) processResourcePercent(status *NodeStats, resourceType string,
+	populate func(usage string, resource map[string]string) (int64, error)) (string, error) {
+	cap, capOk := status.Capacity[resourceType]
+	usg, usageOk := status.Usage[resourceType]
+	var total, usage int64
+	var err error
+	if capOk {
+		if total, err = populate(cap, status.Capacity); err != nil {
+			return "0", errors.Trace(err)
+		}
+	}
+	if alloc, ok := status.Allocatable[resourceType]; ok {
+		if total, err = populate(alloc, status.Allocatable); err != nil {
+			return "0", errors.Trace(err)
+		}
+		capOk = true
+	}
+	if usageOk {
+		if usage, err = populate(usg, status.Usage); err != nil {
+			return "0", errors.Trace(err)
+		}
+	}
+
+	if capOk && usageOk && total != 0 {
+		return strconv.FormatFloat(float64(usage)/float64(total), 'f', -1, 64), nil
+	}
+	return "0", nil
+}
+
+// Project returns a copy of the view which retains only the fields whose json keys are in fields,
+// such as "appstats", the other fields are zeroed. All fields are retained if fields is empty
+func (view *ReportView) Project(fields []string) *ReportView {
+	if view == nil {
+		return nil
+	}
+	res := *view
+	projectFields(&res, fields)
+	return &res
+}
+
+// Project returns a copy of the view which retains only the fields whose json keys are in fields,
+// such as "ready", the other fields are zeroed. All fields are retained if fields is empty
+func (view *NodeView) Project(fields []string) *NodeView {
+	if view == nil {
+		return nil
+	}
+	res := *view
+	projectFields(&res, fields)
+	return &res
+}
+
+// projectFields zeroes the exported fields of the struct pointed by ptr whose json keys are not in fields
+func projectFields(ptr interface{}, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+	retained := map[string]bool{}
+	for _, k := range fields {
+		retained[k] = true
+	}
+	v := reflect.ValueOf(ptr).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if !retained[jsonFieldName(field)] {
+			v.Field(i).Set(reflect.Zero(field.Type))
+		}
+	}
+}
+
+func (view *ReportView) countInstanceNum() {
+	nums := map[string]int{}
+	if view.AppStats != nil {
+		for _, stat := range view.AppStats {
+			for _, ins := range stat.InstanceStats {
+				if _, ok := nums[ins.NodeName]; ok {
+					nums[ins.NodeName] += 1
+				} else {
+					nums[ins.NodeName] = 1
+				}
+			}
+		}
+	}
+	if view.SysAppStats != nil {
+		for _, stat := range view.SysAppStats {
+			for _, ins := range stat.InstanceStats {
+				if _, ok := nums[ins.NodeName]; ok {
+					nums[ins.NodeName] += 1
+				} else {
+					nums[ins.NodeName] = 1
+				}
+			}
+		}
+	}
+	view.NodeInsNum = nums
+}
+
+// TotalInstances returns the total number of instances of the cluster,
+// which sums NodeInsNum counted by the view
+func (view *ReportView) TotalInstances() int {
+	total := 0
+	for _, num := range view.NodeInsNum {
+		total += num
+	}
+	return total
+}
+
+// TotalApps returns the number of reported apps
+func (view *ReportView) TotalApps() int {
+	return len(view.Apps)
+}
+
+// TotalSysApps returns the number of reported sysapps
+func (view *ReportView) TotalSysApps() int {
+	return len(view.SysApps)
+}
+
+// ClusterPercentStats returns the unweighted average, the average weighted by capacity
+// and the maximum of the resource percent across nodes, which are computed from the
+// node stats populated by the view. Nodes without the resource are skipped
+func (view *ReportView) ClusterPercentStats(resource string) (avg, weightedAvg, max float64, err error) {
+	var sum, weightedSum, totalCapacity float64
+	count := 0
+	for name, s := range view.NodeStats {
+		if s == nil {
+			continue
+		}
+		pct, ok := s.Percent[resource]
+		if !ok {
+			continue
+		}
+		percent, err := strconv.ParseFloat(pct, 64)
+		if err != nil {
+			return 0, 0, 0, errors.Errorf("failed to parse percent of resource (%s) of node (%s): %s", resource, name, err.Error())
+		}
+		capacity, _ := strconv.ParseFloat(s.Capacity[resource], 64)
+		if count == 0 || percent > max {
+			max = percent
+		}
+		sum += percent
+		weightedSum += percent * capacity
+		totalCapacity += capacity
+		count++
+	}
+	if count == 0 {
+		return 0, 0, 0, nil
+	}
+	avg = sum / float64(count)
+	if totalCapacity != 0 {
+		weightedAvg = weightedSum / totalCapacity
+	}
+	return avg, weightedAvg, max, nil
+}
+
+// MarshalJSON marshals the view, the times are formatted according to the
+// TimeFormat of view options
+func (view NodeView) MarshalJSON() ([]byte, error) {
+	type plain NodeView
+	data, err := json.Marshal(plain(view))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if view.timeFormat != TimeFormatEpochMillis {
+		return data, nil
+	}
+	doc := map[string]interface{}{}
+	if err = unmarshalWithNumber(data, &doc); err != nil {
+		return nil, errors.Trace(err)
+	}
+	formatTimeFields(reflect.ValueOf(view), doc)
+	data, err = json.Marshal(doc)
+	return data, errors.Trace(err)
+}
+
+// formatTimeFields formats the times of doc, which is the json document of v, as milliseconds
+// since epoch, the times are found by the fields of v typed time.Time or *time.Time
+func formatTimeFields(v reflect.Value, doc interface{}) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if f.Anonymous && strings.Split(f.Tag.Get("json"), ",")[0] == "" {
+				formatTimeFields(v.Field(i), m)
+				continue
+			}
+			name := jsonFieldName(f)
+			if name == "" {
+				continue
+			}
+			if t := f.Type; t == timeType || t.Kind() == reflect.Ptr && t.Elem() == timeType {
+				formatEpochMillis(m, name)
+				continue
+			}
+			formatTimeFields(v.Field(i), m[name])
+		}
+	case reflect.Map:
+		m, ok := doc.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		for _, k := range v.MapKeys() {
+			formatTimeFields(v.MapIndex(k), m[k.String()])
+		}
+	case reflect.Slice, reflect.Array:
+		l, ok := doc.([]interface{})
+		if !ok {
+			return
+		}
+		for i := 0; i < v.Len() && i < len(l); i++ {
+			formatTimeFields(v.Index(i), l[i])
+		}
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// formatEpochMillis replaces the RFC3339 time of key with milliseconds since epoch
+func formatEpochMillis(m map[string]interface{}, key string) {
+	v, ok := m[key].(string)
+	if !ok {
+		return
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return
+	}
+	m[key] = t.UnixNano() / int64(time.Millisecond)
+}
+
+// DiffNodeViews returns the merge patch which converts the old view into the new view,
+// the removed fields are set to nil, and an empty delta means nothing changed.
+// A nil view is treated as an empty one
+func DiffNodeViews(oldView, newView *NodeView) (map[string]interface{}, error) {
+	o, err := nodeViewDoc(oldView)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	n, err := nodeViewDoc(newView)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return createMergePatch(o, n), nil
+}
+
+// nodeViewDoc converts the view into generic json values as it is marshaled
+func nodeViewDoc(view *NodeView) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	if view == nil {
+		return doc, nil
+	}
+	data, err := json.Marshal(view)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err = unmarshalWithNumber(data, &doc); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return doc, nil
+}
+
+// MarshalFields marshals the view with only the requested top-level fields, which are
+// matched by json name, unknown fields are ignored and no fields marshal the whole view
+func (view *NodeView) MarshalFields(fields []string) ([]byte, error) {
+	data, err := json.Marshal(view)
+	if err != nil || len(fields) == 0 {
+		return data, errors.Trace(err)
+	}
+	doc := map[string]json.RawMessage{}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Trace(err)
+	}
+	selected := map[string]bool{}
+	for _, f := range fields {
+		selected[f] = true
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	rt := reflect.TypeOf(*view)
+	for i := 0; i < rt.NumField(); i++ {
+		name := jsonFieldName(rt.Field(i))
+		raw, ok := doc[name]
+		if !ok || !selected[name] {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(raw)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonFieldName returns the json name of struct field
+func jsonFieldName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// OvercommittedResources returns the sorted names of nodes per resource where the sum of
+// instance usage of apps and sysapps exceeds the node capacity. Resources without
+// capacity reported and usages which can not be parsed as quantity are skipped
+func (view *NodeView) OvercommittedResources() map[string][]string {
+	res := map[string][]string{}
+	if view.Report == nil {
+		return res
+	}
+	used := map[string]map[string]int64{}
+	for _, stats := range [][]AppStats{view.Report.AppStats, view.Report.SysAppStats} {
+		for _, stat := range stats {
+			for _, ins := range stat.InstanceStats {
+				for name, usage := range ins.Usage {
+					val, err := translateQuantityToDecimal(usage, true)
+					if err != nil {
+						continue
+					}
+					if used[ins.NodeName] == nil {
+						used[ins.NodeName] = map[string]int64{}
+					}
+					used[ins.NodeName][name] += val
+				}
+			}
+		}
+	}
+	for node, usages := range used {
+		s, ok := view.Report.NodeStats[node]
+		if !ok || s == nil {
+			continue
+		}
+		for name, usage := range usages {
+			capacity, ok := s.Capacity[name]
+			if !ok {
+				continue
+			}
+			total, err := translateQuantityToDecimal(capacity, true)
+			if err != nil || usage <= total {
+				continue
+			}
+			res[name] = append(res[name], node)
+		}
+	}
+	for _, nodes := range res {
+		sort.Strings(nodes)
+	}
+	return res
+}
+
+// TotalClusterPower returns the sum of power draw in watts across nodes
+func (view *NodeView) TotalClusterPower() float64 {
+	if view.Report == nil {
+		return 0
+	}
+	var total float64
+	for _, s := range view.Report.NodeStats {
+		if s != nil {
+			total += s.Power
+		}
+	}
+	return total
+}
+
+// HealthScore returns the health score of node in [0, 100] with DefaultHealthWeights
+func (view *NodeView) HealthScore() int {
+	return view.HealthScoreWithWeights(DefaultHealthWeights)
+}
+
+// HealthScoreWithWeights returns the health score of node in [0, 100], which is
+// 100 * (w.Ready*ready + w.Pressure*(1-pressure) + w.Failure*(1-failed)) / (w.Ready+w.Pressure+w.Failure)
+// where ready is 1 if the node is ready otherwise 0, pressure is the max cpu or memory
+// percent across nodes clamped into [0, 1], and failed is the ratio of failed instances
+// to all instances of apps and sysapps. The score is 0 if the sum of weights is not positive
+func (view *NodeView) HealthScoreWithWeights(w HealthWeights) int {
+	total := w.Ready + w.Pressure + w.Failure
+	if total <= 0 {
+		return 0
+	}
+	var ready, pressure, failed float64
+	if view.Ready {
+		ready = 1
+	}
+	if report := view.Report; report != nil {
+		for _, s := range report.NodeStats {
+			if s == nil {
+				continue
+			}
+			for _, resource := range []coreV1.ResourceName{coreV1.ResourceCPU, coreV1.ResourceMemory} {
+				if p, err := strconv.ParseFloat(s.Percent[string(resource)], 64); err == nil && p > pressure {
+					pressure = math.Min(p, 1)
+				}
+			}
+		}
+		instances := 0
+		for _, stats := range [][]AppStats{report.AppStats, report.SysAppStats} {
+			for _, stat := range stats {
+				instances += len(stat.InstanceStats)
+			}
+		}
+		if instances > 0 {
+			failed = float64(len(report.FailedInstances())) / float64(instances)
+		}
+	}
+	score := 100 * (w.Ready*ready + w.Pressure*(1-pressure) + w.Failure*(1-failed)) / total
+	return int(math.Round(math.Max(0, math.Min(100, score))))
+}
+
+// PrimaryNodeName returns the name of the primary node, which is the node with
+// role NodeRoleMaster (the first in name order if many) or the only node reported.
+// The hostname of single node is returned since it is translated into the master
+func (view *NodeView) PrimaryNodeName() string {
+	if view.Report == nil {
+		return ""
+	}
+	var names []string
+	for name, info := range view.Report.Node {
+		if info != nil && info.Role == NodeRoleMaster {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return names[0]
+	}
+	if len(view.Report.Node) == 1 {
+		for name := range view.Report.Node {
+			return name
+		}
+	}
+	return ""
+}
+
+// NodeLabels returns the labels of the given node for display, which combine
+// the labels reported by the edge with the desired labels of the node,
+// the desired labels take precedence when keys collide
+func (view *NodeView) NodeLabels(nodeName string) map[string]string {
+	res := map[string]string{}
+	if view.Report != nil {
+		if info, ok := view.Report.Node[nodeName]; ok && info != nil {
+			for k, v := range info.Labels {
+				res[k] = v
 			}
 		}
-		report.countInstanceNum()
 	}
-	return view, nil
+	for k, v := range view.Labels {
+		res[k] = v
+	}
+	return res
+}
+
+// AcceleratorUsage returns the accelerator usage of each node sorted by node name,
+// which is drawn from the gpu stats populated by the view
+func (view *NodeView) AcceleratorUsage() []AcceleratorUsage {
+	if view.Report == nil {
+		return nil
+	}
+	var res []AcceleratorUsage
+	for name, s := range view.Report.NodeStats {
+		if s == nil {
+			continue
+		}
+		if _, ok := s.Capacity[ResourceGPU]; !ok {
+			continue
+		}
+		usage := AcceleratorUsage{NodeName: name, Resource: ResourceGPU}
+		usage.Total, _ = strconv.ParseFloat(s.Capacity[ResourceGPU], 64)
+		usage.Used, _ = strconv.ParseFloat(s.Usage[ResourceGPU], 64)
+		usage.Percent, _ = strconv.ParseFloat(s.Percent[ResourceGPU], 64)
+		usage.InUse = usage.Used > 0
+		res = append(res, usage)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].NodeName < res[j].NodeName
+	})
+	return res
 }
 
-func (n *Node) compatibleSingleNode() error {
-	edgeNodeName := ""
-	nodeInfo, ok := n.Report["node"]
-	if ok {
-		nodeInfoView := map[string]*NodeInfo{}
-		nodeInfoStr, err := json.Marshal(nodeInfo)
-		if err != nil {
-			return errors.Trace(err)
-		}
-		err = json.Unmarshal(nodeInfoStr, &nodeInfoView)
-		if err != nil {
-			log.L().Warn("failed to translate node to cluster node view", log.Any("node", n.Name))
-			singleNodeInfo := new(NodeInfo)
-			err = json.Unmarshal(nodeInfoStr, singleNodeInfo)
-			if err != nil {
-				return errors.Trace(err)
-			}
-			edgeNodeName = singleNodeInfo.Hostname
-			singleNodeInfo.Role = "master"
-			n.Report["node"] = map[string]*NodeInfo{
-				edgeNodeName: singleNodeInfo,
+// InstancesByQoS returns the number of instances of all apps and sysapps per qos class,
+// instances without qos class reported nor limit are counted as QoSBestEffort
+func (view *ReportView) InstancesByQoS() map[string]int {
+	res := map[string]int{}
+	for _, stats := range [][]AppStats{view.AppStats, view.SysAppStats} {
+		for _, stat := range stats {
+			for _, ins := range stat.InstanceStats {
+				class := ins.QoSClass
+				if class == "" {
+					class = QoSBestEffort
+				}
+				res[string(class)]++
 			}
+		}
+	}
+	return res
+}
 
-			nodeStats, ok := n.Report["nodestats"]
-			if ok {
-				nodeStatsStr, err := json.Marshal(nodeStats)
-				if err != nil {
-					return errors.Trace(err)
+// AppResourceShare returns the fraction of the cpu and memory usage of the cluster used by
+// each app and sysapp, which divides the summed usage of the instances of app by the summed
+// usage of nodes. Apps without usage and resources without node usage report 0
+func (view *ReportView) AppResourceShare() map[string]map[string]float64 {
+	resources := []string{string(coreV1.ResourceCPU), string(coreV1.ResourceMemory)}
+	total := map[string]int64{}
+	for _, s := range view.NodeStats {
+		if s == nil {
+			continue
+		}
+		for _, name := range resources {
+			if usage, ok := s.Usage[name]; ok {
+				if val, err := translateQuantityToDecimal(usage, true); err == nil {
+					total[name] += val
 				}
-				singleNodeStats := new(NodeStats)
-				err = json.Unmarshal(nodeStatsStr, singleNodeStats)
-				if err != nil {
-					return errors.Trace(err)
+			}
+		}
+	}
+	res := map[string]map[string]float64{}
+	for _, stats := range [][]AppStats{view.AppStats, view.SysAppStats} {
+		for _, stat := range stats {
+			used := map[string]int64{}
+			for _, ins := range stat.InstanceStats {
+				for _, name := range resources {
+					if usage, ok := ins.Usage[name]; ok {
+						if val, err := translateQuantityToDecimal(usage, true); err == nil {
+							used[name] += val
+						}
+					}
 				}
-				n.Report["nodestats"] = map[string]*NodeStats{
-					edgeNodeName: singleNodeStats,
+			}
+			share := map[string]float64{}
+			for _, name := range resources {
+				share[name] = 0
+				if total[name] > 0 {
+					share[name] = float64(used[name]) / float64(total[name])
 				}
 			}
+			res[stat.Name] = share
 		}
 	}
-	return nil
+	return res
 }
 
-func (view *NodeView) populateNodeStats(timeout time.Duration) (err error) {
-	if view.Report == nil {
-		return nil
+// AggregateAppStats merges the stats of apps or sysapps with the same name reported by
+// different nodes into one, in the order the names first appear. The instances are merged,
+// an instance whose name is taken is keyed by "<node name>/<instance name>", the usage of
+// instances is summed after being normalized to cores for cpu and to integer values for
+// others, unparsable usage is skipped, and the worst status of apps and instances wins
+func (view *ReportView) AggregateAppStats(isSys bool) []AppStats {
+	stats := view.AppStats
+	if isSys {
+		stats = view.SysAppStats
 	}
-
-	if stats := view.Report.NodeStats; stats != nil {
-		for _, s := range stats {
-			s.Percent = map[string]string{}
-			memory := string(coreV1.ResourceMemory)
-			if s.Percent[memory], err = s.processResourcePercent(s, memory, populateMemoryResource); err != nil {
-				return errors.Trace(err)
+	var res []AppStats
+	index := map[string]int{}
+	used := map[string]map[string]int64{}
+	for _, stat := range stats {
+		idx, ok := index[stat.Name]
+		if !ok {
+			idx = len(res)
+			index[stat.Name] = idx
+			agg := *stat.DeepCopy()
+			agg.InstanceStats = map[string]InstanceStats{}
+			agg.Usage = nil
+			res = append(res, agg)
+			used[stat.Name] = map[string]int64{}
+		}
+		agg := &res[idx]
+		if stat.Status.severity() > agg.Status.severity() {
+			agg.Status = stat.Status
+			agg.Cause = stat.Cause
+		}
+		for name, ins := range stat.InstanceStats {
+			if _, ok := agg.InstanceStats[name]; ok {
+				name = ins.NodeName + "/" + name
 			}
-
-			cpu := string(coreV1.ResourceCPU)
-			if s.Percent[cpu], err = s.processResourcePercent(s, cpu, populateCPUResource); err != nil {
-				return errors.Trace(err)
+			agg.InstanceStats[name] = *ins.DeepCopy()
+			if ins.Status.severity() > agg.Status.severity() {
+				agg.Status = ins.Status
 			}
-			if extension := s.Extension; extension != nil &&
-				view.Accelerator == NVAccelerator {
-				populateGPUStats(s, extension)
+			for k, v := range ins.Usage {
+				val, err := translateQuantityToDecimal(v, k == string(coreV1.ResourceCPU))
+				if err != nil {
+					continue
+				}
+				used[stat.Name][k] += val
 			}
 		}
 	}
-
-	if view.Report.Time != nil {
-		view.Ready = time.Now().UTC().Before(view.Report.Time.Add(timeout))
+	for idx := range res {
+		sums := used[res[idx].Name]
+		if len(sums) == 0 {
+			continue
+		}
+		res[idx].Usage = map[string]string{}
+		for k, v := range sums {
+			if k == string(coreV1.ResourceCPU) {
+				res[idx].Usage[k] = strconv.FormatFloat(float64(v)/milliPrecision, 'f', -1, 64)
+			} else {
+				res[idx].Usage[k] = strconv.FormatInt(v, 10)
+			}
+		}
 	}
-
-	return
+	return res
 }
 
-func populateGPUStats(s *NodeStats, extension interface{}) {
-	stats, _ := extension.(map[string]interface{})
-	if val, ok := stats[KeyGPUUsedMemory]; ok {
-		used, _ := val.(float64)
-		s.Usage[ResourceGPU] = strconv.FormatFloat(used, 'f', -1, 64)
-	}
-	if val, ok := stats[KeyGPUTotalMemory]; ok {
-		total, _ := val.(float64)
-		s.Capacity[ResourceGPU] = strconv.FormatFloat(total, 'f', -1, 64)
+// NodesRunningApp returns the sorted names of nodes where the app or sysapp has instances
+func (view *ReportView) NodesRunningApp(appName string, isSys bool) []string {
+	stats := view.AppStats
+	if isSys {
+		stats = view.SysAppStats
 	}
-	if val, ok := stats[KeyGPUPercent]; ok {
-		percent, _ := val.(float64)
-		s.Percent[ResourceGPU] = strconv.FormatFloat(percent, 'f', -1, 64)
+	seen := map[string]bool{}
+	res := []string{}
+	for _, stat := range stats {
+		if stat.Name != appName {
+			continue
+		}
+		for _, ins := range stat.InstanceStats {
+			if ins.NodeName != "" && !seen[ins.NodeName] {
+				seen[ins.NodeName] = true
+				res = append(res, ins.NodeName)
+			}
+		}
 	}
+	sort.Strings(res)
+	return res
 }
 
-func (s *NodeStats) processResourcePercent(status *NodeStats, resourceType string,
-	populate func(usage string, resource map[string]string) (int64, error)) (string, error) {
-	cap, capOk := status.Capacity[resourceType]
-	usg, usageOk := status.Usage[resourceType]
-	var total, usage int64
-	var err error
-	if capOk {
-		if total, err = populate(cap, status.Capacity); err != nil {
-			return "0", errors.Trace(err)
+// StuckApps returns the apps and sysapps which have been in a non-terminal status such as
+// Pending for longer than threshold at now, apps without status or StatusSince are excluded
+func (view *ReportView) StuckApps(threshold time.Duration, now time.Time) []AppStats {
+	var res []AppStats
+	for _, stats := range [][]AppStats{view.AppStats, view.SysAppStats} {
+		for _, stat := range stats {
+			if stat.Status == "" || stat.Status.IsTerminal() || stat.StatusSince == nil {
+				continue
+			}
+			if now.Sub(*stat.StatusSince) > threshold {
+				res = append(res, stat)
+			}
 		}
 	}
-	if usageOk {
-		if usage, err = populate(usg, status.Usage); err != nil {
-			return "0", errors.Trace(err)
+	return res
+}
+
+// AppsByAnnotation returns the stats of apps and sysapps annotated with the key and value
+func (view *ReportView) AppsByAnnotation(key, value string) []AppStats {
+	var res []AppStats
+	for _, stats := range [][]AppStats{view.AppStats, view.SysAppStats} {
+		for _, stat := range stats {
+			if v, ok := stat.Annotations[key]; ok && v == value {
+				res = append(res, stat)
+			}
 		}
 	}
+	return res
+}
 
-	if capOk && usageOk && total != 0 {
-		return strconv.FormatFloat(float64(usage)/float64(total), 'f', -1, 64), nil
+// AppHealthSummary counts the apps by the status derived by AppStats.DerivedStatus,
+// Running is healthy and Pending is degraded, sysapps are not counted
+func (view *ReportView) AppHealthSummary() AppHealthSummary {
+	var res AppHealthSummary
+	for _, stat := range view.AppStats {
+		res.Total++
+		switch stat.DerivedStatus() {
+		case Running:
+			res.Healthy++
+		case Pending:
+			res.Degraded++
+		case Failed:
+			res.Failed++
+		default:
+			res.Unknown++
+		}
 	}
-	return "0", nil
+	return res
 }
 
-func (view *ReportView) countInstanceNum() {
-	nums := map[string]int{}
-	if view.AppStats != nil {
-		for _, stat := range view.AppStats {
-			for _, ins := range stat.InstanceStats {
-				if _, ok := nums[ins.NodeName]; ok {
-					nums[ins.NodeName] += 1
-				} else {
-					nums[ins.NodeName] = 1
+// FailedInstances returns the failed instances of all apps and sysapps,
+// the instances of each app are sorted by name
+func (view *ReportView) FailedInstances() []FailedInstance {
+	var res []FailedInstance
+	for _, stats := range [][]AppStats{view.AppStats, view.SysAppStats} {
+		for _, stat := range stats {
+			names := make([]string, 0, len(stat.InstanceStats))
+			for name, ins := range stat.InstanceStats {
+				if ins.Status == Failed {
+					names = append(names, name)
 				}
 			}
+			sort.Strings(names)
+			for _, name := range names {
+				ins := stat.InstanceStats[name]
+				res = append(res, FailedInstance{
+					AppName:      stat.Name,
+					InstanceName: name,
+					NodeName:     ins.NodeName,
+					Cause:        ins.Cause,
+				})
+			}
 		}
 	}
-	if view.SysAppStats != nil {
-		for _, stat := range view.SysAppStats {
-			for _, ins := range stat.InstanceStats {
-				if _, ok := nums[ins.NodeName]; ok {
-					nums[ins.NodeName] += 1
-				} else {
-					nums[ins.NodeName] = 1
+	return res
+}
+
+// FallbackPlacements returns the instances of all apps and sysapps placed by fallback,
+// the instances of each app are sorted by name
+func (view *ReportView) FallbackPlacements() []PlacedInstance {
+	var res []PlacedInstance
+	for _, stats := range [][]AppStats{view.AppStats, view.SysAppStats} {
+		for _, stat := range stats {
+			names := make([]string, 0, len(stat.InstanceStats))
+			for name, ins := range stat.InstanceStats {
+				if ins.Placement.IsFallback() {
+					names = append(names, name)
 				}
 			}
+			sort.Strings(names)
+			for _, name := range names {
+				ins := stat.InstanceStats[name]
+				res = append(res, PlacedInstance{
+					AppName:      stat.Name,
+					InstanceName: name,
+					NodeName:     ins.NodeName,
+					Placement:    ins.Placement,
+				})
+			}
 		}
 	}
-	view.NodeInsNum = nums
+	return res
 }
 
-func (view *ReportView) translateServiceResourceQuantity() error {
+func (view *ReportView) translateServiceResourceQuantity(policy NegativeUsagePolicy) error {
 	for idx := range view.SysAppStats {
 		instances := view.SysAppStats[idx].InstanceStats
 		if instances == nil {
 			continue
 		}
-		for _, v := range instances {
-			if err := v.translateResourceQuantity(); err != nil {
+		for k, v := range instances {
+			if err := v.translateResourceQuantity(policy); err != nil {
 				return errors.Trace(err)
 			}
+			instances[k] = v
 		}
 	}
 
@@ -452,10 +3675,11 @@ func (view *ReportView) translateServiceResourceQuantity() error {
 		if services == nil {
 			continue
 		}
-		for _, v := range services {
-			if err := v.translateResourceQuantity(); err != nil {
+		for k, v := range services {
+			if err := v.translateResourceQuantity(policy); err != nil {
 				return errors.Trace(err)
 			}
+			services[k] = v
 		}
 	}
 
@@ -473,25 +3697,91 @@ func (view *ReportView) resetNodeAppStats() error {
 	return nil
 }
 
-func (s *InstanceStats) translateResourceQuantity() error {
-	if s.Usage == nil {
-		return nil
-	}
+func (s *InstanceStats) translateResourceQuantity(policy NegativeUsagePolicy) error {
+	for _, res := range []map[string]string{s.Usage, s.Limit} {
+		if res == nil {
+			continue
+		}
 
-	if cpuUsage, cpuOk := s.Usage[string(coreV1.ResourceCPU)]; cpuOk {
-		if _, err := populateCPUResource(cpuUsage, s.Usage); err != nil {
-			return errors.Trace(err)
+		if cpuUsage, cpuOk := res[string(coreV1.ResourceCPU)]; cpuOk {
+			if _, err := populateCPUResource(cpuUsage, res); err != nil {
+				return errors.Trace(err)
+			}
+		}
+
+		if memoryUsage, mOk := res[string(coreV1.ResourceMemory)]; mOk {
+			if _, err := populateMemoryResource(memoryUsage, res); err != nil {
+				return errors.Trace(err)
+			}
 		}
 	}
+	if err := s.validateResourceUsage(policy); err != nil {
+		return errors.Trace(err)
+	}
+	// the qos class reported by the agent is kept
+	if s.QoSClass == "" && len(s.Limit) > 0 {
+		s.QoSClass = s.computeQoSClass()
+	}
+	return nil
+}
 
-	if memoryUsage, mOk := s.Usage[string(coreV1.ResourceMemory)]; mOk {
-		if _, err := populateMemoryResource(memoryUsage, s.Usage); err != nil {
-			return errors.Trace(err)
+// computeQoSClass computes the qos class from the limit, the requests default to
+// the limits since they are not reported, so the instance is guaranteed if both
+// cpu and memory are limited, burstable if partially limited, otherwise best effort
+func (s *InstanceStats) computeQoSClass() QoSClass {
+	_, cpuOk := s.Limit[string(coreV1.ResourceCPU)]
+	_, memOk := s.Limit[string(coreV1.ResourceMemory)]
+	switch {
+	case cpuOk && memOk:
+		return QoSGuaranteed
+	case cpuOk || memOk:
+		return QoSBurstable
+	default:
+		return QoSBestEffort
+	}
+}
+
+// validateResourceUsage rejects or clamps the negative resource usage according to policy
+func (s *InstanceStats) validateResourceUsage(policy NegativeUsagePolicy) error {
+	for name, usage := range s.Usage {
+		val, err := strconv.ParseFloat(usage, 64)
+		if err != nil || val >= 0 {
+			continue
+		}
+		log.L().Warn("negative resource usage of instance", log.Any("instance", s.Name), log.Any("resource", name), log.Any("usage", usage))
+		if policy == NegativeUsageReject {
+			return errors.Trace(ErrNegativeResourceUsage)
 		}
+		s.Usage[name] = "0"
 	}
 	return nil
 }
 
+// UsageVsLimit returns the percent of limit used by the instance per resource,
+// resources without usage or limit are omitted
+func (s *InstanceStats) UsageVsLimit() map[string]string {
+	res := map[string]string{}
+	for name, limit := range s.Limit {
+		usage, ok := s.Usage[name]
+		if !ok {
+			continue
+		}
+		milli := name == string(coreV1.ResourceCPU)
+		total, err := translateQuantityToDecimal(limit, milli)
+		if err != nil || total == 0 {
+			continue
+		}
+		used, err := translateQuantityToDecimal(usage, milli)
+		if err != nil {
+			continue
+		}
+		res[name] = strconv.FormatFloat(float64(used)/float64(total), 'f', -1, 64)
+	}
+	return res
+}
+
+// getAppInfos returns nil if the apps are absent, null or not a list,
+// otherwise a non-nil slice, the malformed entries are skipped
 func getAppInfos(appType string, data map[string]interface{}) []AppInfo {
 	if data == nil {
 		return nil
@@ -500,25 +3790,66 @@ func getAppInfos(appType string, data map[string]interface{}) []AppInfo {
 	if !ok || apps == nil {
 		return nil
 	}
-	res, ok := apps.([]AppInfo)
-	if ok {
+	if res, ok := apps.([]AppInfo); ok {
+		if res == nil {
+			return []AppInfo{}
+		}
 		return res
 	}
-	res = []AppInfo{}
 	ais, ok := apps.([]interface{})
 	if !ok {
 		return nil
 	}
+	res := []AppInfo{}
 	for _, ai := range ais {
-		aim := ai.(map[string]interface{})
-		if aim == nil {
-			return nil
+		aim, ok := ai.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		info := AppInfo{}
+		info.Name, _ = aim["name"].(string)
+		info.Version, _ = aim["version"].(string)
+		info.Deleting, _ = aim["deleting"].(bool)
+		switch replicas := aim["replicas"].(type) {
+		case float64:
+			info.Replicas = int(replicas)
+		case int:
+			info.Replicas = replicas
+		}
+		if refs, ok := aim["refs"].([]interface{}); ok {
+			for _, ref := range refs {
+				if name, ok := ref.(string); ok {
+					info.Refs = append(info.Refs, name)
+				}
+			}
+		}
+		res = append(res, info)
+	}
+	return res
+}
+
+// ReplicaShortfall returns the desired replicas minus the running instances reported
+// per app, only the apps with replicas specified and not enough instances are included
+func ReplicaShortfall(apps []AppInfo, stats []AppStats) map[string]int {
+	running := map[string]int{}
+	for _, stat := range stats {
+		for _, ins := range stat.InstanceStats {
+			if ins.Status == Running {
+				running[stat.Name]++
+			}
+		}
+	}
+	res := map[string]int{}
+	for _, app := range apps {
+		if shortfall := app.Replicas - running[app.Name]; app.Replicas > 0 && shortfall > 0 {
+			res[app.Name] = shortfall
 		}
-		res = append(res, AppInfo{Name: aim["name"].(string), Version: aim["version"].(string)})
 	}
 	return res
 }
 
+// getAppStats returns nil if the stats are absent, null or not a list,
+// otherwise a non-nil slice, the malformed entries are skipped
 func getAppStats(statsType string, data map[string]interface{}) []AppStats {
 	if data == nil {
 		return nil
@@ -528,54 +3859,277 @@ func getAppStats(statsType string, data map[string]interface{}) []AppStats {
 		return nil
 	}
 	if res, ok := apps.([]AppStats); ok {
+		if res == nil {
+			return []AppStats{}
+		}
 		return res
-	} else {
+	}
+	items, ok := apps.([]interface{})
+	if !ok {
 		return nil
 	}
+	res := []AppStats{}
+	for _, item := range items {
+		if _, ok := item.(map[string]interface{}); !ok {
+			continue
+		}
+		data, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		var stat AppStats
+		if err = json.Unmarshal(data, &stat); err != nil {
+			log.L().Warn("failed to parse app stats", log.Any("type", statsType), log.Error(err))
+			continue
+		}
+		res = append(res, stat)
+	}
+	return res
+}
+
+// JSONDepth returns the max nesting depth of objects in the document, the document
+// itself is at depth 1 and each nested object adds a level as counted by Merge which
+// fails with ErrJSONLevelExceedsLimit at maxJSONLevel. Arrays do not add a level,
+// but the objects in arrays are counted
+func JSONDepth(m map[string]interface{}) int {
+	if m == nil {
+		return 0
+	}
+	return jsonDepth(reflect.ValueOf(m))
+}
+
+func jsonDepth(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return 0
+		}
+		return jsonDepth(v.Elem())
+	case reflect.Map:
+		max := 0
+		for _, k := range v.MapKeys() {
+			if d := jsonDepth(v.MapIndex(k)); d > max {
+				max = d
+			}
+		}
+		return max + 1
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return 0
+		}
+		max := 0
+		for i := 0; i < v.Len(); i++ {
+			if d := jsonDepth(v.Index(i)); d > max {
+				max = d
+			}
+		}
+		return max
+	case reflect.Struct:
+		// structs such as time.Time may marshal to scalars, so count their json instead
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return 0
+		}
+		var doc interface{}
+		if err = json.Unmarshal(data, &doc); err != nil {
+			return 0
+		}
+		return jsonDepth(reflect.ValueOf(doc))
+	}
+	return 0
 }
 
 // merge right map into left map
 func merge(left, right map[string]interface{}, depth, maxDepth int) error {
-	if depth >= maxDepth {
-		return ErrJSONLevelExceedsLimit
+	return mergeWithHandler(left, right, depth, maxDepth, "", nil)
+}
+
+// ConflictHandler resolves the conflict of merge where the existing and incoming values
+// of the dot-separated key path are of different kinds, the returned value is merged
+type ConflictHandler func(key string, existing, incoming interface{}) interface{}
+
+// mergeWithHandler merges right into left like merge, and resolves the conflicts by handler
+// if not nil, prefix is the key path of left. Left is at level depth, and the merge fails
+// without modifying left once the objects merged into each other reach the level maxDepth
+func mergeWithHandler(left, right map[string]interface{}, depth, maxDepth int, prefix string, handler ConflictHandler) error {
+	if depth-1+sharedDepth(left, right) >= maxDepth {
+		return malformed(errJSONLevelExceedsLimit(maxDepth))
+	}
+	mergeInto(left, right, prefix, handler)
+	return nil
+}
+
+// sharedDepth returns the depth of the objects of right to be merged into the objects of left
+func sharedDepth(left, right map[string]interface{}) int {
+	max := 0
+	for rk, rv := range right {
+		lm, lok := left[rk].(map[string]interface{})
+		rm, rok := rv.(map[string]interface{})
+		if !lok || !rok {
+			continue
+		}
+		if d := sharedDepth(lm, rm); d > max {
+			max = d
+		}
 	}
+	return max + 1
+}
+
+func mergeInto(left, right map[string]interface{}, prefix string, handler ConflictHandler) {
 	for rk, rv := range right {
 		lv, ok := left[rk]
-		if !ok || lv == nil || rv == nil || reflect.TypeOf(rv).Kind() != reflect.Map || reflect.TypeOf(lv).Kind() != reflect.Map {
-			left[rk] = rv
+		if handler != nil && ok && lv != nil && rv != nil && reflect.TypeOf(rv).Kind() != reflect.TypeOf(lv).Kind() {
+			left[rk] = handler(prefix+rk, lv, rv)
 			continue
 		}
-		if err := merge(lv.(map[string]interface{}), rv.(map[string]interface{}), depth+1, maxDepth); err != nil {
-			return errors.Trace(err)
+		lm, lok := lv.(map[string]interface{})
+		rm, rok := rv.(map[string]interface{})
+		if !lok || !rok {
+			left[rk] = rv
+			continue
 		}
+		mergeInto(lm, rm, prefix+rk+".", handler)
 	}
-	return nil
 }
 
-func diff(desired, reported map[string]interface{}, cleanNil bool) (map[string]interface{}, error) {
+// diff returns the delta from reported to desired, the depth of documents is not
+// limited if maxDepth is not positive
+func diff(desired, reported map[string]interface{}, cleanNil bool, maxDepth int) (map[string]interface{}, error) {
 	var delta map[string]interface{}
+	if err := (&mergeOptions{maxDepth: maxDepth}).checkDepth(desired, reported); err != nil {
+		return delta, errors.Trace(err)
+	}
 	r, err := json.Marshal(reported)
 	if err != nil {
-		return delta, errors.Trace(err)
+		return delta, malformed(err)
 	}
 	d, err := json.Marshal(desired)
 	if err != nil {
-		return delta, errors.Trace(err)
+		return delta, malformed(err)
 	}
 	patch, err := jsonpatch.CreateMergePatch(r, d)
 	if err != nil {
-		return delta, errors.Trace(err)
+		return delta, malformed(err)
 	}
 	err = json.Unmarshal(patch, &delta)
 	if err != nil {
-		return delta, errors.Trace(err)
+		return delta, internal(err)
+	}
+	if cleanNil {
+		clean(delta)
+	}
+	delete(delta, KeySectionSources)
+	return delta, nil
+}
+
+func diffPrecise(desired, reported map[string]interface{}, cleanNil bool) (map[string]interface{}, error) {
+	var r, d map[string]interface{}
+	if err := normalizeWithNumber(reported, &r); err != nil {
+		return nil, malformed(err)
 	}
+	if err := normalizeWithNumber(desired, &d); err != nil {
+		return nil, malformed(err)
+	}
+	delta := createMergePatch(r, d)
 	if cleanNil {
 		clean(delta)
 	}
+	delete(delta, KeySectionSources)
 	return delta, nil
 }
 
+// normalizeWithNumber converts the typed values of doc into generic json values
+func normalizeWithNumber(doc map[string]interface{}, v *map[string]interface{}) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = unmarshalWithNumber(data, v); err != nil {
+		return errors.Trace(err)
+	}
+	if *v == nil {
+		*v = map[string]interface{}{}
+	}
+	return nil
+}
+
+// unorderedKeys the keys whose list values are compared regardless of order,
+// with the function to get the key which elements are sorted by
+var unorderedKeys = map[string]func(interface{}) string{
+	KeyApps:    elementName,
+	KeySysApps: elementName,
+	KeyDevices: elementName,
+}
+
+func elementName(elem interface{}) string {
+	m, _ := elem.(map[string]interface{})
+	name, _ := m["name"].(string)
+	return name
+}
+
+// equalUnordered checks whether two lists hold the same elements regardless of order
+func equalUnordered(a, b []interface{}, keyFunc func(interface{}) string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa, sb := sortedElements(a, keyFunc), sortedElements(b, keyFunc)
+	return reflect.DeepEqual(sa, sb)
+}
+
+func sortedElements(list []interface{}, keyFunc func(interface{}) string) []interface{} {
+	type element struct {
+		key string
+		raw string
+		val interface{}
+	}
+	elems := make([]element, 0, len(list))
+	for _, v := range list {
+		raw, _ := json.Marshal(v)
+		elems = append(elems, element{key: keyFunc(v), raw: string(raw), val: v})
+	}
+	sort.Slice(elems, func(i, j int) bool {
+		if elems[i].key != elems[j].key {
+			return elems[i].key < elems[j].key
+		}
+		return elems[i].raw < elems[j].raw
+	})
+	res := make([]interface{}, 0, len(elems))
+	for _, e := range elems {
+		res = append(res, e.val)
+	}
+	return res
+}
+
+// createMergePatch returns the merge patch which converts original into modified,
+// both of them must consist of generic json values
+func createMergePatch(original, modified map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, mv := range modified {
+		ov, ok := original[k]
+		if !ok {
+			res[k] = mv
+			continue
+		}
+		om, ook := ov.(map[string]interface{})
+		mm, mok := mv.(map[string]interface{})
+		if ook && mok {
+			if sub := createMergePatch(om, mm); len(sub) > 0 {
+				res[k] = sub
+			}
+			continue
+		}
+		if !reflect.DeepEqual(ov, mv) {
+			res[k] = mv
+		}
+	}
+	for k := range original {
+		if _, ok := modified[k]; !ok {
+			res[k] = nil
+		}
+	}
+	return res
+}
+
 func clean(m map[string]interface{}) {
 	for k, v := range m {
 		if v == nil {
@@ -0,0 +1,88 @@
+package v1
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+)
+
+// compressedMagic the two-byte header of gzip member, a json document never starts with it,
+// so decoders can tell a compressed payload from plain json
+var compressedMagic = []byte{0x1f, 0x8b}
+
+// MarshalCompressed returns the json of report compressed by gzip
+func (r Report) MarshalCompressed() ([]byte, error) {
+	return marshalCompressed(r)
+}
+
+// UnmarshalCompressed decodes the report from data, which is either compressed or plain json
+func (r *Report) UnmarshalCompressed(data []byte) error {
+	return unmarshalCompressed(data, r)
+}
+
+// MarshalCompressed returns the json of desire compressed by gzip
+func (d Desire) MarshalCompressed() ([]byte, error) {
+	return marshalCompressed(d)
+}
+
+// UnmarshalCompressed decodes the desire from data, which is either compressed or plain json
+func (d *Desire) UnmarshalCompressed(data []byte) error {
+	return unmarshalCompressed(data, d)
+}
+
+// IsCompressed checks whether data starts with the magic header of compressed payload
+func IsCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, compressedMagic)
+}
+
+// CompressedSize returns the compressed and uncompressed byte counts of data, the uncompressed
+// one is read from the gzip trailer without decompression, plain json returns its length for both
+func CompressedSize(data []byte) (compressed, uncompressed int, err error) {
+	if !IsCompressed(data) {
+		return len(data), len(data), nil
+	}
+	// header 10 bytes and trailer 8 bytes (crc32 and isize) at least
+	if len(data) < 18 {
+		return 0, 0, malformed(gzip.ErrHeader)
+	}
+	return len(data), int(binary.LittleEndian.Uint32(data[len(data)-4:])), nil
+}
+
+func marshalCompressed(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if err != nil {
+		return nil, internal(err)
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, internal(err)
+	}
+	if err = w.Close(); err != nil {
+		return nil, internal(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalCompressed(data []byte, v interface{}) error {
+	if IsCompressed(data) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return malformed(err)
+		}
+		defer r.Close()
+		data, err = ioutil.ReadAll(r)
+		if err != nil {
+			return malformed(err)
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return malformed(err)
+	}
+	return nil
+}
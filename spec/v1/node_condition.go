@@ -0,0 +1,124 @@
+package v1
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConditionStatus the status of condition
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// the types of the standard conditions populated by the view of node
+const (
+	ConditionReady              = "Ready"
+	ConditionMemoryPressure     = "MemoryPressure"
+	ConditionDiskPressure       = "DiskPressure"
+	ConditionNetworkUnavailable = "NetworkUnavailable"
+)
+
+// Condition the named condition of node like the node conditions of kubernetes
+type Condition struct {
+	Type               string          `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	Status             ConditionStatus `json:"status,omitempty" yaml:"status,omitempty" toml:"status,omitempty"`
+	LastTransitionTime time.Time       `json:"lastTransitionTime,omitempty" yaml:"lastTransitionTime,omitempty" toml:"lastTransitionTime,omitempty"`
+	Reason             string          `json:"reason,omitempty" yaml:"reason,omitempty" toml:"reason,omitempty"`
+	Message            string          `json:"message,omitempty" yaml:"message,omitempty" toml:"message,omitempty"`
+}
+
+// SetCondition adds the condition or updates the condition of the same type, the last
+// transition time is kept if the status is not changed, otherwise it is set to the one
+// of c, or now if not set
+func (n *Node) SetCondition(c Condition) {
+	n.Conditions = setCondition(n.Conditions, c, time.Now().UTC())
+}
+
+// GetCondition returns the condition of the type
+func (n *Node) GetCondition(condType string) (Condition, bool) {
+	return getCondition(n.Conditions, condType)
+}
+
+// GetCondition returns the condition of the type
+func (view *NodeView) GetCondition(condType string) (Condition, bool) {
+	return getCondition(view.Conditions, condType)
+}
+
+func setCondition(conds []Condition, c Condition, now time.Time) []Condition {
+	for i := range conds {
+		if conds[i].Type != c.Type {
+			continue
+		}
+		if conds[i].Status == c.Status {
+			c.LastTransitionTime = conds[i].LastTransitionTime
+		} else if c.LastTransitionTime.IsZero() {
+			c.LastTransitionTime = now
+		}
+		conds[i] = c
+		return conds
+	}
+	if c.LastTransitionTime.IsZero() {
+		c.LastTransitionTime = now
+	}
+	return append(conds, c)
+}
+
+func getCondition(conds []Condition, condType string) (Condition, bool) {
+	for _, c := range conds {
+		if c.Type == condType {
+			return c, true
+		}
+	}
+	return Condition{}, false
+}
+
+// populateConditions upserts the standard conditions by the readiness and the pressures of
+// node stats, a pressure condition is True if any node of cluster is under the pressure, and
+// Unknown if no node stats is reported. The transitions are timed by observed, which is the
+// time of report, so that the views of the same node are the same
+func (view *NodeView) populateConditions(observed time.Time) {
+	ready := Condition{Type: ConditionReady, Status: ConditionFalse, Reason: "NodeNotReady", Message: "the node does not report within the timeout"}
+	if view.Ready {
+		ready = Condition{Type: ConditionReady, Status: ConditionTrue, Reason: "NodeReady"}
+	}
+	view.Conditions = setCondition(view.Conditions, ready, observed)
+
+	var stats map[string]*NodeStats
+	if view.Report != nil {
+		stats = view.Report.NodeStats
+	}
+	pressures := []struct {
+		condType string
+		reason   string
+		under    func(s *NodeStats) bool
+	}{
+		{ConditionMemoryPressure, "Memory", func(s *NodeStats) bool { return s.MemoryPressure }},
+		{ConditionDiskPressure, "Disk", func(s *NodeStats) bool { return s.DiskPressure }},
+		{ConditionNetworkUnavailable, "Network", func(s *NodeStats) bool { return s.NetworkUnavailable }},
+	}
+	for _, p := range pressures {
+		c := Condition{Type: p.condType, Status: ConditionUnknown, Reason: "NodeStatsUnknown"}
+		if len(stats) > 0 {
+			var names []string
+			for name, s := range stats {
+				if s != nil && p.under(s) {
+					names = append(names, name)
+				}
+			}
+			c = Condition{Type: p.condType, Status: ConditionFalse, Reason: "NodeHasSufficient" + p.reason}
+			if p.condType == ConditionNetworkUnavailable {
+				c.Reason = "NodeNetworkAvailable"
+			}
+			if len(names) > 0 {
+				sort.Strings(names)
+				c = Condition{Type: p.condType, Status: ConditionTrue, Reason: "Node" + p.condType, Message: strings.Join(names, ",")}
+			}
+		}
+		view.Conditions = setCondition(view.Conditions, c, observed)
+	}
+}
@@ -0,0 +1,60 @@
+package v1
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// ErrNodeCordoned the node is cordoned, the new desire is not applied to it
+var ErrNodeCordoned = fmt.Errorf("the node is cordoned")
+
+// Cordon cordons the node and records the cordon time, the cordon time of a node
+// cordoned already is kept, so the drain deadline is not postponed
+func (n *Node) Cordon() {
+	if n.Cordoned && n.CordonTimestamp != nil {
+		return
+	}
+	now := time.Now().UTC()
+	n.Cordoned = true
+	n.CordonTimestamp = &now
+}
+
+// Uncordon uncordons the node and clears the cordon time
+func (n *Node) Uncordon() {
+	n.Cordoned = false
+	n.CordonTimestamp = nil
+}
+
+// drainDeadline returns the cordon time plus the drain timeout, nil if the node
+// is not cordoned or the drain timeout is not set
+func (n *Node) drainDeadline() *time.Time {
+	if !n.Cordoned || n.CordonTimestamp == nil || n.DrainTimeout <= 0 {
+		return nil
+	}
+	deadline := n.CordonTimestamp.Add(n.DrainTimeout)
+	return &deadline
+}
+
+// WithCordonCheck makes Desire.Patch, PatchPrecise, PatchValidated and PatchKeyedApps fail
+// with ErrNodeCordoned if the node is cordoned, the patches without it are not guarded
+func WithCordonCheck(n *Node) MergeOption {
+	return func(o *mergeOptions) {
+		o.cordoned = n != nil && n.Cordoned
+	}
+}
+
+// ApplyIfNotCordoned applies the desire to the current report by the delta of Diff and returns
+// the new report, ErrNodeCordoned is returned if the node is cordoned. Current is not modified
+func (d Desire) ApplyIfNotCordoned(n *Node, current Report) (Report, error) {
+	if n != nil && n.Cordoned {
+		return nil, errors.Trace(ErrNodeCordoned)
+	}
+	delta, err := d.Diff(current)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	res, err := current.Patch(Delta(delta))
+	return res, errors.Trace(err)
+}
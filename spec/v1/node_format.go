@@ -0,0 +1,210 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// The formats registered by default
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+type format struct {
+	marshal   func(interface{}) ([]byte, error)
+	unmarshal func([]byte, interface{}) error
+}
+
+// formats the registry of serialization formats used by Node.Marshal and Node.Unmarshal
+var formats = struct {
+	sync.RWMutex
+	formats map[string]format
+}{formats: map[string]format{}}
+
+func init() {
+	RegisterFormat(FormatJSON, json.Marshal, json.Unmarshal)
+	RegisterFormat(FormatYAML, yaml.Marshal, yaml.Unmarshal)
+	RegisterFormat(FormatTOML, marshalTOML, toml.Unmarshal)
+}
+
+// RegisterFormat registers the serialization format by name, which replaces the one
+// registered for the same name, such as cbor or msgpack
+func RegisterFormat(name string, marshal func(interface{}) ([]byte, error), unmarshal func([]byte, interface{}) error) {
+	formats.Lock()
+	defer formats.Unlock()
+	formats.formats[name] = format{marshal: marshal, unmarshal: unmarshal}
+}
+
+func lookupFormat(name string) (format, error) {
+	formats.RLock()
+	defer formats.RUnlock()
+	f, ok := formats.formats[name]
+	if !ok {
+		return format{}, malformed(errors.Errorf("format (%s) is not registered", name))
+	}
+	return f, nil
+}
+
+// Marshal marshals the node in the format registered by RegisterFormat
+func (n *Node) Marshal(format string) ([]byte, error) {
+	f, err := lookupFormat(format)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data, err := f.marshal(n)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	return data, nil
+}
+
+// Unmarshal unmarshals the node from data in the format registered by RegisterFormat,
+// the report, desire and attributes are normalized as decoded from json, that is maps
+// are keyed by string, lists are []interface{}, numbers are float64 and times are RFC3339 strings
+func (n *Node) Unmarshal(data []byte, format string) error {
+	f, err := lookupFormat(format)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var res Node
+	if err = f.unmarshal(data, &res); err != nil {
+		return malformed(err)
+	}
+	res.Attributes = normalizeMap(res.Attributes)
+	res.Report = normalizeMap(res.Report)
+	res.Desire = normalizeMap(res.Desire)
+	*n = res
+	return nil
+}
+
+// marshalTOML encodes v in toml by the toml tags of the types. Since toml can represent
+// neither null nor arrays of mixed types, the null values in maps and lists return an error
+// rather than being dropped, and so do the arrays of mixed types
+func marshalTOML(v interface{}) ([]byte, error) {
+	if err := checkTOMLNull(reflect.ValueOf(v), ""); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkTOMLNull returns an error if any value of the maps or any element of the lists in v is
+// null, path is the dot-separated key path of v. The nil fields of structs are left to the
+// encoder, which omits them as they decode back to nil
+func checkTOMLNull(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return checkTOMLNull(v.Elem(), path)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Name
+			if tag := strings.Split(f.Tag.Get("toml"), ",")[0]; tag != "" {
+				name = tag
+			}
+			if err := checkTOMLNull(v.Field(i), joinTOMLPath(path, name)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if err := checkTOMLNullElem(v.MapIndex(k), joinTOMLPath(path, fmt.Sprint(k.Interface()))); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := checkTOMLNullElem(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkTOMLNullElem(v reflect.Value, path string) error {
+	if (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) && v.IsNil() {
+		return errors.Errorf("toml can not represent the null value of (%s)", path)
+	}
+	return checkTOMLNull(v, path)
+}
+
+func joinTOMLPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func normalizeMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = normalizeValue(v)
+	}
+	return res
+}
+
+// normalizeValue converts the value decoded from yaml, toml and so on to the one decoded from json
+func normalizeValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return normalizeMap(t)
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			key, ok := k.(string)
+			if !ok {
+				data, _ := json.Marshal(k)
+				key = string(bytes.Trim(data, `"`))
+			}
+			res[key] = normalizeValue(val)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, val := range t {
+			res[i] = normalizeValue(val)
+		}
+		return res
+	case []map[string]interface{}:
+		res := make([]interface{}, len(t))
+		for i, val := range t {
+			res[i] = normalizeMap(val)
+		}
+		return res
+	case int:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case uint64:
+		return float64(t)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,314 @@
+package v1
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/inf.v0"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// ErrInsufficientSamples there are less than two samples at different times to fit the trend
+var ErrInsufficientSamples = fmt.Errorf("insufficient samples to fit the trend")
+
+// ErrNegativeTrend the usage is not growing, so the resource will not be exhausted
+var ErrNegativeTrend = fmt.Errorf("the trend of usage is not positive")
+
+// ErrDesireHistoryOutOfRange the desire snapshot to roll back to is not in history
+var ErrDesireHistoryOutOfRange = fmt.Errorf("the desire snapshot is out of the range of history")
+
+// NodeStatsHistory the fixed-size ring buffer of node stats samples for resource usage history,
+// the oldest sample is overwritten when the buffer is full, it is created by NewNodeStatsHistory
+type NodeStatsHistory struct {
+	mu      sync.RWMutex
+	samples []nodeStatsSample
+	next    int
+	size    int
+	now     func() time.Time
+}
+
+type nodeStatsSample struct {
+	time  time.Time
+	stats *NodeStats
+}
+
+// NewNodeStatsHistory creates the history which keeps capacity samples at most, at least one
+func NewNodeStatsHistory(capacity int) *NodeStatsHistory {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &NodeStatsHistory{samples: make([]nodeStatsSample, capacity), now: time.Now}
+}
+
+// Record records a deep copy of the node stats, the sample is timed by s.Time if set, otherwise by now
+func (h *NodeStatsHistory) Record(s *NodeStats) {
+	if s == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t := h.now()
+	if s.Time != nil {
+		t = *s.Time
+	}
+	h.samples[h.next] = nodeStatsSample{time: t, stats: s.DeepCopy()}
+	h.next = (h.next + 1) % len(h.samples)
+	if h.size < len(h.samples) {
+		h.size++
+	}
+}
+
+// Len returns the number of samples recorded in the buffer
+func (h *NodeStatsHistory) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.size
+}
+
+// Window returns the copies of samples recorded within the last d, from the oldest to the latest
+func (h *NodeStatsHistory) Window(d time.Duration) []NodeStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var res []NodeStats
+	for _, sample := range h.window(d) {
+		res = append(res, *sample.stats.DeepCopy())
+	}
+	return res
+}
+
+// Average returns the element-wise average of the usage of samples recorded within the last d,
+// the other fields are copied from the latest sample, nil is returned if there is no sample.
+// See Peak for how usages in different units are handled
+func (h *NodeStatsHistory) Average(d time.Duration) *NodeStats {
+	return h.aggregate(d, func(vals []*inf.Dec) *inf.Dec {
+		sum := new(inf.Dec)
+		for _, v := range vals {
+			sum.Add(sum, v)
+		}
+		return sum.QuoRound(sum, inf.NewDec(int64(len(vals)), 0), milliScale, inf.RoundDown)
+	})
+}
+
+// Peak returns the element-wise maximum of the usage of samples recorded within the last d,
+// the other fields are copied from the latest sample, nil is returned if there is no sample.
+// The usages are normalized to the smallest unit found, which is milli if any usage or the
+// result has a fractional part, otherwise the base unit such as cores or bytes. Unparsable
+// usages are skipped
+func (h *NodeStatsHistory) Peak(d time.Duration) *NodeStats {
+	return h.aggregate(d, func(vals []*inf.Dec) *inf.Dec {
+		max := vals[0]
+		for _, v := range vals[1:] {
+			if v.Cmp(max) > 0 {
+				max = v
+			}
+		}
+		return max
+	})
+}
+
+// milliScale the scale of decimals in milli units
+const milliScale = 3
+
+// aggregate aggregates the usages of samples by fn, the usages are rounded up to milli units
+// like resource.Quantity.MilliValue, but kept as decimals so large quantities do not overflow
+func (h *NodeStatsHistory) aggregate(d time.Duration, fn func([]*inf.Dec) *inf.Dec) *NodeStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	samples := h.window(d)
+	if len(samples) == 0 {
+		return nil
+	}
+	vals := map[string][]*inf.Dec{}
+	milli := map[string]bool{}
+	for _, sample := range samples {
+		for k, v := range sample.stats.Usage {
+			q, err := resource.ParseQuantity(v)
+			if err != nil {
+				continue
+			}
+			val := new(inf.Dec).Round(q.AsDec(), milliScale, inf.RoundUp)
+			vals[k] = append(vals[k], val)
+			if !isWholeDec(val) || strings.HasSuffix(v, "m") {
+				milli[k] = true
+			}
+		}
+	}
+	res := samples[len(samples)-1].stats.DeepCopy()
+	res.Usage = map[string]string{}
+	for k, v := range vals {
+		val := fn(v)
+		if milli[k] || !isWholeDec(val) {
+			res.Usage[k] = new(inf.Dec).Round(new(inf.Dec).Mul(val, inf.NewDec(milliPrecision, 0)), 0, inf.RoundDown).String() + "m"
+		} else {
+			res.Usage[k] = new(inf.Dec).Round(val, 0, inf.RoundDown).String()
+		}
+	}
+	return res
+}
+
+func isWholeDec(d *inf.Dec) bool {
+	return new(inf.Dec).Round(d, 0, inf.RoundDown).Cmp(d) == 0
+}
+
+// Trend fits the linear regression of the usage of resource over the samples recorded within
+// the last window, and returns the slope in units per second, cores for cpu and bytes for memory.
+// ErrInsufficientSamples is returned if less than two samples at different times report the usage
+func (h *NodeStatsHistory) Trend(resource string, window time.Duration) (float64, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return trend(h.window(window), resource)
+}
+
+// TimeToExhaustion estimates the duration until the usage of resource reaches the capacity of the
+// latest sample by the trend over all samples, zero if the usage reaches the capacity already.
+// ErrNegativeTrend is returned if the usage is not growing
+func (h *NodeStatsHistory) TimeToExhaustion(resource string) (time.Duration, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	slope, err := trend(h.all(), resource)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if slope <= 0 {
+		return 0, errors.Trace(ErrNegativeTrend)
+	}
+	latest := h.samples[(h.next-1+len(h.samples))%len(h.samples)].stats
+	capacity, ok := latest.Capacity[resource]
+	if !ok {
+		return 0, errors.Errorf("the capacity of resource (%s) is not reported", resource)
+	}
+	total, err := translateQuantityToDecimal(capacity, true)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	used, err := translateQuantityToDecimal(latest.Usage[resource], true)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	remaining := float64(total-used) / milliPrecision
+	if remaining <= 0 {
+		return 0, nil
+	}
+	secs := remaining / slope
+	if secs >= float64(math.MaxInt64)/float64(time.Second) {
+		return time.Duration(math.MaxInt64), nil
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// trend fits the linear regression of the usage of resource over the samples
+func trend(samples []nodeStatsSample, resource string) (float64, error) {
+	var xs, ys []float64
+	var origin time.Time
+	for _, sample := range samples {
+		usage, ok := sample.stats.Usage[resource]
+		if !ok {
+			continue
+		}
+		val, err := translateQuantityToDecimal(usage, true)
+		if err != nil {
+			continue
+		}
+		if len(xs) == 0 {
+			origin = sample.time
+		}
+		xs = append(xs, sample.time.Sub(origin).Seconds())
+		ys = append(ys, float64(val)/milliPrecision)
+	}
+	if len(xs) < 2 {
+		return 0, errors.Trace(ErrInsufficientSamples)
+	}
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	n := float64(len(xs))
+	meanX, meanY = meanX/n, meanY/n
+	var cov, variance float64
+	for i := range xs {
+		cov += (xs[i] - meanX) * (ys[i] - meanY)
+		variance += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	if variance == 0 {
+		return 0, errors.Trace(ErrInsufficientSamples)
+	}
+	return cov / variance, nil
+}
+
+// all returns all samples recorded, from the oldest to the latest
+func (h *NodeStatsHistory) all() []nodeStatsSample {
+	res := make([]nodeStatsSample, 0, h.size)
+	for i := 0; i < h.size; i++ {
+		res = append(res, h.samples[(h.next-h.size+i+len(h.samples))%len(h.samples)])
+	}
+	return res
+}
+
+// window returns the samples recorded within the last d, from the oldest to the latest
+func (h *NodeStatsHistory) window(d time.Duration) []nodeStatsSample {
+	since := h.now().Add(-d)
+	var res []nodeStatsSample
+	for _, sample := range h.all() {
+		if !sample.time.Before(since) {
+			res = append(res, sample)
+		}
+	}
+	return res
+}
+
+// DesireHistory the snapshots of desire ordered by the time pushed, the oldest snapshot
+// is evicted when the history is full, it is created by NewDesireHistory
+type DesireHistory struct {
+	mu        sync.RWMutex
+	snapshots []Desire
+	max       int
+}
+
+// NewDesireHistory creates the history which keeps max snapshots at most, at least one
+func NewDesireHistory(max int) *DesireHistory {
+	if max < 1 {
+		max = 1
+	}
+	return &DesireHistory{max: max}
+}
+
+// Push pushes a deep copy of the desire as the most recent snapshot
+func (h *DesireHistory) Push(d Desire) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.snapshots) >= h.max {
+		h.snapshots = append(h.snapshots[:0], h.snapshots[len(h.snapshots)-h.max+1:]...)
+	}
+	h.snapshots = append(h.snapshots, d.DeepCopy())
+}
+
+// Rollback returns a deep copy of the nth most recent snapshot, 1 for the most recent one,
+// ErrDesireHistoryOutOfRange is returned if there are less than n snapshots
+func (h *DesireHistory) Rollback(n int) (Desire, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if n < 1 || n > len(h.snapshots) {
+		return nil, errors.Trace(ErrDesireHistoryOutOfRange)
+	}
+	return h.snapshots[len(h.snapshots)-n].DeepCopy(), nil
+}
+
+// Len returns the number of snapshots in history
+func (h *DesireHistory) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.snapshots)
+}
+
+// Clear removes all snapshots
+func (h *DesireHistory) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshots = nil
+}
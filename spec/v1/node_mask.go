@@ -0,0 +1,98 @@
+package v1
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Redacted the value which replaces the masked values
+const Redacted = "[REDACTED]"
+
+// MaskPolicy the dot-separated key paths of report to mask, such as "node.hostname",
+// a segment of "*" matches any key of objects, and a path goes through the elements
+// of lists, such as "apps.name" which masks the names of all apps
+type MaskPolicy []string
+
+// DefaultMaskPolicy the common sensitive keys at the top level and the second level
+var DefaultMaskPolicy = MaskPolicy{
+	"token", "password", "secret",
+	"*.token", "*.password", "*.secret",
+}
+
+// Mask returns a deep copy of the report with the values at the key paths replaced
+// by Redacted, the paths which are missing are skipped, see MaskPolicy for the paths.
+// The typed values walked through by the paths are converted into generic json values
+func (r Report) Mask(sensitiveKeys []string) Report {
+	res := r.DeepCopy()
+	if res == nil {
+		return nil
+	}
+	for _, path := range sensitiveKeys {
+		if path == "" {
+			continue
+		}
+		maskPath(res, strings.Split(path, "."))
+	}
+	return res
+}
+
+// MarshalMasked masks the report by policy and marshals it to json
+func MarshalMasked(r Report, policy MaskPolicy) ([]byte, error) {
+	data, err := json.Marshal(r.Mask(policy))
+	if err != nil {
+		return nil, malformed(err)
+	}
+	return data, nil
+}
+
+func maskPath(m map[string]interface{}, path []string) {
+	keys := []string{path[0]}
+	if path[0] == "*" {
+		keys = keys[:0]
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		v, ok := m[k]
+		if !ok {
+			continue
+		}
+		if len(path) == 1 {
+			m[k] = Redacted
+			continue
+		}
+		if m[k] = genericValue(v); m[k] != nil {
+			maskValue(m[k], path[1:])
+		}
+	}
+}
+
+func maskValue(v interface{}, path []string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		maskPath(t, path)
+	case []interface{}:
+		for _, e := range t {
+			maskValue(e, path)
+		}
+	}
+}
+
+// genericValue converts the typed value into generic json value to walk through,
+// the value which can not be converted is returned as it is
+func genericValue(v interface{}) interface{} {
+	switch v.(type) {
+	case nil, map[string]interface{}, []interface{}, string, bool, float64, json.Number:
+		return v
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var res interface{}
+	if err = unmarshalWithNumber(data, &res); err != nil {
+		return v
+	}
+	return res
+}
@@ -0,0 +1,201 @@
+package v1
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+	protov1 "github.com/baetyl/baetyl-go/v2/proto/v1"
+)
+
+// MarshalProto marshals the node in protobuf, the report, desire and attributes
+// are encoded as google.protobuf.Struct, which keeps the same values as json, except
+// that an empty map is kept empty rather than dropped
+func (n *Node) MarshalProto() ([]byte, error) {
+	attributes, err := toProtoStruct(n.Attributes)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	report, err := toProtoStruct(n.Report)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	desire, err := toProtoStruct(n.Desire)
+	if err != nil {
+		return nil, malformed(err)
+	}
+	pn := &protov1.Node{
+		Namespace:     n.Namespace,
+		Name:          n.Name,
+		Version:       n.Version,
+		CreateTime:    n.CreationTimestamp,
+		Accelerator:   n.Accelerator,
+		Mode:          string(n.Mode),
+		Cluster:       n.Cluster,
+		Labels:        n.Labels,
+		Annotations:   n.Annotations,
+		Attributes:    attributes,
+		Report:        report,
+		Desire:        desire,
+		SysApps:       n.SysApps,
+		Description:   n.Description,
+		SchemaVersion: n.SchemaVersion,
+		Cordoned:      n.Cordoned,
+		CordonTime:    n.CordonTimestamp,
+		DrainTimeout:  int64(n.DrainTimeout),
+	}
+	for _, c := range n.Conditions {
+		pn.Conditions = append(pn.Conditions, protov1.Condition{
+			Type:               c.Type,
+			Status:             string(c.Status),
+			LastTransitionTime: c.LastTransitionTime,
+			Reason:             c.Reason,
+			Message:            c.Message,
+		})
+	}
+	data, err := pn.Marshal()
+	if err != nil {
+		return nil, internal(err)
+	}
+	return data, nil
+}
+
+// UnmarshalProto unmarshals the node from protobuf marshaled by MarshalProto,
+// the numbers of report, desire and attributes are decoded as float64 like json
+func (n *Node) UnmarshalProto(data []byte) error {
+	var pn protov1.Node
+	if err := pn.Unmarshal(data); err != nil {
+		return malformed(err)
+	}
+	*n = Node{
+		Namespace:         pn.Namespace,
+		Name:              pn.Name,
+		Version:           pn.Version,
+		CreationTimestamp: pn.CreateTime,
+		Accelerator:       pn.Accelerator,
+		Mode:              SyncMode(pn.Mode),
+		Cluster:           pn.Cluster,
+		Labels:            pn.Labels,
+		Annotations:       pn.Annotations,
+		Attributes:        fromProtoStruct(pn.Attributes),
+		Report:            fromProtoStruct(pn.Report),
+		Desire:            fromProtoStruct(pn.Desire),
+		SysApps:           pn.SysApps,
+		Description:       pn.Description,
+		SchemaVersion:     pn.SchemaVersion,
+		Cordoned:          pn.Cordoned,
+		CordonTimestamp:   pn.CordonTime,
+		DrainTimeout:      time.Duration(pn.DrainTimeout),
+	}
+	for _, c := range pn.Conditions {
+		n.Conditions = append(n.Conditions, Condition{
+			Type:               c.Type,
+			Status:             ConditionStatus(c.Status),
+			LastTransitionTime: c.LastTransitionTime,
+			Reason:             c.Reason,
+			Message:            c.Message,
+		})
+	}
+	return nil
+}
+
+// toProtoStruct converts the typed values of m into generic json values,
+// then into google.protobuf.Struct, nil is returned for a nil map
+func toProtoStruct(m map[string]interface{}) (*types.Struct, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var doc map[string]interface{}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return protoStruct(doc)
+}
+
+func protoStruct(m map[string]interface{}) (*types.Struct, error) {
+	res := &types.Struct{Fields: make(map[string]*types.Value, len(m))}
+	for k, v := range m {
+		pv, err := protoValue(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		res.Fields[k] = pv
+	}
+	return res, nil
+}
+
+func protoValue(v interface{}) (*types.Value, error) {
+	switch t := v.(type) {
+	case nil:
+		return &types.Value{Kind: &types.Value_NullValue{}}, nil
+	case bool:
+		return &types.Value{Kind: &types.Value_BoolValue{BoolValue: t}}, nil
+	case float64:
+		return &types.Value{Kind: &types.Value_NumberValue{NumberValue: t}}, nil
+	case string:
+		return &types.Value{Kind: &types.Value_StringValue{StringValue: t}}, nil
+	case []interface{}:
+		list := &types.ListValue{Values: make([]*types.Value, 0, len(t))}
+		for _, e := range t {
+			pv, err := protoValue(e)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			list.Values = append(list.Values, pv)
+		}
+		return &types.Value{Kind: &types.Value_ListValue{ListValue: list}}, nil
+	case map[string]interface{}:
+		s, err := protoStruct(t)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return &types.Value{Kind: &types.Value_StructValue{StructValue: s}}, nil
+	}
+	return nil, errors.Errorf("the value of type (%T) is not a json value", v)
+}
+
+// fromProtoStruct converts google.protobuf.Struct into generic json values
+func fromProtoStruct(s *types.Struct) map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+	res := make(map[string]interface{}, len(s.Fields))
+	for k, v := range s.Fields {
+		res[k] = fromProtoValue(v)
+	}
+	return res
+}
+
+func fromProtoValue(v *types.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch t := v.Kind.(type) {
+	case *types.Value_BoolValue:
+		return t.BoolValue
+	case *types.Value_NumberValue:
+		return t.NumberValue
+	case *types.Value_StringValue:
+		return t.StringValue
+	case *types.Value_ListValue:
+		res := []interface{}{}
+		if t.ListValue != nil {
+			for _, e := range t.ListValue.Values {
+				res = append(res, fromProtoValue(e))
+			}
+		}
+		return res
+	case *types.Value_StructValue:
+		if t.StructValue == nil {
+			return map[string]interface{}{}
+		}
+		return fromProtoStruct(t.StructValue)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package v1
+
+import (
+	// embed the default schema of desire
+	_ "embed"
+	"encoding/json"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// defaultDesireSchema the default json schema of desire, which covers the documented keys
+//
+//go:embed schema/desire.schema.json
+var defaultDesireSchema []byte
+
+// ValidationErrors the violations found when validating against a json schema,
+// it unwraps to all violations like errors.Join
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the violations
+func (e ValidationErrors) Unwrap() []error {
+	return e
+}
+
+// Validate validates the desire against the json schema, the embedded default schema is used
+// if schema is nil. All violations are returned as ValidationErrors, which is malformed input
+func (d Desire) Validate(schema []byte) error {
+	if schema == nil {
+		schema = defaultDesireSchema
+	}
+	// the desire is validated as json, so the typed values such as []AppInfo are validated as they are sent
+	doc, err := json.Marshal(d)
+	if err != nil {
+		return malformed(err)
+	}
+	res, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewBytesLoader(doc))
+	if err != nil {
+		return malformed(err)
+	}
+	if res.Valid() {
+		return nil
+	}
+	var errs ValidationErrors
+	for _, desc := range res.Errors() {
+		errs = append(errs, errors.New(desc.String()))
+	}
+	return malformed(errs)
+}
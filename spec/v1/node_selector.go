@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// Selector the equality-based label selector, which requires each label to equal its value,
+// the empty selector matches all labels
+type Selector map[string]string
+
+// ParseSelector parses the selector from the comma-separated expression of key=value,
+// such as "env=prod,region=north", the empty expression returns the empty selector
+func ParseSelector(s string) (Selector, error) {
+	sel := Selector{}
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, term := range strings.Split(s, ",") {
+		parts := strings.SplitN(term, "=", 2)
+		if len(parts) != 2 {
+			return nil, malformed(errors.Errorf("invalid selector term (%s), expected key=value", term))
+		}
+		k, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if k == "" {
+			return nil, malformed(errors.Errorf("invalid selector term (%s), the key is empty", term))
+		}
+		if old, ok := sel[k]; ok && old != v {
+			return nil, malformed(errors.Errorf("conflicting values (%s, %s) of selector key (%s)", old, v, k))
+		}
+		sel[k] = v
+	}
+	return sel, nil
+}
+
+// Matches checks whether the labels satisfy all requirements of selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for k, v := range s {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the expression of selector with keys sorted, which is parsed by ParseSelector
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s))
+	for k, v := range s {
+		terms = append(terms, k+"="+v)
+	}
+	sort.Strings(terms)
+	return strings.Join(terms, ",")
+}
+
+// FilterNodes returns the nodes whose labels match the selector in the original order,
+// nil nodes are skipped
+func FilterNodes(nodes []*Node, sel Selector) []*Node {
+	var res []*Node
+	for _, n := range nodes {
+		if n != nil && sel.Matches(n.Labels) {
+			res = append(res, n)
+		}
+	}
+	return res
+}
@@ -0,0 +1,211 @@
+package v1
+
+import (
+	"sync"
+)
+
+// SyncReport the report guarded by a read-write lock for concurrent access,
+// the zero value is an empty report ready to use
+type SyncReport struct {
+	mu sync.RWMutex
+	r  Report
+}
+
+// NewSyncReport creates a guarded report with a deep copy of r
+func NewSyncReport(r Report) *SyncReport {
+	return &SyncReport{r: r.DeepCopy()}
+}
+
+// Unwrap returns a deep copy of the guarded report
+func (s *SyncReport) Unwrap() Report {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.r.DeepCopy()
+}
+
+// Merge merge a deep copy of new reported data, so reported is not shared with the guarded report
+func (s *SyncReport) Merge(reported Report, opts ...MergeOption) error {
+	reported = reported.DeepCopy()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.r == nil {
+		s.r = Report{}
+	}
+	return s.r.Merge(reported, opts...)
+}
+
+// Patch patch report with delta, get the new report, the guarded report is left untouched
+func (s *SyncReport) Patch(delta Delta, opts ...MergeOption) (Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.r.Patch(delta, opts...)
+}
+
+// AppInfos returns a copy of the app infos of the report
+func (s *SyncReport) AppInfos(isSys bool) []AppInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyAppInfos(s.r.AppInfos(isSys))
+}
+
+// SetAppInfos sets a copy of apps into the report
+func (s *SyncReport) SetAppInfos(isSys bool, apps []AppInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.r == nil {
+		s.r = Report{}
+	}
+	s.r.SetAppInfos(isSys, copyAppInfos(apps))
+}
+
+// AppStats returns a copy of the app stats of the report
+func (s *SyncReport) AppStats(isSys bool) []AppStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyAppStats(s.r.AppStats(isSys))
+}
+
+// SetAppStats sets a copy of stats into the report
+func (s *SyncReport) SetAppStats(isSys bool, stats []AppStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.r == nil {
+		s.r = Report{}
+	}
+	s.r.SetAppStats(isSys, copyAppStats(stats))
+}
+
+// DeviceInfos returns a copy of the device infos of the report
+func (s *SyncReport) DeviceInfos() []DeviceInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyDeviceInfos(s.r.DeviceInfos())
+}
+
+// SetDeviceInfos sets a copy of devs into the report
+func (s *SyncReport) SetDeviceInfos(devs []DeviceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.r == nil {
+		s.r = Report{}
+	}
+	s.r.SetDeviceInfos(copyDeviceInfos(devs))
+}
+
+// SyncDesire the desire guarded by a read-write lock for concurrent access,
+// the zero value is an empty desire ready to use
+type SyncDesire struct {
+	mu sync.RWMutex
+	d  Desire
+}
+
+// NewSyncDesire creates a guarded desire with a deep copy of d
+func NewSyncDesire(d Desire) *SyncDesire {
+	return &SyncDesire{d: d.DeepCopy()}
+}
+
+// Unwrap returns a deep copy of the guarded desire
+func (s *SyncDesire) Unwrap() Desire {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.d.DeepCopy()
+}
+
+// Merge merge a deep copy of new desired data, so desired is not shared with the guarded desire
+func (s *SyncDesire) Merge(desired Desire, opts ...MergeOption) error {
+	desired = desired.DeepCopy()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.d == nil {
+		s.d = Desire{}
+	}
+	return s.d.Merge(desired, opts...)
+}
+
+// Diff diff with reported data, return the delta for desire
+func (s *SyncDesire) Diff(reported Report, opts ...MergeOption) (Desire, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.d.Diff(reported, opts...)
+}
+
+// DiffWithNil diff with reported data, return the delta for desire
+// and do not clean nil in delta
+func (s *SyncDesire) DiffWithNil(report Report, opts ...MergeOption) (Delta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.d.DiffWithNil(report, opts...)
+}
+
+// Patch patch desire with delta, get the new desire, the guarded desire is left untouched
+func (s *SyncDesire) Patch(delta Delta, opts ...MergeOption) (Desire, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.d.Patch(delta, opts...)
+}
+
+// AppInfos returns a copy of the app infos of the desire
+func (s *SyncDesire) AppInfos(isSys bool) []AppInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyAppInfos(s.d.AppInfos(isSys))
+}
+
+// SetAppInfos sets a copy of apps into the desire
+func (s *SyncDesire) SetAppInfos(isSys bool, apps []AppInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.d == nil {
+		s.d = Desire{}
+	}
+	s.d.SetAppInfos(isSys, copyAppInfos(apps))
+}
+
+// AppStats returns a copy of the app stats of the desire
+func (s *SyncDesire) AppStats(isSys bool) []AppStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyAppStats(s.d.AppStats(isSys))
+}
+
+// SetAppStats sets a copy of stats into the desire
+func (s *SyncDesire) SetAppStats(isSys bool, stats []AppStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.d == nil {
+		s.d = Desire{}
+	}
+	s.d.SetAppStats(isSys, copyAppStats(stats))
+}
+
+// DeviceInfos returns a copy of the device infos of the desire
+func (s *SyncDesire) DeviceInfos() []DeviceInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyDeviceInfos(s.d.DeviceInfos())
+}
+
+// SetDeviceInfos sets a copy of devs into the desire
+func (s *SyncDesire) SetDeviceInfos(devs []DeviceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.d == nil {
+		s.d = Desire{}
+	}
+	s.d.SetDeviceInfos(copyDeviceInfos(devs))
+}
+
+func copyAppInfos(apps []AppInfo) []AppInfo {
+	res, _ := deepCopyValue(apps).([]AppInfo)
+	return res
+}
+
+func copyAppStats(stats []AppStats) []AppStats {
+	res, _ := deepCopyValue(stats).([]AppStats)
+	return res
+}
+
+func copyDeviceInfos(devs []DeviceInfo) []DeviceInfo {
+	res, _ := deepCopyValue(devs).([]DeviceInfo)
+	return res
+}
@@ -1,9 +1,15 @@
 package v1
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -88,6 +94,10 @@ func TestShadowDiff(t *testing.T) {
 			assert.Equal(t, tt.wantErr, err)
 			assert.Equal(t, tt.wantDelta, gotDelta)
 			assert.Equal(t, tt.desire.AppInfos(false), tt.desire.AppInfos(false), gotDelta.AppInfos(false))
+
+			segmented, err := tt.desire.DiffSegmented(tt.report)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, Delta(tt.wantDelta), segmented)
 		})
 	}
 }
@@ -361,7 +371,7 @@ func TestTranslateNodeToNodeReportView(t *testing.T) {
 	err := json.Unmarshal([]byte(nodeData), node)
 	assert.NoError(t, err)
 
-	view, err := node.View(time.Minute)
+	view, err := node.View(WithReadyTimeout(time.Minute))
 	assert.NoError(t, err)
 	assert.NotNil(t, view)
 	assert.Equal(t, view.Namespace, "default")
@@ -515,7 +525,7 @@ func TestTranslateNodeToNodeReportViewRunning(t *testing.T) {
 	err := json.Unmarshal([]byte(nodeData), node)
 	assert.NoError(t, err)
 
-	view, err := node.View(time.Second * 20)
+	view, err := node.View(WithReadyTimeout(time.Second * 20))
 	assert.NoError(t, err)
 	assert.NotNil(t, view)
 	assert.True(t, view.Cluster)
@@ -566,7 +576,7 @@ func TestPopulateNodeStats(t *testing.T) {
 			Time: &t1,
 		},
 	}
-	err := node1.populateNodeStats(time.Minute)
+	err := node1.populateNodeStats(&NodeViewOptions{Timeout: time.Minute})
 	assert.NoError(t, err)
 	m1, err1 := translateQuantityToDecimal("1024Mi", false)
 	assert.NoError(t, err1)
@@ -600,7 +610,7 @@ func TestPopulateNodeStats(t *testing.T) {
 			Time: &t2,
 		},
 	}
-	err = node2.populateNodeStats(time.Minute)
+	err = node2.populateNodeStats(&NodeViewOptions{Timeout: time.Minute})
 	assert.NoError(t, err)
 	assert.Equal(t, node2.Report.NodeStats["master"].Capacity[string(coreV1.ResourceMemory)], s1)
 	assert.Equal(t, node2.Report.NodeStats["master"].Capacity[string(coreV1.ResourceCPU)], "2")
@@ -627,7 +637,7 @@ func TestPopulateNodeStats(t *testing.T) {
 		},
 	}
 
-	err = node3.populateNodeStats(time.Minute)
+	err = node3.populateNodeStats(&NodeViewOptions{Timeout: time.Minute})
 	assert.NoError(t, err)
 	assert.Equal(t, node3.Report.NodeStats["master"].Capacity[string(coreV1.ResourceCPU)], "2")
 	assert.Equal(t, node3.Report.NodeStats["master"].Usage[string(coreV1.ResourceCPU)], "0.5")
@@ -652,7 +662,7 @@ func TestPopulateNodeStats(t *testing.T) {
 		},
 	}
 
-	err = node4.populateNodeStats(time.Minute)
+	err = node4.populateNodeStats(&NodeViewOptions{Timeout: time.Minute})
 	assert.Error(t, err)
 
 	node5 := NodeView{
@@ -672,7 +682,7 @@ func TestPopulateNodeStats(t *testing.T) {
 		},
 	}
 
-	err = node5.populateNodeStats(time.Minute)
+	err = node5.populateNodeStats(&NodeViewOptions{Timeout: time.Minute})
 	assert.Error(t, err)
 
 	node6 := NodeView{
@@ -691,7 +701,7 @@ func TestPopulateNodeStats(t *testing.T) {
 			},
 		},
 	}
-	err = node6.populateNodeStats(time.Minute)
+	err = node6.populateNodeStats(&NodeViewOptions{Timeout: time.Minute})
 	assert.NoError(t, err)
 	assert.Equal(t, node6.Report.NodeStats["master"].Capacity[string(coreV1.ResourceCPU)], "0")
 	assert.Equal(t, node6.Report.NodeStats["master"].Usage[string(coreV1.ResourceCPU)], "0")
@@ -790,14 +800,12 @@ func TestShadowPatch(t *testing.T) {
 			desire:     nil,
 			delta:      nil,
 			wantDesire: nil,
-			wantErr:    errors.New("Invalid JSON Patch"),
 		},
 		{
 			name:       "nil-delta",
-			desire:     Desire{},
+			desire:     Desire{"name": "module"},
 			delta:      nil,
-			wantDesire: nil,
-			wantErr:    errors.New("Invalid JSON Patch"),
+			wantDesire: Desire{"name": "module"},
 		},
 		{
 			name:       "0",
@@ -980,7 +988,7 @@ func TestCompatibleSingleNode(t *testing.T) {
 	err := json.Unmarshal([]byte(nodeData), node)
 	assert.NoError(t, err)
 
-	view, err := node.View(time.Second * 20)
+	view, err := node.View(WithReadyTimeout(time.Second * 20))
 	assert.NoError(t, err)
 	assert.NotNil(t, view)
 	assert.Equal(t, view.Namespace, "default")
@@ -1008,3 +1016,3875 @@ func TestCompatibleSingleNode(t *testing.T) {
 	assert.Equal(t, view.Report.SysAppStats[1].Status, Status("Running"))
 	assert.Equal(t, view.Report.AppStats[0].Status, Status("Running"))
 }
+
+func TestNodeViewNodeLabels(t *testing.T) {
+	node := &Node{
+		Name:   "baetyl",
+		Labels: map[string]string{"zone": "east", "baetyl-node-name": "baetyl"},
+		Report: Report{
+			"node": map[string]interface{}{
+				"master": map[string]interface{}{
+					"hostname": "master",
+					"labels":   map[string]interface{}{"zone": "west", "gpu": "true"},
+				},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"zone": "west", "gpu": "true"}, view.Report.Node["master"].Labels)
+
+	expected := map[string]string{"zone": "east", "gpu": "true", "baetyl-node-name": "baetyl"}
+	assert.Equal(t, expected, view.NodeLabels("master"))
+	assert.Equal(t, node.Labels, view.NodeLabels("unknown"))
+	assert.Equal(t, map[string]string{}, (&NodeView{}).NodeLabels("master"))
+}
+
+func TestCoalesceDeltas(t *testing.T) {
+	deltas := []Delta{
+		{"version": "1", "module": map[string]interface{}{"image": "test:v1", "port": "23"}},
+		{"version": nil, "module": map[string]interface{}{"port": nil, "env": "dev"}},
+		{"version": "3", "apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}}},
+	}
+	res, err := CoalesceDeltas(deltas)
+	assert.NoError(t, err)
+	assert.Equal(t, Delta{
+		"version": "3",
+		"module":  map[string]interface{}{"image": "test:v1", "port": nil, "env": "dev"},
+		"apps":    []interface{}{map[string]interface{}{"name": "a", "version": "1"}},
+	}, res)
+	// the input deltas are untouched
+	assert.Equal(t, map[string]interface{}{"image": "test:v1", "port": "23"}, deltas[0]["module"])
+
+	desire := Desire{"version": "0", "name": "module", "module": map[string]interface{}{"image": "test:v0", "port": "22"}}
+	expected := desire
+	for _, d := range deltas {
+		expected, err = expected.Patch(d)
+		assert.NoError(t, err)
+	}
+	got, err := desire.Patch(res)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, got)
+
+	res, err = CoalesceDeltas(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Delta{}, res)
+
+	_, err = CoalesceDeltas([]Delta{{"module": nil}, {"module": map[string]interface{}{"image": "test:v2"}}})
+	assert.EqualError(t, err, ErrDeltaNotCoalescable.Error())
+}
+
+func TestNodeViewAcceleratorUsage(t *testing.T) {
+	node := &Node{
+		Name:        "baetyl",
+		Accelerator: NVAccelerator,
+		Report: Report{
+			"nodestats": map[string]interface{}{
+				"worker": map[string]interface{}{
+					"usage":     map[string]interface{}{"cpu": "1", "memory": "512Mi"},
+					"capacity":  map[string]interface{}{"cpu": "2", "memory": "1024Mi"},
+					"extension": map[string]interface{}{KeyGPUUsedMemory: 0, KeyGPUTotalMemory: 4096, KeyGPUPercent: 0},
+				},
+				"master": map[string]interface{}{
+					"usage":     map[string]interface{}{"cpu": "1", "memory": "512Mi"},
+					"capacity":  map[string]interface{}{"cpu": "2", "memory": "1024Mi"},
+					"extension": map[string]interface{}{KeyGPUUsedMemory: 1024, KeyGPUTotalMemory: 4096, KeyGPUPercent: 0.25},
+				},
+				"edge": map[string]interface{}{
+					"usage":    map[string]interface{}{"cpu": "1", "memory": "512Mi"},
+					"capacity": map[string]interface{}{"cpu": "2", "memory": "1024Mi"},
+				},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []AcceleratorUsage{
+		{NodeName: "master", Resource: ResourceGPU, Total: 4096, Used: 1024, Percent: 0.25, InUse: true},
+		{NodeName: "worker", Resource: ResourceGPU, Total: 4096, Used: 0, Percent: 0, InUse: false},
+	}, view.AcceleratorUsage())
+	assert.Nil(t, (&NodeView{}).AcceleratorUsage())
+}
+
+func TestDesireAppsPendingDeletion(t *testing.T) {
+	desire := Desire{
+		"apps": []AppInfo{
+			{Name: "a", Version: "1"},
+			{Name: "b", Version: "1", Deleting: true},
+		},
+		"sysapps": []interface{}{
+			map[string]interface{}{"name": "c", "version": "2", "deleting": true},
+		},
+	}
+	assert.Equal(t, []AppInfo{{Name: "b", Version: "1", Deleting: true}, {Name: "c", Version: "2", Deleting: true}}, desire.AppsPendingDeletion())
+	assert.Nil(t, Desire{}.AppsPendingDeletion())
+
+	report := Report{"apps": []interface{}{
+		map[string]interface{}{"name": "a", "version": "1"},
+		map[string]interface{}{"name": "b", "version": "1"},
+	}}
+	delta, err := desire.Diff(report)
+	assert.NoError(t, err)
+	assert.Equal(t, []AppInfo{{Name: "a", Version: "1"}, {Name: "b", Version: "1", Deleting: true}}, delta.AppInfos(false))
+
+	patched, err := Desire{}.Patch(Delta(delta))
+	assert.NoError(t, err)
+	assert.Equal(t, []AppInfo{{Name: "b", Version: "1", Deleting: true}, {Name: "c", Version: "2", Deleting: true}}, patched.AppsPendingDeletion())
+}
+
+func TestNodeOutOfSyncApps(t *testing.T) {
+	node := &Node{
+		Desire: Desire{
+			"apps":    []AppInfo{{Name: "a", Version: "2"}, {Name: "b", Version: "1"}, {Name: "c", Version: "1"}},
+			"sysapps": []AppInfo{{Name: "core", Version: "3"}},
+		},
+		Report: Report{
+			"apps": []interface{}{
+				map[string]interface{}{"name": "a", "version": "1"},
+				map[string]interface{}{"name": "b", "version": "1"},
+			},
+			"sysapps": []interface{}{
+				map[string]interface{}{"name": "core", "version": "3"},
+			},
+		},
+	}
+	assert.Equal(t, []AppInfo{{Name: "a", Version: "2"}, {Name: "c", Version: "1"}}, node.OutOfSyncApps())
+
+	node.Desire.SetAppInfos(true, []AppInfo{{Name: "core", Version: "4"}})
+	assert.Equal(t, []AppInfo{{Name: "a", Version: "2"}, {Name: "c", Version: "1"}, {Name: "core", Version: "4"}}, node.OutOfSyncApps())
+	assert.Nil(t, (&Node{}).OutOfSyncApps())
+}
+
+func TestShadowDiffPrecise(t *testing.T) {
+	var large int64 = 1<<53 + 1
+	desire := Desire{"name": "module", "stats": map[string]interface{}{"bytes": large, "count": 1}}
+	report := Report{"name": "module", "stats": map[string]interface{}{"bytes": 1, "count": 1}, "old": "1"}
+
+	delta, err := desire.Diff(report)
+	assert.NoError(t, err)
+	assert.NotEqual(t, strconv.FormatInt(large, 10), strconv.FormatFloat(delta["stats"].(map[string]interface{})["bytes"].(float64), 'f', -1, 64))
+
+	delta, err = desire.DiffPrecise(report)
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{"stats": map[string]interface{}{"bytes": json.Number("9007199254740993")}}, delta)
+
+	deltaWithNil, err := diffPrecise(desire, report, false)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"stats": map[string]interface{}{"bytes": json.Number("9007199254740993")}, "old": nil}, deltaWithNil)
+
+	delta, err = desire.DiffPrecise(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{"name": "module", "stats": map[string]interface{}{"bytes": json.Number("9007199254740993"), "count": json.Number("1")}}, delta)
+
+	patched, err := Report{"stats": map[string]interface{}{"bytes": 1}}.PatchPrecise(Delta{"stats": map[string]interface{}{"bytes": large}})
+	assert.NoError(t, err)
+	assert.Equal(t, Report{"stats": map[string]interface{}{"bytes": json.Number("9007199254740993")}}, patched)
+
+	patchedDesire, err := Desire{"stats": map[string]interface{}{"bytes": 1}}.PatchPrecise(Delta(delta))
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{"name": "module", "stats": map[string]interface{}{"bytes": json.Number("9007199254740993"), "count": json.Number("1")}}, patchedDesire)
+}
+
+func TestInstanceStatsUsageVsLimit(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"appstats": []interface{}{
+				map[string]interface{}{
+					"name": "timer",
+					"instances": map[string]interface{}{
+						"timer": map[string]interface{}{
+							"name":  "timer",
+							"usage": map[string]interface{}{"cpu": "250m", "memory": "256Mi", "disk": "1Gi"},
+							"limit": map[string]interface{}{"cpu": "1", "memory": "1Gi"},
+						},
+					},
+				},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	ins := view.Report.AppStats[0].InstanceStats["timer"]
+	assert.Equal(t, map[string]string{"cpu": "1", "memory": "1073741824"}, ins.Limit)
+	assert.Equal(t, map[string]string{"cpu": "0.25", "memory": "0.25"}, ins.UsageVsLimit())
+
+	ins = InstanceStats{
+		Usage: map[string]string{"cpu": "0.5", "memory": "512Mi"},
+		Limit: map[string]string{"cpu": "0", "gpu": "1"},
+	}
+	assert.Equal(t, map[string]string{}, ins.UsageVsLimit())
+	assert.Equal(t, map[string]string{}, (&InstanceStats{}).UsageVsLimit())
+}
+
+func TestReportTelemetryView(t *testing.T) {
+	r := Report{
+		"apps": []AppInfo{{Name: "a", Version: "1"}},
+		"node": map[string]*NodeInfo{
+			"master": {Hostname: "master", Address: "192.168.1.2", MachineID: "m1", SystemUUID: "u1", Arch: "amd64"},
+		},
+		"nodestats": map[string]*NodeStats{
+			"master": {Usage: map[string]string{"cpu": "1"}},
+		},
+		"appstats":  []AppStats{{AppInfo: AppInfo{Name: "a", Version: "1"}, Status: Running}},
+		"nodeprops": map[string]interface{}{"token": "xxx"},
+	}
+	tv, err := r.TelemetryView()
+	assert.NoError(t, err)
+	assert.Equal(t, Report{
+		"node": map[string]interface{}{
+			"master": map[string]interface{}{"hostname": "master", "arch": "amd64", "bootID": "", "containerRuntime": "", "osImage": ""},
+		},
+		"nodestats": map[string]interface{}{
+			"master": map[string]interface{}{"usage": map[string]interface{}{"cpu": "1"}},
+		},
+		"appstats": []interface{}{map[string]interface{}{"name": "a", "version": "1", "status": "Running"}},
+	}, tv)
+	assert.Equal(t, "192.168.1.2", r["node"].(map[string]*NodeInfo)["master"].Address)
+	assert.Equal(t, "m1", r["node"].(map[string]*NodeInfo)["master"].MachineID)
+
+	single := Report{"node": map[string]interface{}{"hostname": "master", "address": "192.168.1.2", "machineID": "m1"}}
+	tv, err = single.TelemetryView()
+	assert.NoError(t, err)
+	assert.Equal(t, Report{"node": map[string]interface{}{"hostname": "master"}}, tv)
+	assert.Equal(t, "m1", single["node"].(map[string]interface{})["machineID"])
+
+	labelled := Report{"node": map[string]interface{}{
+		"hostname": "master", "address": "10.0.0.1", "machineID": "m1", "labels": map[string]interface{}{"zone": "a"},
+	}}
+	tv, err = labelled.TelemetryView()
+	assert.NoError(t, err)
+	assert.Equal(t, Report{"node": map[string]interface{}{"hostname": "master", "labels": map[string]interface{}{"zone": "a"}}}, tv)
+
+	tv, err = Report{}.TelemetryView()
+	assert.NoError(t, err)
+	assert.Equal(t, Report{}, tv)
+}
+
+func TestShadowDiffIgnoreOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		desire    Desire
+		report    Report
+		wantDelta Desire
+	}{
+		{
+			name:      "reordered",
+			desire:    Desire{"apps": []AppInfo{{Name: "a", Version: "1"}, {Name: "b", Version: "1"}}, "devices": []DeviceInfo{{Name: "d1"}, {Name: "d2"}}},
+			report:    Report{"apps": []interface{}{map[string]interface{}{"name": "b", "version": "1"}, map[string]interface{}{"name": "a", "version": "1"}}, "devices": []DeviceInfo{{Name: "d2"}, {Name: "d1"}}},
+			wantDelta: Desire{},
+		},
+		{
+			name:      "version-changed",
+			desire:    Desire{"sysapps": []AppInfo{{Name: "a", Version: "1"}, {Name: "b", Version: "2"}}},
+			report:    Report{"sysapps": []AppInfo{{Name: "b", Version: "1"}, {Name: "a", Version: "1"}}},
+			wantDelta: Desire{"sysapps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}, map[string]interface{}{"name": "b", "version": "2"}}},
+		},
+		{
+			name:      "app-missing",
+			desire:    Desire{"apps": []AppInfo{{Name: "a", Version: "1"}, {Name: "b", Version: "1"}}},
+			report:    Report{"apps": []AppInfo{{Name: "a", Version: "1"}}},
+			wantDelta: Desire{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}, map[string]interface{}{"name": "b", "version": "1"}}},
+		},
+		{
+			name:      "other-list",
+			desire:    Desire{"list": []interface{}{"a", "b"}},
+			report:    Report{"list": []interface{}{"b", "a"}},
+			wantDelta: Desire{"list": []interface{}{"a", "b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDelta, err := tt.desire.DiffIgnoreOrder(tt.report)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantDelta, gotDelta)
+		})
+	}
+
+	// numbers are float64 as returned by Diff
+	desire := Desire{"apps": []AppInfo{{Name: "a", Version: "1"}}, "replicas": 2, "rate": 0.5}
+	report := Report{"apps": []AppInfo{{Name: "a", Version: "1"}}, "replicas": 1}
+	want, err := desire.Diff(report)
+	assert.NoError(t, err)
+	got, err := desire.DiffIgnoreOrder(report)
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{"replicas": float64(2), "rate": 0.5}, got)
+	assert.Equal(t, want, got)
+}
+
+func TestInstanceStatsHasLogs(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"appstats": []AppStats{{
+				AppInfo: AppInfo{Name: "timer"},
+				InstanceStats: map[string]InstanceStats{
+					"timer-1": {Name: "timer-1", LogRef: &LogRef{Backend: "loki", Query: `{app="timer"}`}},
+					"timer-2": {Name: "timer-2"},
+				},
+			}},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	ins := view.Report.AppStats[0].InstanceStats["timer-1"]
+	assert.True(t, ins.HasLogs())
+	assert.Equal(t, &LogRef{Backend: "loki", Query: `{app="timer"}`}, ins.LogRef)
+	ins = view.Report.AppStats[0].InstanceStats["timer-2"]
+	assert.False(t, ins.HasLogs())
+	assert.False(t, (&InstanceStats{LogRef: &LogRef{}}).HasLogs())
+}
+
+func TestViewKeepsNodeUnchanged(t *testing.T) {
+	nodeData := `
+{
+	"name": "baetyl",
+	"report": {
+		"node": {
+			"hostname": "master",
+			"arch": "amd64"
+		},
+		"nodestats": {
+			"usage": {
+				"cpu": "336037951n",
+				"memory": "1206552Ki"
+			},
+			"capacity": {
+				"cpu": "2",
+				"memory": "4033160Ki"
+			}
+		}
+	}
+}
+`
+	node := new(Node)
+	assert.NoError(t, json.Unmarshal([]byte(nodeData), node))
+	expected := new(Node)
+	assert.NoError(t, json.Unmarshal([]byte(nodeData), expected))
+
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "master", view.Report.Node["master"].Role)
+	assert.Equal(t, "0.1685", view.Report.NodeStats["master"].Percent["cpu"])
+	assert.Equal(t, expected, node)
+
+	view2, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, view, view2)
+	assert.Equal(t, expected, node)
+}
+
+func TestReportViewFailedInstances(t *testing.T) {
+	view := &ReportView{
+		AppStats: []AppStats{{
+			AppInfo: AppInfo{Name: "timer"},
+			InstanceStats: map[string]InstanceStats{
+				"timer-b": {Name: "timer-b", Status: Failed, NodeName: "worker", Cause: "CrashLoopBackOff"},
+				"timer-a": {Name: "timer-a", Status: Failed, NodeName: "master", Cause: "ImagePullBackOff"},
+				"timer-c": {Name: "timer-c", Status: Running, NodeName: "master"},
+			},
+		}},
+		SysAppStats: []AppStats{{
+			AppInfo: AppInfo{Name: "core"},
+			InstanceStats: map[string]InstanceStats{
+				"core-1": {Name: "core-1", Status: Failed, NodeName: "master", Cause: "OOMKilled"},
+			},
+		}},
+	}
+	assert.Equal(t, []FailedInstance{
+		{AppName: "timer", InstanceName: "timer-a", NodeName: "master", Cause: "ImagePullBackOff"},
+		{AppName: "timer", InstanceName: "timer-b", NodeName: "worker", Cause: "CrashLoopBackOff"},
+		{AppName: "core", InstanceName: "core-1", NodeName: "master", Cause: "OOMKilled"},
+	}, view.FailedInstances())
+	assert.Nil(t, (&ReportView{}).FailedInstances())
+}
+
+func TestReportMergeWithSizeLimit(t *testing.T) {
+	r := Report{"name": "module", "module": map[string]interface{}{"image": "test:v1"}}
+	err := r.MergeWithSizeLimit(Report{"module": map[string]interface{}{"image": "test:v2", "port": "80"}}, 1024)
+	assert.NoError(t, err)
+	assert.Equal(t, Report{"name": "module", "module": map[string]interface{}{"image": "test:v2", "port": "80"}}, r)
+
+	err = r.MergeWithSizeLimit(Report{"module": map[string]interface{}{"image": "test:v3", "data": string(make([]byte, 1024))}}, 1024)
+	assert.EqualError(t, err, ErrSizeExceedsLimit.Error())
+	assert.Equal(t, Report{"name": "module", "module": map[string]interface{}{"image": "test:v2", "port": "80"}}, r)
+
+	old := Report{"1": map[string]interface{}{"2": map[string]interface{}{"3": map[string]interface{}{"4": map[string]interface{}{"5": map[string]interface{}{"6": "y"}}}}}}
+	deep := Report{"1": map[string]interface{}{"2": map[string]interface{}{"3": map[string]interface{}{"4": map[string]interface{}{"5": map[string]interface{}{"6": "x"}}, "a": "b"}}}}
+	err = old.MergeWithSizeLimit(deep, 1024)
+	assert.EqualError(t, err, ErrJSONLevelExceedsLimit.Error())
+	assert.Equal(t, Report{"1": map[string]interface{}{"2": map[string]interface{}{"3": map[string]interface{}{"4": map[string]interface{}{"5": map[string]interface{}{"6": "y"}}}}}}, old)
+}
+
+func TestNodeStatsGPUCapacity(t *testing.T) {
+	s := &NodeStats{
+		Capacity:  map[string]string{ResourceGPU: "8589934592"},
+		Extension: map[string]interface{}{KeyGPUCount: float64(2), KeyGPUTotalMemory: float64(8589934592)},
+	}
+	count, mem, ok := s.GPUCapacity()
+	assert.True(t, ok)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, int64(8589934592), mem)
+
+	s = &NodeStats{Extension: map[string]interface{}{KeyGPUTotalMemory: float64(4096)}}
+	count, mem, ok = s.GPUCapacity()
+	assert.True(t, ok)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, int64(4096), mem)
+
+	s = &NodeStats{Capacity: map[string]string{ResourceGPU: "x"}}
+	_, _, ok = s.GPUCapacity()
+	assert.False(t, ok)
+
+	_, _, ok = (&NodeStats{Capacity: map[string]string{"cpu": "1"}}).GPUCapacity()
+	assert.False(t, ok)
+}
+
+func TestDesireNormalize(t *testing.T) {
+	d1 := Desire{
+		"apps":      []AppInfo{{Name: "b", Version: "1"}, {Name: "a", Version: "1"}},
+		"nodeprops": map[string]interface{}{},
+		"module":    map[string]interface{}{"replica": 1, "env": map[string]interface{}{"empty": map[string]interface{}{}}},
+	}
+	d2 := Desire{
+		"apps":   []interface{}{map[string]interface{}{"name": "a", "version": "1"}, map[string]interface{}{"name": "b", "version": "1"}},
+		"module": map[string]interface{}{"replica": float64(1)},
+	}
+	n1, err := d1.Normalize()
+	assert.NoError(t, err)
+	n2, err := d2.Normalize()
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{
+		"apps":   []interface{}{map[string]interface{}{"name": "a", "version": "1"}, map[string]interface{}{"name": "b", "version": "1"}},
+		"module": map[string]interface{}{"replica": float64(1)},
+	}, n1)
+	assert.Equal(t, n1, n2)
+
+	delta, err := n1.Diff(Report(n2))
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{}, delta)
+	assert.Len(t, d1["nodeprops"], 0)
+	assert.Equal(t, []AppInfo{{Name: "b", Version: "1"}, {Name: "a", Version: "1"}}, d1["apps"])
+}
+
+func TestReportViewTotals(t *testing.T) {
+	view := &ReportView{
+		Apps:    []AppInfo{{Name: "a"}, {Name: "b"}},
+		SysApps: []AppInfo{{Name: "core"}},
+		AppStats: []AppStats{
+			{AppInfo: AppInfo{Name: "a"}, InstanceStats: map[string]InstanceStats{"a-1": {NodeName: "master"}, "a-2": {NodeName: "worker"}}},
+			{AppInfo: AppInfo{Name: "b"}, InstanceStats: map[string]InstanceStats{"b-1": {NodeName: "master"}}},
+		},
+		SysAppStats: []AppStats{
+			{AppInfo: AppInfo{Name: "core"}, InstanceStats: map[string]InstanceStats{"core-1": {NodeName: "master"}}},
+		},
+	}
+	view.countInstanceNum()
+	assert.Equal(t, map[string]int{"master": 3, "worker": 1}, view.NodeInsNum)
+	assert.Equal(t, 4, view.TotalInstances())
+	assert.Equal(t, 2, view.TotalApps())
+	assert.Equal(t, 1, view.TotalSysApps())
+
+	empty := &ReportView{}
+	assert.Equal(t, 0, empty.TotalInstances())
+	assert.Equal(t, 0, empty.TotalApps())
+	assert.Equal(t, 0, empty.TotalSysApps())
+}
+
+func TestServiceInfoWasOOMKilled(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"appstats": []interface{}{
+				map[string]interface{}{
+					"name": "timer",
+					"instances": map[string]interface{}{
+						"timer": map[string]interface{}{
+							"name": "timer",
+							"container": map[string]interface{}{
+								"name": "timer",
+								"id":   "docker://3e468a0a55f0",
+								"exit": map[string]interface{}{"exitCode": 137, "signal": 9, "reason": "OOMKilled", "oomKilled": true},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	svc := view.Report.AppStats[0].InstanceStats["timer"].Container
+	assert.Equal(t, &ServiceInfo{
+		Name:     "timer",
+		ID:       "docker://3e468a0a55f0",
+		ExitInfo: &ExitInfo{ExitCode: 137, Signal: 9, Reason: "OOMKilled", OOMKilled: true},
+	}, svc)
+	assert.True(t, svc.WasOOMKilled())
+	assert.False(t, (&ServiceInfo{ExitInfo: &ExitInfo{ExitCode: 1}}).WasOOMKilled())
+	assert.False(t, (&ServiceInfo{}).WasOOMKilled())
+
+	var nilSvc *ServiceInfo
+	assert.False(t, nilSvc.WasOOMKilled())
+}
+
+func TestDesireMergePreserving(t *testing.T) {
+	d := Desire{
+		"apps":     []AppInfo{{Name: "a", Version: "1"}},
+		"defaults": map[string]interface{}{"log": "info"},
+		"sysapps":  []AppInfo{{Name: "core", Version: "1"}},
+	}
+	err := d.MergePreserving(Desire{
+		"apps":     []AppInfo{{Name: "a", Version: "2"}},
+		"defaults": map[string]interface{}{"log": "debug"},
+		"sysapps":  nil,
+		"extra":    "1",
+	}, []string{"defaults", "sysapps", "extra", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{
+		"apps":     []AppInfo{{Name: "a", Version: "2"}},
+		"defaults": map[string]interface{}{"log": "info"},
+		"sysapps":  []AppInfo{{Name: "core", Version: "1"}},
+		"extra":    "1",
+	}, d)
+
+	err = d.MergePreserving(Desire{"defaults": nil}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, d["defaults"])
+}
+
+func TestViewNegativeResourceUsage(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"appstats": []AppStats{{
+				AppInfo: AppInfo{Name: "timer"},
+				InstanceStats: map[string]InstanceStats{
+					"timer": {Name: "timer", Usage: map[string]string{"cpu": "-250m", "memory": "1Mi"}},
+				},
+			}},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cpu": "0", "memory": "1048576"}, view.Report.AppStats[0].InstanceStats["timer"].Usage)
+	assert.Equal(t, "-250m", node.Report.AppStats(false)[0].InstanceStats["timer"].Usage["cpu"])
+
+	view, err = node.ViewWithOptions(&NodeViewOptions{Timeout: time.Minute, NegativeUsage: NegativeUsageClamp})
+	assert.NoError(t, err)
+	assert.Equal(t, "0", view.Report.AppStats[0].InstanceStats["timer"].Usage["cpu"])
+
+	_, err = node.ViewWithOptions(&NodeViewOptions{Timeout: time.Minute, NegativeUsage: NegativeUsageReject})
+	assert.EqualError(t, err, ErrNegativeResourceUsage.Error())
+}
+
+func TestReportViewClusterPercentStats(t *testing.T) {
+	view := &ReportView{
+		NodeStats: map[string]*NodeStats{
+			"master": {Capacity: map[string]string{"cpu": "2"}, Percent: map[string]string{"cpu": "0.5"}},
+			"worker": {Capacity: map[string]string{"cpu": "6"}, Percent: map[string]string{"cpu": "0.1"}},
+			"edge":   {Capacity: map[string]string{"memory": "1024"}, Percent: map[string]string{"memory": "0.2"}},
+		},
+	}
+	avg, weightedAvg, max, err := view.ClusterPercentStats("cpu")
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.3, avg, 1e-9)
+	assert.InDelta(t, 0.2, weightedAvg, 1e-9)
+	assert.InDelta(t, 0.5, max, 1e-9)
+
+	avg, weightedAvg, max, err = view.ClusterPercentStats("gpu")
+	assert.NoError(t, err)
+	assert.Zero(t, avg)
+	assert.Zero(t, weightedAvg)
+	assert.Zero(t, max)
+
+	view.NodeStats["worker"].Percent["cpu"] = "x"
+	_, _, _, err = view.ClusterPercentStats("cpu")
+	assert.Error(t, err)
+}
+
+func TestNodeCoreReportStale(t *testing.T) {
+	now := time.Date(2021, 4, 11, 0, 21, 35, 0, time.UTC)
+	node := &Node{
+		Attributes: map[string]interface{}{BaetylCoreFrequency: "20"},
+		Report:     Report{"time": "2021-04-11T00:21:00Z"},
+	}
+	assert.False(t, node.CoreReportStale(now))
+	assert.True(t, node.CoreReportStale(now.Add(time.Minute)))
+
+	node.Attributes[BaetylCoreFrequency] = "10s"
+	assert.True(t, node.CoreReportStale(now))
+
+	node.Attributes[BaetylCoreFrequency] = float64(60)
+	node.Report["time"] = now.Add(-2 * time.Minute)
+	assert.False(t, node.CoreReportStale(now))
+
+	node.Attributes[BaetylCoreFrequency] = "x"
+	assert.False(t, node.CoreReportStale(now))
+	assert.False(t, (&Node{Attributes: map[string]interface{}{BaetylCoreFrequency: "20"}}).CoreReportStale(now))
+}
+
+func TestInstanceDiff(t *testing.T) {
+	old := Report{
+		"appstats": []AppStats{{
+			AppInfo: AppInfo{Name: "timer"},
+			InstanceStats: map[string]InstanceStats{
+				"timer-1": {Name: "timer-1", Status: Pending, Usage: map[string]string{"cpu": "100m", "memory": "100Mi"}},
+				"timer-2": {Name: "timer-2", Status: Running, Usage: map[string]string{"cpu": "100m", "memory": "100Mi"}},
+				"timer-3": {Name: "timer-3", Status: Running, Usage: map[string]string{"cpu": "100m"}},
+				"timer-4": {Name: "timer-4", Status: Running},
+			},
+		}},
+	}
+	new := Report{
+		"appstats": []AppStats{{
+			AppInfo: AppInfo{Name: "timer"},
+			InstanceStats: map[string]InstanceStats{
+				"timer-1": {Name: "timer-1", Status: Running, Usage: map[string]string{"cpu": "100m", "memory": "100Mi"}},
+				"timer-2": {Name: "timer-2", Status: Running, Usage: map[string]string{"cpu": "105m", "memory": "200Mi"}},
+				"timer-3": {Name: "timer-3", Status: Running, Usage: map[string]string{"cpu": "0.1"}},
+				"timer-5": {Name: "timer-5", Status: Pending},
+			},
+		}},
+		"sysappstats": []AppStats{{
+			AppInfo: AppInfo{Name: "core"},
+			InstanceStats: map[string]InstanceStats{
+				"core-1": {Name: "core-1", Status: Failed},
+			},
+		}},
+	}
+	assert.Equal(t, []InstanceChange{
+		{AppName: "core", InstanceName: "core-1", NewStatus: Failed},
+		{AppName: "timer", InstanceName: "timer-1", OldStatus: Pending, NewStatus: Running},
+		{AppName: "timer", InstanceName: "timer-2", OldStatus: Running, NewStatus: Running, Usage: []string{"memory"}},
+		{AppName: "timer", InstanceName: "timer-4", OldStatus: Running},
+		{AppName: "timer", InstanceName: "timer-5", NewStatus: Pending},
+	}, InstanceDiff(old, new))
+	assert.Nil(t, InstanceDiff(new, new))
+	assert.Nil(t, InstanceDiff(nil, nil))
+}
+
+func TestDesireAppDelta(t *testing.T) {
+	d := Desire{
+		"apps":    []AppInfo{{Name: "b", Version: "1"}, {Name: "a", Version: "1"}},
+		"sysapps": []AppInfo{{Name: "core", Version: "1"}},
+		"name":    "node",
+	}
+	delta, err := d.AppDelta("a", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, Delta{"apps": map[string]interface{}{"a": map[string]interface{}{"version": "2"}}}, delta)
+
+	patched, err := d.PatchKeyedApps(delta)
+	assert.NoError(t, err)
+	assert.Equal(t, []AppInfo{{Name: "b", Version: "1"}, {Name: "a", Version: "2"}}, patched.AppInfos(false))
+	assert.Equal(t, []AppInfo{{Name: "core", Version: "1"}}, patched.AppInfos(true))
+	assert.Equal(t, "node", patched["name"])
+	assert.Equal(t, []AppInfo{{Name: "b", Version: "1"}, {Name: "a", Version: "1"}}, d.AppInfos(false))
+
+	delta, err = d.AppDelta("core", "3")
+	assert.NoError(t, err)
+	assert.Equal(t, Delta{"sysapps": map[string]interface{}{"core": map[string]interface{}{"version": "3"}}}, delta)
+
+	patched, err = d.PatchKeyedApps(Delta{
+		"apps": map[string]interface{}{"b": nil, "d": map[string]interface{}{"version": "1"}, "c": map[string]interface{}{"version": "1"}},
+		"age":  "12",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []AppInfo{{Name: "a", Version: "1"}, {Name: "c", Version: "1"}, {Name: "d", Version: "1"}}, patched.AppInfos(false))
+	assert.Equal(t, "12", patched["age"])
+
+	_, err = d.AppDelta("unknown", "1")
+	assert.Error(t, err)
+}
+
+func TestViewReportShapeError(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  Report
+		section string
+		typ     string
+	}{
+		{name: "string", report: Report{"node": "master"}, section: "node", typ: "string"},
+		{name: "number", report: Report{"node": 1}, section: "node", typ: "number"},
+		{name: "array", report: Report{"node": []interface{}{"master"}}, section: "node", typ: "array"},
+		{name: "nodestats", report: Report{"node": map[string]interface{}{"hostname": "master"}, "nodestats": true}, section: "nodestats", typ: "boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := (&Node{Report: tt.report}).View(WithReadyTimeout(time.Minute))
+			var shapeErr *ReportShapeError
+			assert.True(t, errors.As(err, &shapeErr))
+			assert.Equal(t, &ReportShapeError{Section: tt.section, Type: tt.typ}, shapeErr)
+		})
+	}
+	_, err := (&Node{Report: Report{"node": nil}}).View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+}
+
+func TestReportViewFallbackPlacements(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"appstats": []AppStats{{
+				AppInfo: AppInfo{Name: "timer"},
+				InstanceStats: map[string]InstanceStats{
+					"timer-1": {Name: "timer-1", NodeName: "master", Placement: &Placement{Selector: "gpu=true", Reason: "Matched"}},
+					"timer-2": {Name: "timer-2", NodeName: "worker", Placement: &Placement{Selector: "gpu=true", Reason: "Fallback: no node matched"}},
+					"timer-3": {Name: "timer-3", NodeName: "worker"},
+				},
+			}},
+			"sysappstats": []AppStats{{
+				AppInfo: AppInfo{Name: "core"},
+				InstanceStats: map[string]InstanceStats{
+					"core-1": {Name: "core-1", NodeName: "worker", Placement: &Placement{Reason: PlacementFallback}},
+				},
+			}},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []PlacedInstance{
+		{AppName: "timer", InstanceName: "timer-2", NodeName: "worker", Placement: &Placement{Selector: "gpu=true", Reason: "Fallback: no node matched"}},
+		{AppName: "core", InstanceName: "core-1", NodeName: "worker", Placement: &Placement{Reason: PlacementFallback}},
+	}, view.Report.FallbackPlacements())
+	assert.False(t, (&Placement{Reason: "FallbackX"}).IsFallback())
+	assert.Nil(t, (&ReportView{}).FallbackPlacements())
+}
+
+func TestDiffCounts(t *testing.T) {
+	oldReport := Report{
+		"apps":      []AppInfo{{Name: "a", Version: "1"}},
+		"devices":   []DeviceInfo{{Name: "d1", Version: "1"}},
+		"nodeprops": map[string]interface{}{"a": "1", "b": "2", "c": map[string]interface{}{"d": "3"}},
+		"time":      "2021-04-11T00:21:35Z",
+	}
+	newReport := Report{
+		"apps":      []AppInfo{{Name: "a", Version: "2"}},
+		"devices":   []DeviceInfo{{Name: "d1", Version: "1"}},
+		"nodeprops": map[string]interface{}{"a": "2", "c": map[string]interface{}{"d": "4", "e": "5"}},
+	}
+	counts, err := DiffCounts(oldReport, newReport)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"apps": 1, "nodeprops": 4, "time": 1}, counts)
+
+	counts, err = DiffCounts(newReport, newReport)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{}, counts)
+}
+
+func TestPopulateNodeStatsReadyByNodeStatsTime(t *testing.T) {
+	fresh := time.Now().Add(-10 * time.Second)
+	stale := time.Now().Add(-2 * time.Minute)
+	newView := func() *NodeView {
+		return &NodeView{
+			Report: &ReportView{
+				Time: &fresh,
+				NodeStats: map[string]*NodeStats{
+					"master": {Time: &fresh},
+					"worker": {Time: &stale},
+				},
+			},
+		}
+	}
+
+	view := newView()
+	assert.NoError(t, view.populateNodeStats(&NodeViewOptions{Timeout: time.Minute}))
+	assert.True(t, view.Ready)
+
+	view = newView()
+	assert.NoError(t, view.populateNodeStats(&NodeViewOptions{Timeout: time.Minute, ReadyBy: ReadyByNodeStatsTime}))
+	assert.False(t, view.Ready)
+
+	view = newView()
+	view.Report.NodeStats["worker"].Time = nil
+	assert.NoError(t, view.populateNodeStats(&NodeViewOptions{Timeout: time.Minute, ReadyBy: ReadyByNodeStatsTime}))
+	assert.True(t, view.Ready)
+
+	view = &NodeView{Report: &ReportView{Time: &stale}}
+	assert.NoError(t, view.populateNodeStats(&NodeViewOptions{Timeout: time.Minute, ReadyBy: ReadyByNodeStatsTime}))
+	assert.False(t, view.Ready)
+}
+
+func TestDesireValidateAppReferences(t *testing.T) {
+	d := Desire{
+		"apps": []interface{}{
+			map[string]interface{}{"name": "a", "version": "1", "refs": []interface{}{"cfg-a", "secret-a"}},
+			map[string]interface{}{"name": "b", "version": "1", "refs": []interface{}{"cfg-b", "cfg-a"}},
+		},
+		"sysapps": []AppInfo{{Name: "core", Version: "1", Refs: []string{"cfg-core", "cfg-b"}}},
+	}
+	assert.Equal(t, []AppInfo{
+		{Name: "a", Version: "1", Refs: []string{"cfg-a", "secret-a"}},
+		{Name: "b", Version: "1", Refs: []string{"cfg-b", "cfg-a"}},
+	}, d.AppInfos(false))
+	assert.Equal(t, []string{"cfg-b", "cfg-core"}, d.ValidateAppReferences(map[string]bool{"cfg-a": true, "secret-a": true}))
+	assert.Equal(t, []string{"cfg-a", "cfg-b", "cfg-core", "secret-a"}, d.ValidateAppReferences(nil))
+	assert.Nil(t, d.ValidateAppReferences(map[string]bool{"cfg-a": true, "cfg-b": true, "secret-a": true, "cfg-core": true}))
+}
+
+func TestAppStatsInstancesByNode(t *testing.T) {
+	stats := &AppStats{
+		AppInfo: AppInfo{Name: "timer"},
+		InstanceStats: map[string]InstanceStats{
+			"timer-c": {Name: "timer-c", NodeName: "master"},
+			"timer-a": {Name: "timer-a", NodeName: "master"},
+			"timer-b": {Name: "timer-b", NodeName: "worker"},
+		},
+	}
+	assert.Equal(t, map[string][]InstanceStats{
+		"master": {{Name: "timer-a", NodeName: "master"}, {Name: "timer-c", NodeName: "master"}},
+		"worker": {{Name: "timer-b", NodeName: "worker"}},
+	}, stats.InstancesByNode())
+	assert.Equal(t, map[string][]InstanceStats{}, (&AppStats{}).InstancesByNode())
+}
+
+func TestNodeViewMarshalFields(t *testing.T) {
+	view := &NodeView{
+		Name:   "baetyl",
+		Labels: map[string]string{"a": "b"},
+		Report: &ReportView{Apps: []AppInfo{{Name: "a", Version: "1"}}},
+		Desire: Desire{"apps": []AppInfo{{Name: "a", Version: "2"}}},
+		Ready:  true,
+	}
+	data, err := view.MarshalFields([]string{"desire", "labels", "report", "unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"labels":{"a":"b"},"report":{"apps":[{"name":"a","version":"1"}]},"desire":{"apps":[{"name":"a","version":"2"}]}}`, string(data))
+
+	data, err = view.MarshalFields([]string{"name", "ready", "description", "mode", "cluster"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"baetyl","cluster":false,"ready":true,"mode":""}`, string(data))
+
+	data, err = view.MarshalFields([]string{"unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{}`, string(data))
+
+	full, err := json.Marshal(view)
+	assert.NoError(t, err)
+	data, err = view.MarshalFields(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, string(full), string(data))
+}
+
+func TestNodeValidateAccelerator(t *testing.T) {
+	gpuStats := map[string]interface{}{
+		"usage":     map[string]interface{}{"cpu": "1"},
+		"capacity":  map[string]interface{}{"cpu": "2"},
+		"extension": map[string]interface{}{"totalMemory": 1024.0, "usedMemory": 512.0},
+	}
+	plainStats := map[string]interface{}{
+		"usage":    map[string]interface{}{"cpu": "1"},
+		"capacity": map[string]interface{}{"cpu": "2"},
+	}
+	nodeInfo := func(names ...string) map[string]interface{} {
+		res := map[string]interface{}{}
+		for _, name := range names {
+			res[name] = map[string]interface{}{"hostname": name}
+		}
+		return res
+	}
+
+	// nothing reported
+	n := &Node{Accelerator: NVAccelerator, Report: Report{}}
+	assert.NoError(t, n.ValidateAccelerator())
+
+	// declared and reported
+	n.Report = Report{
+		"node":      nodeInfo("n1", "n2"),
+		"nodestats": map[string]interface{}{"n1": gpuStats, "n2": plainStats},
+	}
+	assert.NoError(t, n.ValidateAccelerator())
+
+	// declared but not reported
+	n.Report["nodestats"] = map[string]interface{}{"n1": plainStats, "n2": plainStats}
+	err := n.ValidateAccelerator()
+	var mismatch *AcceleratorMismatchError
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, NVAccelerator, mismatch.Accelerator)
+	assert.Empty(t, mismatch.GPUNodes)
+	assert.EqualError(t, err, "the accelerator (nvidia) is declared, but no gpu is reported")
+
+	// reported but not declared
+	n.Accelerator = ""
+	n.Report["nodestats"] = map[string]interface{}{"n2": gpuStats, "n1": gpuStats}
+	err = n.ValidateAccelerator()
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, []string{"n1", "n2"}, mismatch.GPUNodes)
+	assert.EqualError(t, err, "no accelerator is declared, but gpu is reported by nodes (n1,n2)")
+
+	// neither declared nor reported
+	n.Report["nodestats"] = map[string]interface{}{"n1": plainStats}
+	assert.NoError(t, n.ValidateAccelerator())
+
+	// single node report
+	n = &Node{
+		Report: Report{
+			"node":      map[string]interface{}{"hostname": "edge"},
+			"nodestats": gpuStats,
+		},
+	}
+	err = n.ValidateAccelerator()
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, []string{"edge"}, mismatch.GPUNodes)
+	n.Accelerator = NVAccelerator
+	assert.NoError(t, n.ValidateAccelerator())
+}
+
+func TestReportMergeChanged(t *testing.T) {
+	r := Report{
+		"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}},
+		"node": map[string]interface{}{"n1": map[string]interface{}{"hostname": "n1", "os": "linux"}},
+	}
+
+	changed, err := r.MergeChanged(Report{
+		"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}},
+		"node": map[string]interface{}{"n1": map[string]interface{}{"os": "linux"}},
+	})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = r.MergeChanged(Report{})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = r.MergeChanged(Report{
+		"node": map[string]interface{}{"n1": map[string]interface{}{"os": "windows"}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]interface{}{"hostname": "n1", "os": "windows"}, r["node"].(map[string]interface{})["n1"])
+
+	changed, err = r.MergeChanged(Report{"time": "2021-01-01T00:00:00Z"})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "2021-01-01T00:00:00Z", r["time"])
+
+	deep := map[string]interface{}{}
+	cur := deep
+	for i := 0; i < maxJSONLevel; i++ {
+		next := map[string]interface{}{}
+		cur["a"] = next
+		cur = next
+	}
+	old := Report{"a": deep["a"]}
+	changed, err = old.MergeChanged(Report{"a": deep["a"]})
+	assert.EqualError(t, err, ErrJSONLevelExceedsLimit.Error())
+	assert.False(t, changed)
+}
+
+func TestReportViewInstancesByQoS(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"time": time.Now().UTC(),
+			"appstats": []interface{}{
+				map[string]interface{}{
+					"name": "a",
+					"instances": map[string]interface{}{
+						"a-1": map[string]interface{}{"name": "a-1", "limit": map[string]interface{}{"cpu": "1", "memory": "1Gi"}},
+						"a-2": map[string]interface{}{"name": "a-2", "limit": map[string]interface{}{"memory": "1Gi"}},
+						"a-3": map[string]interface{}{"name": "a-3", "limit": map[string]interface{}{"gpu": "1"}},
+						"a-4": map[string]interface{}{"name": "a-4", "qosClass": "Guaranteed"},
+						"a-5": map[string]interface{}{"name": "a-5"},
+						"a-6": map[string]interface{}{"name": "a-6", "qosClass": "Guaranteed", "limit": map[string]interface{}{"memory": "1Gi"}},
+					},
+				},
+			},
+			"sysappstats": []interface{}{
+				map[string]interface{}{
+					"name": "core",
+					"instances": map[string]interface{}{
+						"core-1": map[string]interface{}{"name": "core-1", "qosClass": "Burstable"},
+					},
+				},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	instances := view.Report.AppStats[0].InstanceStats
+	assert.Equal(t, QoSGuaranteed, instances["a-1"].QoSClass)
+	assert.Equal(t, QoSBurstable, instances["a-2"].QoSClass)
+	assert.Equal(t, QoSBestEffort, instances["a-3"].QoSClass)
+	assert.Equal(t, QoSGuaranteed, instances["a-4"].QoSClass)
+	assert.Equal(t, QoSClass(""), instances["a-5"].QoSClass)
+	assert.Equal(t, QoSGuaranteed, instances["a-6"].QoSClass)
+	assert.Equal(t, map[string]int{"Guaranteed": 3, "Burstable": 2, "BestEffort": 2}, view.Report.InstancesByQoS())
+	assert.Equal(t, map[string]int{}, (&ReportView{}).InstancesByQoS())
+}
+
+func TestReportPruneStaleNodes(t *testing.T) {
+	r := Report{
+		"node": map[string]interface{}{
+			"n1": map[string]interface{}{"hostname": "n1"},
+			"n2": map[string]interface{}{"hostname": "n2"},
+		},
+		"nodestats": map[string]*NodeStats{
+			"n1": {Usage: map[string]string{"cpu": "1"}},
+			"n2": {Usage: map[string]string{"cpu": "1"}},
+		},
+		"appstats": []interface{}{
+			map[string]interface{}{
+				"name": "a",
+				"instances": map[string]interface{}{
+					"a-1": map[string]interface{}{"name": "a-1", "nodeName": "n1"},
+					"a-2": map[string]interface{}{"name": "a-2", "nodeName": "n3"},
+					"a-3": map[string]interface{}{"name": "a-3"},
+				},
+			},
+		},
+		"sysappstats": []AppStats{
+			{
+				AppInfo: AppInfo{Name: "core"},
+				InstanceStats: map[string]InstanceStats{
+					"core-1": {Name: "core-1", NodeName: "n1"},
+					"core-2": {Name: "core-2", NodeName: "n2"},
+				},
+			},
+		},
+	}
+	assert.Equal(t, []string{"n2", "n3"}, r.PruneStaleNodes([]string{"n1"}))
+	assert.Equal(t, map[string]interface{}{"n1": map[string]interface{}{"hostname": "n1"}}, r["node"])
+	assert.Equal(t, map[string]*NodeStats{"n1": {Usage: map[string]string{"cpu": "1"}}}, r["nodestats"])
+	instances := r["appstats"].([]interface{})[0].(map[string]interface{})["instances"].(map[string]interface{})
+	assert.Len(t, instances, 2)
+	assert.Contains(t, instances, "a-1")
+	assert.Contains(t, instances, "a-3")
+	assert.Equal(t, map[string]InstanceStats{"core-1": {Name: "core-1", NodeName: "n1"}}, r["sysappstats"].([]AppStats)[0].InstanceStats)
+	assert.Equal(t, []string{}, r.PruneStaleNodes([]string{"n1"}))
+
+	// single node report is untouched
+	single := Report{
+		"node":      map[string]interface{}{"hostname": "edge", "labels": map[string]interface{}{"a": "b"}},
+		"nodestats": map[string]interface{}{"usage": map[string]interface{}{"cpu": "1"}},
+	}
+	assert.Nil(t, single.PruneStaleNodes(nil))
+	assert.Equal(t, "edge", single["node"].(map[string]interface{})["hostname"])
+	assert.Nil(t, Report{}.PruneStaleNodes(nil))
+}
+
+func TestNodeViewHealthScore(t *testing.T) {
+	view := &NodeView{}
+	assert.Equal(t, 60, view.HealthScore())
+
+	view.Ready = true
+	assert.Equal(t, 100, view.HealthScore())
+
+	view.Report = &ReportView{
+		NodeStats: map[string]*NodeStats{
+			"n1": {Percent: map[string]string{"cpu": "0.5", "memory": "0.2"}},
+			"n2": {Percent: map[string]string{"cpu": "0.1", "memory": "0.6", "gpu": "0.9"}},
+			"n3": nil,
+		},
+		AppStats: []AppStats{{
+			AppInfo: AppInfo{Name: "a"},
+			InstanceStats: map[string]InstanceStats{
+				"a-1": {Status: Running},
+				"a-2": {Status: Failed},
+			},
+		}},
+		SysAppStats: []AppStats{{
+			AppInfo: AppInfo{Name: "core"},
+			InstanceStats: map[string]InstanceStats{
+				"core-1": {Status: Running},
+				"core-2": {Status: Running},
+			},
+		}},
+	}
+	// 40 + 30*(1-0.6) + 30*(1-0.25)
+	assert.Equal(t, 75, view.HealthScore())
+	// 100*(1-0.6)
+	assert.Equal(t, 40, view.HealthScoreWithWeights(HealthWeights{Pressure: 1}))
+	assert.Equal(t, 0, view.HealthScoreWithWeights(HealthWeights{}))
+
+	view.Report.NodeStats["n1"].Percent["memory"] = "1.5"
+	assert.Equal(t, 0, view.HealthScoreWithWeights(HealthWeights{Pressure: 1}))
+}
+
+func TestMergeClusterReports(t *testing.T) {
+	t1 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	reports := map[string]Report{
+		"worker": {
+			"time":      t1.Format(time.RFC3339Nano),
+			"node":      map[string]interface{}{"hostname": "worker-host", "arch": "arm64"},
+			"nodestats": map[string]interface{}{"usage": map[string]interface{}{"cpu": "1"}},
+			"apps":      []interface{}{map[string]interface{}{"name": "a", "version": "1"}, map[string]interface{}{"name": "b", "version": "1"}},
+			"appstats": []interface{}{
+				map[string]interface{}{
+					"name": "a", "version": "1", "status": "Running",
+					"instances": map[string]interface{}{
+						"a-2": map[string]interface{}{"name": "a-2", "status": "Running"},
+					},
+				},
+			},
+			"core": map[string]interface{}{"goVersion": "worker"},
+		},
+		"master": {
+			"time":      t2,
+			"node":      &NodeInfo{Hostname: "master-host", Arch: "amd64"},
+			"nodestats": &NodeStats{Usage: map[string]string{"cpu": "2"}},
+			"apps":      []AppInfo{{Name: "a", Version: "1"}},
+			"appstats": []AppStats{{
+				AppInfo: AppInfo{Name: "a", Version: "1"},
+				Status:  Running,
+				InstanceStats: map[string]InstanceStats{
+					"a-1": {Name: "a-1", Status: Running, NodeName: "master"},
+				},
+			}},
+			"sysappstats": []AppStats{{AppInfo: AppInfo{Name: "core", Version: "1"}, Status: Running}},
+			"core":        map[string]interface{}{"goVersion": "master"},
+		},
+	}
+	res, err := MergeClusterReports(reports)
+	assert.NoError(t, err)
+	assert.Equal(t, t2, res["time"])
+	assert.Equal(t, map[string]*NodeInfo{
+		"master": {Hostname: "master-host", Arch: "amd64"},
+		"worker": {Hostname: "worker-host", Arch: "arm64"},
+	}, res["node"])
+	assert.Equal(t, map[string]*NodeStats{
+		"master": {Usage: map[string]string{"cpu": "2"}},
+		"worker": {Usage: map[string]string{"cpu": "1"}},
+	}, res["nodestats"])
+	assert.Equal(t, []AppInfo{{Name: "a", Version: "1"}, {Name: "b", Version: "1"}}, res["apps"])
+	assert.Equal(t, []AppStats{{
+		AppInfo: AppInfo{Name: "a", Version: "1"},
+		Status:  Running,
+		InstanceStats: map[string]InstanceStats{
+			"a-1": {Name: "a-1", Status: Running, NodeName: "master"},
+			"a-2": {Name: "a-2", Status: Running, NodeName: "worker"},
+		},
+	}}, res["appstats"])
+	assert.Equal(t, []AppStats{{AppInfo: AppInfo{Name: "core", Version: "1"}, Status: Running}}, res["sysappstats"])
+	assert.Equal(t, map[string]interface{}{"goVersion": "master"}, res["core"])
+	assert.NotContains(t, res, "sysapps")
+
+	res, err = MergeClusterReports(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Report{}, res)
+
+	_, err = MergeClusterReports(map[string]Report{"bad": {"node": "edge"}})
+	assert.Error(t, err)
+}
+
+func TestPatchNilDelta(t *testing.T) {
+	r := Report{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}}}
+	res, err := r.Patch(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, r, res)
+	res, err = r.Patch(Delta{})
+	assert.NoError(t, err)
+	assert.Equal(t, r, res)
+	res, err = r.PatchPrecise(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, r, res)
+
+	var delta Delta
+	assert.NoError(t, json.Unmarshal([]byte("null"), &delta))
+	d := Desire{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}}}
+	desire, err := d.Patch(delta)
+	assert.NoError(t, err)
+	assert.Equal(t, d, desire)
+	desire, err = d.PatchPrecise(delta)
+	assert.NoError(t, err)
+	assert.Equal(t, d, desire)
+}
+
+func TestReplicaShortfall(t *testing.T) {
+	node := &Node{
+		Desire: Desire{
+			"apps": []interface{}{
+				map[string]interface{}{"name": "a", "version": "1", "replicas": 3.0},
+				map[string]interface{}{"name": "b", "version": "1", "replicas": 1.0},
+				map[string]interface{}{"name": "c", "version": "1"},
+				map[string]interface{}{"name": "d", "version": "1", "replicas": 2.0},
+			},
+			"sysapps": []AppInfo{{Name: "core", Version: "1", Replicas: 1}},
+		},
+		Report: Report{
+			"appstats": []AppStats{
+				{
+					AppInfo: AppInfo{Name: "a", Version: "1"},
+					InstanceStats: map[string]InstanceStats{
+						"a-1": {Status: Running},
+						"a-2": {Status: Failed},
+					},
+				},
+				{
+					AppInfo:       AppInfo{Name: "b", Version: "1"},
+					InstanceStats: map[string]InstanceStats{"b-1": {Status: Running}},
+				},
+			},
+		},
+	}
+	assert.Equal(t, 3, node.Desire.AppInfos(false)[0].Replicas)
+	assert.Equal(t, map[string]int{"a": 2, "d": 2, "core": 1}, node.ReplicaShortfall())
+	assert.Equal(t, map[string]int{}, ReplicaShortfall(nil, nil))
+}
+
+func TestNodeViewTimeFormat(t *testing.T) {
+	reportTime := time.Now().UTC().Truncate(time.Millisecond)
+	createTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	node := &Node{
+		Name:              "baetyl",
+		CreationTimestamp: createTime,
+		Report: Report{
+			"time":      reportTime,
+			"node":      map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}},
+			"nodestats": map[string]interface{}{"edge": map[string]interface{}{"time": createTime}},
+			"appstats": []AppStats{{
+				AppInfo: AppInfo{Name: "a", Version: "1"},
+				InstanceStats: map[string]InstanceStats{
+					"a-1": {Name: "a-1", CreateTime: createTime, Container: &ServiceInfo{
+						Name: "c1", CreateTime: &createTime, RestartCount: 2, LastRestartTime: &createTime,
+					}},
+				},
+			}},
+		},
+	}
+
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	data, err := json.Marshal(view)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"createTime":"2021-01-01T00:00:00Z"`)
+
+	view, err = node.ViewWithOptions(&NodeViewOptions{Timeout: time.Minute, TimeFormat: TimeFormatEpochMillis})
+	assert.NoError(t, err)
+	data, err = json.Marshal(view)
+	assert.NoError(t, err)
+	var doc map[string]interface{}
+	assert.NoError(t, unmarshalWithNumber(data, &doc))
+	millis := json.Number(strconv.FormatInt(createTime.UnixNano()/int64(time.Millisecond), 10))
+	assert.Equal(t, millis, doc["createTime"])
+	report := doc["report"].(map[string]interface{})
+	assert.Equal(t, json.Number(strconv.FormatInt(reportTime.UnixNano()/int64(time.Millisecond), 10)), report["time"])
+	assert.Equal(t, millis, report["nodestats"].(map[string]interface{})["edge"].(map[string]interface{})["time"])
+	ins := report["appstats"].([]interface{})[0].(map[string]interface{})["instances"].(map[string]interface{})["a-1"]
+	assert.Equal(t, millis, ins.(map[string]interface{})["createTime"])
+	container := ins.(map[string]interface{})["container"].(map[string]interface{})
+	assert.Equal(t, millis, container["createTime"])
+	assert.Equal(t, millis, container["lastRestartTime"])
+	assert.Equal(t, json.Number("2"), container["restartCount"])
+	assert.Equal(t, true, doc["ready"])
+
+	data, err = view.MarshalFields([]string{"createTime", "name"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"baetyl","createTime":`+string(millis)+`}`, string(data))
+}
+
+func TestNodeViewOvercommittedResources(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"time": time.Now().UTC(),
+			"node": map[string]interface{}{
+				"n1": map[string]interface{}{"hostname": "n1"},
+				"n2": map[string]interface{}{"hostname": "n2"},
+			},
+			"nodestats": map[string]interface{}{
+				"n1": map[string]interface{}{"capacity": map[string]interface{}{"cpu": "1", "memory": "1Gi"}},
+				"n2": map[string]interface{}{"capacity": map[string]interface{}{"cpu": "2", "memory": "1Gi"}},
+			},
+			"appstats": []interface{}{
+				map[string]interface{}{
+					"name": "a",
+					"instances": map[string]interface{}{
+						"a-1": map[string]interface{}{"name": "a-1", "nodeName": "n1", "usage": map[string]interface{}{"cpu": "600m", "memory": "600Mi", "disk": "1Gi"}},
+						"a-2": map[string]interface{}{"name": "a-2", "nodeName": "n2", "usage": map[string]interface{}{"cpu": "500m", "memory": "800Mi"}},
+						"a-3": map[string]interface{}{"name": "a-3", "nodeName": "n3", "usage": map[string]interface{}{"cpu": "3"}},
+					},
+				},
+			},
+			"sysappstats": []interface{}{
+				map[string]interface{}{
+					"name": "core",
+					"instances": map[string]interface{}{
+						"core-1": map[string]interface{}{"name": "core-1", "nodeName": "n1", "usage": map[string]interface{}{"cpu": "500m", "memory": "100Mi"}},
+						"core-2": map[string]interface{}{"name": "core-2", "nodeName": "n2", "usage": map[string]interface{}{"cpu": "500m", "memory": "300Mi"}},
+					},
+				},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"cpu": {"n1"}, "memory": {"n2"}}, view.OvercommittedResources())
+	assert.Equal(t, map[string][]string{}, (&NodeView{}).OvercommittedResources())
+}
+
+func TestNodeViewPrimaryNodeName(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"node": map[string]interface{}{"hostname": "edge", "os": "linux"},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "edge", view.PrimaryNodeName())
+
+	view.Report.Node = map[string]*NodeInfo{
+		"n1": {Hostname: "n1", Role: "worker"},
+		"n3": {Hostname: "n3", Role: NodeRoleMaster},
+		"n2": {Hostname: "n2", Role: NodeRoleMaster},
+	}
+	assert.Equal(t, "n2", view.PrimaryNodeName())
+
+	view.Report.Node = map[string]*NodeInfo{"n1": {Hostname: "n1"}}
+	assert.Equal(t, "n1", view.PrimaryNodeName())
+
+	view.Report.Node = map[string]*NodeInfo{"n1": {Hostname: "n1"}, "n2": {Hostname: "n2"}}
+	assert.Equal(t, "", view.PrimaryNodeName())
+	assert.Equal(t, "", (&NodeView{}).PrimaryNodeName())
+}
+
+func TestNodeStatsMountPercent(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"node": map[string]interface{}{"hostname": "edge"},
+			"nodestats": map[string]interface{}{
+				"mounts": []interface{}{
+					map[string]interface{}{"path": "/", "usage": "1Gi", "capacity": "4Gi"},
+					map[string]interface{}{"path": "/data", "usage": "512Mi", "capacity": "1Gi"},
+					map[string]interface{}{"path": "/empty", "capacity": "0"},
+				},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	s := view.Report.NodeStats["edge"]
+	assert.Equal(t, []MountUsage{
+		{Path: "/", Usage: "1073741824", Capacity: "4294967296"},
+		{Path: "/data", Usage: "536870912", Capacity: "1073741824"},
+		{Path: "/empty", Capacity: "0"},
+	}, s.Mounts)
+	p, ok := s.MountPercent("/")
+	assert.True(t, ok)
+	assert.Equal(t, 0.25, p)
+	p, ok = s.MountPercent("/data")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, p)
+	_, ok = s.MountPercent("/empty")
+	assert.False(t, ok)
+	_, ok = s.MountPercent("/missing")
+	assert.False(t, ok)
+
+	node.Report["nodestats"] = map[string]interface{}{
+		"mounts": []interface{}{map[string]interface{}{"path": "/", "usage": "x"}},
+	}
+	_, err = node.View(WithReadyTimeout(time.Minute))
+	assert.Error(t, err)
+}
+
+func TestDesireRemoveApp(t *testing.T) {
+	d := Desire{
+		"apps":    []interface{}{map[string]interface{}{"name": "a", "version": "1"}, map[string]interface{}{"name": "b", "version": "1"}},
+		"sysapps": []AppInfo{{Name: "core", Version: "1"}},
+	}
+	edge := Desire{
+		"apps":    []AppInfo{{Name: "a", Version: "1"}, {Name: "b", Version: "1"}},
+		"sysapps": []AppInfo{{Name: "core", Version: "1"}},
+	}
+
+	delta, err := d.RemoveApp("a")
+	assert.NoError(t, err)
+	assert.Equal(t, Delta{"apps": []AppInfo{{Name: "b", Version: "1"}}}, delta)
+	assert.Equal(t, []AppInfo{{Name: "b", Version: "1"}}, d.AppInfos(false))
+	data, err := json.Marshal(delta)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"apps":[{"name":"b","version":"1"}]}`, string(data))
+	patched, err := edge.Patch(delta)
+	assert.NoError(t, err)
+	assert.Equal(t, d.AppInfos(false), patched.AppInfos(false))
+	assert.Equal(t, edge.AppInfos(true), patched.AppInfos(true))
+
+	delta, err = d.RemoveApp("core")
+	assert.NoError(t, err)
+	assert.Equal(t, Delta{"sysapps": []AppInfo{}}, delta)
+	assert.Equal(t, []AppInfo{}, d.AppInfos(true))
+	patched, err = patched.Patch(delta)
+	assert.NoError(t, err)
+	assert.Equal(t, d.AppInfos(false), patched.AppInfos(false))
+	assert.Len(t, patched.AppInfos(true), 0)
+
+	_, err = d.RemoveApp("a")
+	assert.EqualError(t, err, "app (a) not found in desire")
+}
+
+func TestDetectOSDrift(t *testing.T) {
+	report := Report{
+		"node": map[string]interface{}{
+			"n1": map[string]interface{}{"hostname": "n1", "kernelVer": "5.4", "osImage": "Ubuntu 20.04"},
+			"n2": map[string]interface{}{"hostname": "n2", "kernelVer": "5.10", "osImage": "Ubuntu 20.04"},
+			"n3": map[string]interface{}{"hostname": "n3", "kernelVer": "5.4", "osImage": "Ubuntu 18.04"},
+		},
+	}
+	assert.Equal(t, []string{"n2", "n3"}, DetectOSDrift(report, "5.4", "Ubuntu 20.04"))
+	assert.Equal(t, []string{"n2"}, DetectOSDrift(report, "5.4", ""))
+	assert.Equal(t, []string{"n3"}, DetectOSDrift(report, "", "Ubuntu 20.04"))
+	assert.Nil(t, DetectOSDrift(report, "", ""))
+
+	single := Report{"node": map[string]interface{}{"hostname": "edge", "kernelVer": "4.19", "osImage": "Debian"}}
+	assert.Equal(t, []string{"edge"}, DetectOSDrift(single, "5.4", ""))
+	assert.Nil(t, DetectOSDrift(single, "4.19", "Debian"))
+	assert.Nil(t, DetectOSDrift(Report{}, "5.4", ""))
+	assert.Nil(t, DetectOSDrift(Report{"node": "edge"}, "5.4", ""))
+}
+
+func TestJSONDepth(t *testing.T) {
+	assert.Equal(t, 0, JSONDepth(nil))
+	assert.Equal(t, 1, JSONDepth(map[string]interface{}{}))
+	assert.Equal(t, 1, JSONDepth(map[string]interface{}{"a": "b", "n": nil, "l": []interface{}{1.0, "x"}}))
+	assert.Equal(t, 3, JSONDepth(map[string]interface{}{
+		"a": map[string]interface{}{"b": map[string]interface{}{"c": 1}},
+		"d": map[string]interface{}{"e": 1},
+	}))
+	assert.Equal(t, 3, JSONDepth(map[string]interface{}{
+		"apps": []interface{}{map[string]interface{}{"name": "a", "labels": map[string]interface{}{"k": "v"}}},
+	}))
+	now := time.Now()
+	assert.Equal(t, 1, JSONDepth(map[string]interface{}{"time": now, "ptime": &now, "bytes": []byte("x")}))
+	assert.Equal(t, 5, JSONDepth(Report{
+		"appstats": []AppStats{{
+			AppInfo:       AppInfo{Name: "a"},
+			InstanceStats: map[string]InstanceStats{"a-1": {Usage: map[string]string{"cpu": "1"}}},
+		}},
+	}))
+
+	deep := map[string]interface{}{}
+	cur := deep
+	for i := 0; i < maxJSONLevel; i++ {
+		next := map[string]interface{}{}
+		cur["a"] = next
+		cur = next
+	}
+	assert.Equal(t, maxJSONLevel+1, JSONDepth(deep))
+	assert.Error(t, Report{"a": deep["a"]}.Merge(Report{"a": deep["a"]}))
+}
+
+func TestReportSectionSource(t *testing.T) {
+	r := Report{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}}}
+	_, ok := r.SectionSource("apps")
+	assert.False(t, ok)
+	r.SetSectionSource("apps", "engine")
+	r.SetSectionSource("node", "agent")
+	r.SetSectionSource("apps", "sync")
+	source, ok := r.SectionSource("apps")
+	assert.True(t, ok)
+	assert.Equal(t, "sync", source)
+
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	var decoded Report
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	source, ok = decoded.SectionSource("node")
+	assert.True(t, ok)
+	assert.Equal(t, "agent", source)
+
+	typed := Report{KeySectionSources: map[string]string{"node": "agent"}}
+	source, ok = typed.SectionSource("node")
+	assert.True(t, ok)
+	assert.Equal(t, "agent", source)
+	typed.SetSectionSource("apps", "engine")
+	assert.Equal(t, map[string]interface{}{"node": "agent", "apps": "engine"}, typed[KeySectionSources])
+
+	// excluded from diffs
+	desire := Desire{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "2"}}}
+	expected := Desire{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "2"}}}
+	delta, err := desire.Diff(r)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, delta)
+	delta2, err := desire.DiffWithNil(r)
+	assert.NoError(t, err)
+	assert.Equal(t, Delta(expected), delta2)
+	delta, err = desire.DiffPrecise(r)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, delta)
+	delta, err = desire.DiffIgnoreOrder(r)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, delta)
+	delta2, err = desire.DiffSegmented(r)
+	assert.NoError(t, err)
+	assert.Equal(t, Delta(expected), delta2)
+
+	// excluded from views
+	node := &Node{Report: r}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	data, err = json.Marshal(view)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), KeySectionSources)
+}
+
+func TestReportViewAppsByAnnotation(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"time": time.Now().UTC(),
+			"appstats": []interface{}{
+				map[string]interface{}{"name": "a", "status": "Running", "annotations": map[string]interface{}{"owner": "team-a", "cost": "c1"}},
+				map[string]interface{}{"name": "b", "status": "Running", "annotations": map[string]interface{}{"owner": "team-b"}},
+				map[string]interface{}{"name": "c", "status": "Running"},
+			},
+			"sysappstats": []interface{}{
+				map[string]interface{}{"name": "core", "status": "Running", "annotations": map[string]interface{}{"owner": "team-a"}},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"owner": "team-a", "cost": "c1"}, view.Report.AppStats[0].Annotations)
+
+	apps := view.Report.AppsByAnnotation("owner", "team-a")
+	assert.Len(t, apps, 2)
+	assert.Equal(t, "a", apps[0].Name)
+	assert.Equal(t, "core", apps[1].Name)
+	assert.Len(t, view.Report.AppsByAnnotation("owner", "team-b"), 1)
+	assert.Nil(t, view.Report.AppsByAnnotation("owner", "team-c"))
+	assert.Nil(t, view.Report.AppsByAnnotation("missing", ""))
+}
+
+func TestDesireDiffVolatileAware(t *testing.T) {
+	RegisterVolatileKey("time")
+	RegisterVolatileKey("node.master.time")
+	RegisterVolatileKey("missing.path")
+	defer UnregisterVolatileKey("time")
+	defer UnregisterVolatileKey("node.master.time")
+	defer UnregisterVolatileKey("missing.path")
+
+	desire := Desire{
+		"time":    "2021-01-02T00:00:00Z",
+		"version": "2",
+		"node": map[string]interface{}{
+			"master": map[string]interface{}{"time": "2021-01-02T00:00:00Z"},
+			"worker": map[string]interface{}{"time": "2021-01-02T00:00:00Z"},
+		},
+	}
+	report := Report{
+		"time":    "2021-01-01T00:00:00Z",
+		"version": "1",
+		"node": map[string]interface{}{
+			"master": map[string]interface{}{"time": "2021-01-01T00:00:00Z"},
+			"worker": map[string]interface{}{"time": "2021-01-01T00:00:00Z"},
+		},
+	}
+	delta, err := desire.DiffVolatileAware(report)
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{
+		"version": "2",
+		"node":    map[string]interface{}{"worker": map[string]interface{}{"time": "2021-01-02T00:00:00Z"}},
+	}, delta)
+
+	UnregisterVolatileKey("node.master.time")
+	RegisterVolatileKey("node.worker.time")
+	RegisterVolatileKey("version")
+	defer UnregisterVolatileKey("node.worker.time")
+	defer UnregisterVolatileKey("version")
+	delta, err = desire.DiffVolatileAware(report)
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{
+		"node": map[string]interface{}{"master": map[string]interface{}{"time": "2021-01-02T00:00:00Z"}},
+	}, delta)
+
+	// plain diff is not affected
+	delta, err = desire.Diff(report)
+	assert.NoError(t, err)
+	assert.Contains(t, delta, "time")
+}
+
+func TestBuildAppVersionMatrix(t *testing.T) {
+	nodes := []*Node{
+		{
+			Desire: Desire{"apps": []AppInfo{{Name: "a", Version: "2"}, {Name: "b", Version: "1"}}, "sysapps": []AppInfo{{Name: "core", Version: "1"}}},
+			Report: Report{"apps": []AppInfo{{Name: "a", Version: "2"}}, "sysapps": []AppInfo{{Name: "core", Version: "1"}}},
+		},
+		{
+			Desire: Desire{"apps": []AppInfo{{Name: "a", Version: "2"}}},
+			Report: Report{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}, map[string]interface{}{"name": "c", "version": "1"}}},
+		},
+		{
+			Desire: Desire{"apps": []AppInfo{{Name: "a", Version: "3"}, {Name: "b", Version: "0"}}},
+			Report: Report{"apps": []AppInfo{{Name: "a", Version: "1"}}},
+		},
+		nil,
+	}
+	assert.Equal(t, map[string]AppVersionSpread{
+		"a":    {Desired: "2", Reported: map[string]int{"1": 2, "2": 1}},
+		"b":    {Desired: "0", Reported: map[string]int{}},
+		"c":    {Reported: map[string]int{"1": 1}},
+		"core": {Desired: "1", Reported: map[string]int{"1": 1}},
+	}, BuildAppVersionMatrix(nodes))
+	assert.Equal(t, map[string]AppVersionSpread{}, BuildAppVersionMatrix(nil))
+}
+
+func TestNodeStatsGPUProcesses(t *testing.T) {
+	node := &Node{
+		Accelerator: NVAccelerator,
+		Report: Report{
+			"node": map[string]interface{}{"hostname": "edge"},
+			"nodestats": map[string]interface{}{
+				"usage":    map[string]interface{}{"cpu": "1"},
+				"capacity": map[string]interface{}{"cpu": "2"},
+				"extension": map[string]interface{}{
+					"usedMemory":  512.0,
+					"totalMemory": 1024.0,
+					"processes": []interface{}{
+						map[string]interface{}{"pid": 100.0, "container": "infer", "usedMemory": 256.0},
+						map[string]interface{}{"pid": 101.0, "usedMemory": 128.0},
+					},
+				},
+			},
+		},
+	}
+	expected := []GPUProcess{
+		{PID: 100, Container: "infer", UsedMemory: 256},
+		{PID: 101, UsedMemory: 128},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	s := view.Report.NodeStats["edge"]
+	assert.Equal(t, expected, s.GPUProcessStats)
+	assert.Equal(t, expected, s.GPUProcesses())
+
+	raw := &NodeStats{Extension: map[string]interface{}{"processes": []interface{}{map[string]interface{}{"pid": 100.0, "container": "infer", "usedMemory": 256.0}}}}
+	assert.Equal(t, expected[:1], raw.GPUProcesses())
+
+	assert.Equal(t, []GPUProcess{}, (&NodeStats{}).GPUProcesses())
+	assert.Equal(t, []GPUProcess{}, (&NodeStats{Extension: map[string]interface{}{"usedMemory": 1.0}}).GPUProcesses())
+	assert.Equal(t, []GPUProcess{}, (&NodeStats{Extension: map[string]interface{}{"processes": "bad"}}).GPUProcesses())
+}
+
+func TestNodeCoerceAttributes(t *testing.T) {
+	n := &Node{Attributes: map[string]interface{}{
+		BaetylCoreAPIPort:   30050.0,
+		BaetylCoreFrequency: 20.0,
+		"custom":            1.5,
+	}}
+	assert.NoError(t, n.CoerceAttributes())
+	assert.Equal(t, map[string]interface{}{
+		BaetylCoreAPIPort:   30050,
+		BaetylCoreFrequency: "20s",
+		"custom":            1.5,
+	}, n.Attributes)
+	freq, ok := n.coreFrequency()
+	assert.True(t, ok)
+	assert.Equal(t, 20*time.Second, freq)
+
+	n.Attributes = map[string]interface{}{BaetylCoreAPIPort: "8080", BaetylCoreFrequency: "1m"}
+	assert.NoError(t, n.CoerceAttributes())
+	assert.Equal(t, map[string]interface{}{BaetylCoreAPIPort: 8080, BaetylCoreFrequency: "1m0s"}, n.Attributes)
+
+	n.Attributes = map[string]interface{}{BaetylCoreAPIPort: json.Number("443"), BaetylCoreFrequency: "30"}
+	assert.NoError(t, n.CoerceAttributes())
+	assert.Equal(t, map[string]interface{}{BaetylCoreAPIPort: 443, BaetylCoreFrequency: "30s"}, n.Attributes)
+
+	for _, attrs := range []map[string]interface{}{
+		{BaetylCoreAPIPort: 80.5},
+		{BaetylCoreAPIPort: 70000},
+		{BaetylCoreAPIPort: "http"},
+		{BaetylCoreAPIPort: true},
+		{BaetylCoreFrequency: "soon"},
+		{BaetylCoreFrequency: -1.0},
+		{BaetylCoreFrequency: []string{"20s"}},
+	} {
+		n.Attributes = map[string]interface{}{}
+		for k, v := range attrs {
+			n.Attributes[k] = v
+		}
+		err := n.CoerceAttributes()
+		assert.Error(t, err, "%v", attrs)
+		assert.True(t, IsMalformedInput(err), "%v", attrs)
+		assert.Equal(t, attrs, n.Attributes)
+	}
+
+	n.Attributes = map[string]interface{}{BaetylCoreAPIPort: 80.0, BaetylCoreFrequency: "soon"}
+	assert.EqualError(t, n.CoerceAttributes(), `attribute (BaetylCoreFrequency) is invalid: time: invalid duration "soon"`)
+	assert.Equal(t, 80.0, n.Attributes[BaetylCoreAPIPort])
+
+	n.Attributes = nil
+	assert.NoError(t, n.CoerceAttributes())
+}
+
+func TestReportViewAppResourceShare(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"time": time.Now().UTC(),
+			"node": map[string]interface{}{
+				"n1": map[string]interface{}{"hostname": "n1"},
+				"n2": map[string]interface{}{"hostname": "n2"},
+			},
+			"nodestats": map[string]interface{}{
+				"n1": map[string]interface{}{"usage": map[string]interface{}{"cpu": "1", "memory": "1Gi"}, "capacity": map[string]interface{}{"cpu": "4", "memory": "4Gi"}},
+				"n2": map[string]interface{}{"usage": map[string]interface{}{"cpu": "1"}, "capacity": map[string]interface{}{"cpu": "4", "memory": "4Gi"}},
+			},
+			"appstats": []interface{}{
+				map[string]interface{}{
+					"name": "a",
+					"instances": map[string]interface{}{
+						"a-1": map[string]interface{}{"name": "a-1", "nodeName": "n1", "usage": map[string]interface{}{"cpu": "500m", "memory": "256Mi"}},
+						"a-2": map[string]interface{}{"name": "a-2", "nodeName": "n2", "usage": map[string]interface{}{"cpu": "500m"}},
+					},
+				},
+				map[string]interface{}{"name": "idle"},
+			},
+			"sysappstats": []interface{}{
+				map[string]interface{}{
+					"name": "core",
+					"instances": map[string]interface{}{
+						"core-1": map[string]interface{}{"name": "core-1", "nodeName": "n1", "usage": map[string]interface{}{"cpu": "200m", "memory": "512Mi"}},
+					},
+				},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]float64{
+		"a":    {"cpu": 0.5, "memory": 0.25},
+		"idle": {"cpu": 0, "memory": 0},
+		"core": {"cpu": 0.1, "memory": 0.5},
+	}, view.Report.AppResourceShare())
+
+	view.Report.NodeStats = nil
+	assert.Equal(t, map[string]float64{"cpu": 0, "memory": 0}, view.Report.AppResourceShare()["a"])
+}
+
+func TestNodeViewTotalClusterPower(t *testing.T) {
+	node := &Node{
+		Report: Report{
+			"node": map[string]interface{}{
+				"n1": map[string]interface{}{"hostname": "n1"},
+				"n2": map[string]interface{}{"hostname": "n2"},
+			},
+			"nodestats": map[string]interface{}{
+				"n1": map[string]interface{}{"power": 12.5, "energy": 3600000.25, "usage": map[string]interface{}{"cpu": "1"}},
+				"n2": map[string]interface{}{"power": 7.5},
+			},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 12.5, view.Report.NodeStats["n1"].Power)
+	assert.Equal(t, 3600000.25, view.Report.NodeStats["n1"].Energy)
+	assert.Equal(t, 20.0, view.TotalClusterPower())
+	assert.Equal(t, 0.0, (&NodeView{}).TotalClusterPower())
+}
+
+func TestReportAppStatsRoundTrip(t *testing.T) {
+	createTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats := []AppStats{{
+		AppInfo: AppInfo{Name: "a", Version: "1"},
+		Status:  Running,
+		InstanceStats: map[string]InstanceStats{
+			"a-1": {Name: "a-1", Status: Running, CreateTime: createTime, Usage: map[string]string{"cpu": "1"}},
+		},
+	}}
+	r := Report{}
+	r.SetAppStats(false, stats)
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	var decoded Report
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, stats, decoded.AppStats(false))
+	assert.Nil(t, decoded.AppStats(true))
+
+	decoded["sysappstats"] = []interface{}{
+		"bad",
+		map[string]interface{}{"name": "core", "status": "Running"},
+		map[string]interface{}{"name": 1},
+		nil,
+	}
+	assert.Equal(t, []AppStats{{AppInfo: AppInfo{Name: "core"}, Status: Running}}, decoded.AppStats(true))
+	decoded["sysappstats"] = "bad"
+	assert.Nil(t, decoded.AppStats(true))
+}
+
+func TestReportViewNodesRunningApp(t *testing.T) {
+	view := &ReportView{
+		AppStats: []AppStats{
+			{
+				AppInfo: AppInfo{Name: "a"},
+				InstanceStats: map[string]InstanceStats{
+					"a-1": {NodeName: "n2"},
+					"a-2": {NodeName: "n1"},
+					"a-3": {NodeName: "n2"},
+					"a-4": {},
+				},
+			},
+			{AppInfo: AppInfo{Name: "b"}, InstanceStats: map[string]InstanceStats{"b-1": {NodeName: "n3"}}},
+		},
+		SysAppStats: []AppStats{
+			{AppInfo: AppInfo{Name: "core"}, InstanceStats: map[string]InstanceStats{"core-1": {NodeName: "n1"}}},
+		},
+	}
+	assert.Equal(t, []string{"n1", "n2"}, view.NodesRunningApp("a", false))
+	assert.Equal(t, []string{"n3"}, view.NodesRunningApp("b", false))
+	assert.Equal(t, []string{"n1"}, view.NodesRunningApp("core", true))
+	assert.Equal(t, []string{}, view.NodesRunningApp("core", false))
+	assert.Equal(t, []string{}, view.NodesRunningApp("missing", false))
+}
+
+func TestDesirePatchValidated(t *testing.T) {
+	d := Desire{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}}}
+	origin := Desire{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}}}
+
+	res, err := d.PatchValidated(Delta{"apps": []interface{}{
+		map[string]interface{}{"name": "a", "version": "2"},
+		map[string]interface{}{"name": "b", "version": "1"},
+	}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []AppInfo{{Name: "a", Version: "2"}, {Name: "b", Version: "1"}}, res.AppInfos(false))
+	assert.Equal(t, origin, d)
+
+	res, err = d.PatchValidated(Delta{"apps": []interface{}{
+		map[string]interface{}{"name": "a", "version": "2"},
+		map[string]interface{}{"name": "a", "version": "3"},
+	}}, nil)
+	assert.EqualError(t, err, "app (a) is duplicated in desire")
+	assert.Nil(t, res)
+	assert.Equal(t, origin, d)
+
+	deep := map[string]interface{}{}
+	cur := deep
+	for i := 0; i < maxJSONLevel; i++ {
+		next := map[string]interface{}{}
+		cur["a"] = next
+		cur = next
+	}
+	cur["a"] = "b"
+	_, err = d.PatchValidated(Delta(deep), nil)
+	assert.EqualError(t, err, ErrJSONLevelExceedsLimit.Error())
+	assert.Equal(t, origin, d)
+
+	rejected := errors.New("rejected")
+	_, err = d.PatchValidated(Delta{"name": "x"}, func(Desire) error { return rejected })
+	assert.True(t, errors.Is(err, rejected))
+	assert.Equal(t, origin, d)
+}
+
+func TestAppStatsTimeToReady(t *testing.T) {
+	deploy := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := deploy.Add(10 * time.Second)
+	t2 := deploy.Add(time.Minute)
+	stats := &AppStats{
+		AppInfo: AppInfo{Name: "a"},
+		InstanceStats: map[string]InstanceStats{
+			"a-1": {Status: Running, ReadyTime: &t1},
+			"a-2": {Status: Pending},
+		},
+	}
+	_, ok := stats.TimeToReady(deploy)
+	assert.False(t, ok)
+
+	stats.InstanceStats["a-2"] = InstanceStats{Status: Running}
+	_, ok = stats.TimeToReady(deploy)
+	assert.False(t, ok)
+
+	stats.InstanceStats["a-2"] = InstanceStats{Status: Running, ReadyTime: &t2}
+	d, ok := stats.TimeToReady(deploy)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+
+	_, ok = (&AppStats{}).TimeToReady(deploy)
+	assert.False(t, ok)
+
+	var decoded AppStats
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":"a","instances":{"a-1":{"status":"Running","readyTime":"2021-01-01T00:00:30Z"}}}`), &decoded))
+	d, ok = decoded.TimeToReady(deploy)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, d)
+}
+
+func TestNodeViewTimeFormatReadyTime(t *testing.T) {
+	readyTime := time.Date(2021, 1, 1, 0, 0, 30, 0, time.UTC)
+	view := &NodeView{
+		Report: &ReportView{AppStats: []AppStats{{
+			AppInfo:       AppInfo{Name: "a"},
+			InstanceStats: map[string]InstanceStats{"a-1": {Name: "a-1", ReadyTime: &readyTime}},
+		}}},
+		timeFormat: TimeFormatEpochMillis,
+	}
+	data, err := json.Marshal(view)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"readyTime":1609459230000`)
+}
+
+func TestAccessorsNilAndEmpty(t *testing.T) {
+	for _, data := range []map[string]interface{}{nil, {}, {"apps": nil, "sysapps": nil, "appstats": nil, "sysappstats": nil, "devices": nil}, {"apps": "x", "sysapps": 1, "appstats": []string{}, "sysappstats": true, "devices": map[string]interface{}{}}} {
+		r, d := Report(data), Desire(data)
+		assert.Nil(t, r.AppInfos(false))
+		assert.Nil(t, r.AppInfos(true))
+		assert.Nil(t, r.AppStats(false))
+		assert.Nil(t, r.AppStats(true))
+		assert.Nil(t, r.DeviceInfos())
+		assert.Nil(t, d.AppInfos(false))
+		assert.Nil(t, d.AppInfos(true))
+		assert.Nil(t, d.AppStats(false))
+		assert.Nil(t, d.AppStats(true))
+		assert.Nil(t, d.DeviceInfos())
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"apps": []interface{}{}, "sysapps": []interface{}{}, "appstats": []interface{}{}, "sysappstats": []interface{}{}, "devices": []interface{}{}},
+		{"apps": []AppInfo{}, "sysapps": []AppInfo{}, "appstats": []AppStats{}, "sysappstats": []AppStats{}, "devices": []DeviceInfo{}},
+		{"apps": []AppInfo(nil), "sysapps": []AppInfo(nil), "appstats": []AppStats(nil), "sysappstats": []AppStats(nil), "devices": []DeviceInfo(nil)},
+		{"apps": []interface{}{"x"}, "sysapps": []interface{}{nil}, "appstats": []interface{}{1}, "sysappstats": []interface{}{nil}, "devices": []interface{}{"x"}},
+	} {
+		r, d := Report(data), Desire(data)
+		assert.Equal(t, []AppInfo{}, r.AppInfos(false))
+		assert.Equal(t, []AppInfo{}, r.AppInfos(true))
+		assert.Equal(t, []AppStats{}, r.AppStats(false))
+		assert.Equal(t, []AppStats{}, r.AppStats(true))
+		assert.Equal(t, []DeviceInfo{}, r.DeviceInfos())
+		assert.Equal(t, []AppInfo{}, d.AppInfos(false))
+		assert.Equal(t, []AppInfo{}, d.AppInfos(true))
+		assert.Equal(t, []AppStats{}, d.AppStats(false))
+		assert.Equal(t, []AppStats{}, d.AppStats(true))
+		assert.Equal(t, []DeviceInfo{}, d.DeviceInfos())
+	}
+
+	r := Report{
+		"apps":    []interface{}{nil, map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b", "version": "1"}},
+		"devices": []interface{}{map[string]interface{}{"name": "d", "version": 1}},
+	}
+	assert.Equal(t, []AppInfo{{Name: "a"}, {Name: "b", Version: "1"}}, r.AppInfos(false))
+	assert.Equal(t, []DeviceInfo{{Name: "d"}}, r.DeviceInfos())
+}
+
+func TestMigrateReport(t *testing.T) {
+	single := Report{
+		"node":      map[string]interface{}{"hostname": "edge", "os": "linux"},
+		"nodestats": map[string]interface{}{"usage": map[string]interface{}{"cpu": "1"}},
+	}
+	assert.Equal(t, "0.0", single.SchemaVersion())
+	res, err := MigrateReport("0.0", ReportSchemaVersion, single)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*NodeInfo{"edge": {Hostname: "edge", OS: "linux", Role: NodeRoleMaster}}, res["node"])
+	assert.Equal(t, map[string]*NodeStats{"edge": {Usage: map[string]string{"cpu": "1"}}}, res["nodestats"])
+	assert.Equal(t, map[string]interface{}{"hostname": "edge", "os": "linux"}, single["node"])
+
+	RegisterReportMigration("1.0", "1.1", func(r Report) (Report, error) {
+		res := Report(copyMap(r))
+		res["migrated"] = true
+		res.SetSchemaVersion("1.1")
+		return res, nil
+	})
+	RegisterReportMigration("1.1", "1.2", func(r Report) (Report, error) {
+		return nil, errors.New("broken")
+	})
+	defer func() {
+		reportMigrations.Lock()
+		delete(reportMigrations.steps, "1.0")
+		delete(reportMigrations.steps, "1.1")
+		reportMigrations.Unlock()
+	}()
+
+	res, err = MigrateReport("0.0", "1.1", single)
+	assert.NoError(t, err)
+	assert.Equal(t, true, res["migrated"])
+	assert.Equal(t, "1.1", res.SchemaVersion())
+	assert.Len(t, res["node"], 1)
+	assert.NotContains(t, single, "migrated")
+
+	_, err = MigrateReport("0.0", "1.2", single)
+	assert.EqualError(t, err, "broken")
+	_, err = MigrateReport("0.0", "3.0", single)
+	assert.EqualError(t, err, "no report migration registered from version (1.2) to (3.0)")
+	_, err = MigrateReport("0.5", "1.0", single)
+	assert.EqualError(t, err, "no report migration registered from version (0.5) to (1.0)")
+
+	res, err = MigrateReport("1.0", "1.0", single)
+	assert.NoError(t, err)
+	assert.Equal(t, single, res)
+	// the report of newer or unknown newer version passes through
+	res, err = MigrateReport("2.0", "1.0", single)
+	assert.NoError(t, err)
+	assert.Equal(t, single, res)
+	res, err = MigrateReport("1.5", "1.2", single)
+	assert.NoError(t, err)
+	assert.Equal(t, single, res)
+
+	// the report with current version is not migrated by the view
+	node := &Node{Report: Report{"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}}}}
+	node.Report.SetSchemaVersion(ReportSchemaVersion)
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*NodeInfo{"edge": {Hostname: "edge"}}, view.Report.Node)
+
+	// the schema version of node takes precedence over the one of report
+	node = &Node{Report: single, SchemaVersion: ReportSchemaVersion}
+	res, err = node.compatibleSingleNode()
+	assert.NoError(t, err)
+	assert.Equal(t, single, res)
+	node.SchemaVersion = "0.5"
+	_, err = node.compatibleSingleNode()
+	assert.EqualError(t, err, "no report migration registered from version (0.5) to (1.0)")
+	node.SchemaVersion = ""
+	res, err = node.compatibleSingleNode()
+	assert.NoError(t, err)
+	assert.Len(t, res["node"], 1)
+	assert.Contains(t, res["node"], "edge")
+}
+
+func TestReportViewStuckApps(t *testing.T) {
+	now := time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)
+	long := now.Add(-time.Hour)
+	short := now.Add(-time.Minute)
+	view := &ReportView{
+		AppStats: []AppStats{
+			{AppInfo: AppInfo{Name: "a"}, Status: Pending, StatusSince: &long},
+			{AppInfo: AppInfo{Name: "b"}, Status: Pending, StatusSince: &short},
+			{AppInfo: AppInfo{Name: "c"}, Status: Running, StatusSince: &long},
+			{AppInfo: AppInfo{Name: "d"}, Status: Failed, StatusSince: &long},
+			{AppInfo: AppInfo{Name: "e"}, Status: Pending},
+			{AppInfo: AppInfo{Name: "f"}, StatusSince: &long},
+		},
+		SysAppStats: []AppStats{
+			{AppInfo: AppInfo{Name: "core"}, Status: Unknown, StatusSince: &long},
+		},
+	}
+	stuck := view.StuckApps(10*time.Minute, now)
+	assert.Len(t, stuck, 2)
+	assert.Equal(t, "a", stuck[0].Name)
+	assert.Equal(t, "core", stuck[1].Name)
+	assert.Len(t, view.StuckApps(30*time.Second, now), 3)
+	assert.Nil(t, view.StuckApps(2*time.Hour, now))
+
+	assert.True(t, Running.IsTerminal())
+	assert.True(t, Failed.IsTerminal())
+	assert.False(t, Pending.IsTerminal())
+	assert.False(t, Unknown.IsTerminal())
+}
+
+func TestAppStatsTotalLogBytes(t *testing.T) {
+	stats := &AppStats{}
+	assert.Equal(t, int64(0), stats.TotalLogBytes())
+
+	stats.InstanceStats = map[string]InstanceStats{
+		"i1": {Name: "i1", Container: &ServiceInfo{Name: "c1", LogBytes: 1024}},
+		"i2": {Name: "i2", Container: &ServiceInfo{Name: "c2", LogBytes: 2048}},
+		"i3": {Name: "i3"},
+	}
+	assert.Equal(t, int64(3072), stats.TotalLogBytes())
+
+	data, err := json.Marshal(stats.InstanceStats["i1"].Container)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"c1","logBytes":1024}`, string(data))
+}
+
+func TestDeltaValidateKnownKeys(t *testing.T) {
+	allowed := []string{KeyApps, KeySysApps, KeyDevices, KeyNodeProps}
+	assert.Nil(t, Delta{}.ValidateKnownKeys(allowed))
+	assert.Nil(t, Delta{KeyApps: []interface{}{}, KeyNodeProps: nil}.ValidateKnownKeys(allowed))
+
+	delta := Delta{KeyApps: []interface{}{}, "sysaps": nil, "devcies": map[string]interface{}{}}
+	assert.Equal(t, []string{"devcies", "sysaps"}, delta.ValidateKnownKeys(allowed))
+	assert.Equal(t, []string{KeyApps, "devcies", "sysaps"}, delta.ValidateKnownKeys(nil))
+}
+
+func TestAppStatsDerivedStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats AppStats
+		want  Status
+	}{
+		{name: "empty", stats: AppStats{}, want: Unknown},
+		{name: "reported-only", stats: AppStats{Status: Pending}, want: Pending},
+		{name: "app-failed", stats: AppStats{Status: Failed, InstanceStats: map[string]InstanceStats{"i1": {Status: Running}}}, want: Failed},
+		{name: "instance-failed", stats: AppStats{Status: Running, InstanceStats: map[string]InstanceStats{"i1": {Status: Running}, "i2": {Status: Failed}}}, want: Failed},
+		{name: "all-running", stats: AppStats{InstanceStats: map[string]InstanceStats{"i1": {Status: Running}, "i2": {Status: Running}}}, want: Running},
+		{name: "partly-running", stats: AppStats{Status: Running, InstanceStats: map[string]InstanceStats{"i1": {Status: Running}, "i2": {Status: Pending}}}, want: Pending},
+		{name: "replicas-short", stats: AppStats{AppInfo: AppInfo{Replicas: 3}, InstanceStats: map[string]InstanceStats{"i1": {Status: Running}}}, want: Pending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.stats.DerivedStatus())
+		})
+	}
+}
+
+func TestReportViewAppHealthSummary(t *testing.T) {
+	view := &ReportView{}
+	sum := view.AppHealthSummary()
+	assert.Equal(t, AppHealthSummary{}, sum)
+	assert.True(t, sum.AllHealthy())
+
+	view = &ReportView{
+		AppStats: []AppStats{
+			{AppInfo: AppInfo{Name: "a"}, InstanceStats: map[string]InstanceStats{"i1": {Status: Running}}},
+			{AppInfo: AppInfo{Name: "b"}, InstanceStats: map[string]InstanceStats{"i1": {Status: Running}, "i2": {Status: Pending}}},
+			{AppInfo: AppInfo{Name: "c"}, Status: Failed},
+			{AppInfo: AppInfo{Name: "d"}},
+		},
+		SysAppStats: []AppStats{{AppInfo: AppInfo{Name: "core"}, Status: Failed}},
+	}
+	sum = view.AppHealthSummary()
+	assert.Equal(t, AppHealthSummary{Total: 4, Healthy: 1, Degraded: 1, Failed: 1, Unknown: 1}, sum)
+	assert.False(t, sum.AllHealthy())
+}
+
+func TestInstanceStatsSchedulingLatency(t *testing.T) {
+	scheduled := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	started := scheduled.Add(1500 * time.Millisecond)
+
+	ins := &InstanceStats{}
+	_, ok := ins.SchedulingLatency()
+	assert.False(t, ok)
+	ins.ScheduledTime = &scheduled
+	_, ok = ins.SchedulingLatency()
+	assert.False(t, ok)
+	ins.StartTime = &started
+	latency, ok := ins.SchedulingLatency()
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, latency)
+	ins.ScheduledTime, ins.StartTime = &started, &scheduled
+	_, ok = ins.SchedulingLatency()
+	assert.False(t, ok)
+
+	view := &NodeView{
+		Report: &ReportView{AppStats: []AppStats{{
+			AppInfo:       AppInfo{Name: "a"},
+			InstanceStats: map[string]InstanceStats{"a-1": {Name: "a-1", ScheduledTime: &scheduled, StartTime: &started}},
+		}}},
+		timeFormat: TimeFormatEpochMillis,
+	}
+	data, err := json.Marshal(view)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"scheduledTime":1609459200000`)
+	assert.Contains(t, string(data), `"startTime":1609459201500`)
+}
+
+func TestNodeViewPercentPrecision(t *testing.T) {
+	node := &Node{
+		Name: "baetyl",
+		Report: Report{
+			"time": time.Now().UTC(),
+			"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}},
+			"nodestats": map[string]interface{}{"edge": map[string]interface{}{
+				"usage":    map[string]interface{}{"cpu": "1", "memory": "1Gi"},
+				"capacity": map[string]interface{}{"cpu": "3", "memory": "4Gi"},
+			}},
+		},
+	}
+
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	stats := view.Report.NodeStats["edge"]
+	assert.Equal(t, "0.3333333333333333", stats.Percent["cpu"])
+	assert.Equal(t, "0.25", stats.Percent["memory"])
+
+	view, err = node.ViewWithOptions(&NodeViewOptions{Timeout: time.Minute, PercentPrecision: 4})
+	assert.NoError(t, err)
+	stats = view.Report.NodeStats["edge"]
+	assert.Equal(t, "0.3333", stats.Percent["cpu"])
+	assert.Equal(t, "0.2500", stats.Percent["memory"])
+
+	s := &NodeStats{Percent: map[string]string{"gpu": "x", "disk": "0"}}
+	s.formatPercent(2)
+	assert.Equal(t, map[string]string{"gpu": "x", "disk": "0.00"}, s.Percent)
+}
+
+func TestDiffNodeViews(t *testing.T) {
+	old := &NodeView{
+		Name:   "baetyl",
+		Ready:  true,
+		Labels: map[string]string{"a": "1", "b": "2"},
+		Report: &ReportView{NodeStats: map[string]*NodeStats{"edge": {Usage: map[string]string{"cpu": "1"}}}},
+	}
+	delta, err := DiffNodeViews(old, old)
+	assert.NoError(t, err)
+	assert.Empty(t, delta)
+
+	new := &NodeView{
+		Name:   "baetyl",
+		Labels: map[string]string{"a": "1", "c": "3"},
+		Report: &ReportView{NodeStats: map[string]*NodeStats{"edge": {Usage: map[string]string{"cpu": "2"}}}},
+	}
+	delta, err = DiffNodeViews(old, new)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"ready":  false,
+		"labels": map[string]interface{}{"b": nil, "c": "3"},
+		"report": map[string]interface{}{"nodestats": map[string]interface{}{"edge": map[string]interface{}{"usage": map[string]interface{}{"cpu": "2"}}}},
+	}, delta)
+
+	delta, err = DiffNodeViews(nil, &NodeView{Name: "baetyl"})
+	assert.NoError(t, err)
+	assert.Equal(t, "baetyl", delta["name"])
+	delta, err = DiffNodeViews(nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, delta)
+}
+
+func TestErrorCategories(t *testing.T) {
+	_, err := (&Node{Report: Report{"node": "master"}}).View(WithReadyTimeout(time.Minute))
+	assert.True(t, IsMalformedInput(err))
+	assert.False(t, IsInternal(err))
+	var shapeErr *ReportShapeError
+	assert.True(t, errors.As(err, &shapeErr))
+
+	old := Report{"1": map[string]interface{}{"2": map[string]interface{}{"3": map[string]interface{}{"4": map[string]interface{}{"5": map[string]interface{}{"6": "y"}}}}}}
+	deep := Report{"1": map[string]interface{}{"2": map[string]interface{}{"3": map[string]interface{}{"4": map[string]interface{}{"5": map[string]interface{}{"6": "x"}}}}}}
+	err = old.Merge(deep)
+	assert.True(t, IsMalformedInput(err))
+	assert.EqualError(t, err, ErrJSONLevelExceedsLimit.Error())
+
+	_, err = Report{"a": 1}.Patch(Delta{"b": make(chan int)})
+	assert.True(t, IsMalformedInput(err))
+	_, err = Desire{"a": make(chan int)}.Diff(Report{})
+	assert.True(t, IsMalformedInput(err))
+	_, err = Desire{"a": make(chan int)}.DiffPrecise(Report{})
+	assert.True(t, IsMalformedInput(err))
+	_, err = Report{"a": 1}.Patch(Delta{})
+	assert.NoError(t, err)
+
+	err = internal(errors.New("broken"))
+	assert.True(t, IsInternal(err))
+	assert.False(t, IsMalformedInput(err))
+	assert.EqualError(t, err, "broken")
+	assert.True(t, IsInternal(malformed(err)))
+	assert.Nil(t, malformed(nil))
+	assert.False(t, IsMalformedInput(errors.New("broken")))
+	assert.False(t, IsInternal(nil))
+
+	plain := &categorizedError{err: errors.New("plain"), category: ErrInternal}
+	assert.Equal(t, "plain", fmt.Sprintf("%+v", plain))
+	assert.Equal(t, "plain", fmt.Sprintf("%s", plain))
+}
+
+func TestNodeViewAllocatable(t *testing.T) {
+	node := &Node{
+		Name: "baetyl",
+		Report: Report{
+			"time": time.Now().UTC(),
+			"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}},
+			"nodestats": map[string]interface{}{"edge": map[string]interface{}{
+				"usage":       map[string]interface{}{"cpu": "1", "memory": "1Gi"},
+				"capacity":    map[string]interface{}{"cpu": "4", "memory": "4Gi"},
+				"allocatable": map[string]interface{}{"cpu": "2000m"},
+			}},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	stats := view.Report.NodeStats["edge"]
+	assert.Equal(t, map[string]string{"cpu": "2"}, stats.Allocatable)
+	assert.Equal(t, "4", stats.Capacity["cpu"])
+	assert.Equal(t, "0.5", stats.Percent["cpu"])
+	assert.Equal(t, "0.25", stats.Percent["memory"])
+
+	node.Report["nodestats"].(map[string]interface{})["edge"].(map[string]interface{})["allocatable"] = map[string]interface{}{"memory": "x"}
+	_, err = node.View(WithReadyTimeout(time.Minute))
+	assert.Error(t, err)
+	assert.True(t, IsMalformedInput(err))
+}
+
+func TestReportWritePrometheus(t *testing.T) {
+	r := Report{
+		"time": time.Now().UTC(),
+		"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}},
+		"nodestats": map[string]interface{}{"edge": map[string]interface{}{
+			"usage":    map[string]interface{}{"cpu": "500m", "memory": "1Gi"},
+			"capacity": map[string]interface{}{"cpu": "2", "memory": "4Gi"},
+		}},
+		"appstats": []AppStats{{
+			AppInfo:       AppInfo{Name: "a"},
+			InstanceStats: map[string]InstanceStats{"a-1": {Name: "a-1"}, "a-2": {Name: "a-2"}},
+		}},
+		"sysappstats": []AppStats{{AppInfo: AppInfo{Name: "core"}}},
+	}
+	buf := &bytes.Buffer{}
+	assert.NoError(t, r.WritePrometheus(buf, map[string]string{"baetyl-node": "n1", "region": "a\"b"}))
+	assert.Equal(t, `# HELP baetyl_node_resource_usage The resource usage of node, cpu in cores and memory in bytes.
+# TYPE baetyl_node_resource_usage gauge
+baetyl_node_resource_usage{baetyl_node="n1",region="a\"b",node="edge",resource="cpu"} 0.5
+baetyl_node_resource_usage{baetyl_node="n1",region="a\"b",node="edge",resource="memory"} 1073741824
+# HELP baetyl_node_resource_capacity The resource capacity of node, cpu in cores and memory in bytes.
+# TYPE baetyl_node_resource_capacity gauge
+baetyl_node_resource_capacity{baetyl_node="n1",region="a\"b",node="edge",resource="cpu"} 2
+baetyl_node_resource_capacity{baetyl_node="n1",region="a\"b",node="edge",resource="memory"} 4294967296
+# HELP baetyl_node_resource_percent The resource percent of node in [0,1].
+# TYPE baetyl_node_resource_percent gauge
+baetyl_node_resource_percent{baetyl_node="n1",region="a\"b",node="edge",resource="cpu"} 0.25
+baetyl_node_resource_percent{baetyl_node="n1",region="a\"b",node="edge",resource="memory"} 0.25
+# HELP baetyl_app_instances The number of instances of app.
+# TYPE baetyl_app_instances gauge
+baetyl_app_instances{baetyl_node="n1",region="a\"b",app="a",system="false"} 2
+baetyl_app_instances{baetyl_node="n1",region="a\"b",app="core",system="true"} 0
+`, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, Report{}.WritePrometheus(buf, nil))
+	assert.Contains(t, buf.String(), "# TYPE baetyl_app_instances gauge\n")
+	assert.True(t, IsMalformedInput(Report{"node": "x"}.WritePrometheus(buf, nil)))
+
+	for _, labels := range []map[string]string{
+		{"node": "n1"},
+		{"app": "a"},
+		{"resource": "cpu"},
+		{"system": "true"},
+		{"__name__": "x"},
+		{"": "x"},
+		{"baetyl-node": "n1", "baetyl_node": "n2"},
+	} {
+		buf.Reset()
+		err := r.WritePrometheus(buf, labels)
+		assert.True(t, IsMalformedInput(err), "%v", labels)
+		assert.Empty(t, buf.String())
+	}
+}
+
+func TestReportDisconnectedDevices(t *testing.T) {
+	now := time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)
+	var r Report
+	assert.NoError(t, json.Unmarshal([]byte(`{"devices":[
+		{"name":"d1","version":"1","status":"connected","lastSeen":"2021-01-01T00:59:30Z"},
+		{"name":"d2","status":"connected","lastSeen":"2021-01-01T00:50:00Z"},
+		{"name":"d3","status":"disconnected"},
+		{"name":"d4","version":"2"},
+		{"name":"d5","lastSeen":"invalid"}
+	]}`), &r))
+	devs := r.DeviceInfos()
+	assert.Len(t, devs, 5)
+	assert.Equal(t, DeviceConnected, devs[0].Status)
+	assert.Equal(t, time.Date(2021, 1, 1, 0, 59, 30, 0, time.UTC), *devs[0].LastSeen)
+	assert.Equal(t, DeviceInfo{Name: "d4", Version: "2"}, devs[3])
+	assert.Nil(t, devs[4].LastSeen)
+
+	disconnected := r.DisconnectedDevices(now, time.Minute)
+	assert.Len(t, disconnected, 2)
+	assert.Equal(t, "d2", disconnected[0].Name)
+	assert.Equal(t, "d3", disconnected[1].Name)
+	assert.Len(t, r.DisconnectedDevices(now, time.Hour), 1)
+
+	seen := now.Add(-2 * time.Minute)
+	r.SetDeviceInfos([]DeviceInfo{{Name: "d6", LastSeen: &seen}})
+	assert.Len(t, r.DisconnectedDevices(now, time.Minute), 1)
+	assert.Nil(t, Report{}.DisconnectedDevices(now, time.Minute))
+}
+
+func TestNodeDeepCopy(t *testing.T) {
+	assert.Nil(t, (*Node)(nil).DeepCopy())
+	assert.Nil(t, Report(nil).DeepCopy())
+	assert.Nil(t, Desire(nil).DeepCopy())
+
+	type custom struct {
+		Values []int
+	}
+	now := time.Now().UTC()
+	n := &Node{
+		Name:       "baetyl",
+		Labels:     map[string]string{"a": "1"},
+		Attributes: map[string]interface{}{"nested": map[string]interface{}{"k": "v"}, "custom": &custom{Values: []int{1}}},
+		SysApps:    []string{"core"},
+		Report: Report{
+			"time": now,
+			"node": map[string]*NodeInfo{"edge": {Hostname: "edge", Labels: map[string]string{"role": "master"}}},
+			"nodestats": map[string]*NodeStats{"edge": {Usage: map[string]string{"cpu": "1"}, Time: &now,
+				Extension: map[string]interface{}{"gpu": []interface{}{map[string]interface{}{"id": "0"}}}}},
+			"appstats": []AppStats{{
+				AppInfo:       AppInfo{Name: "a", Refs: []string{"cfg"}},
+				InstanceStats: map[string]InstanceStats{"a-1": {Name: "a-1", Usage: map[string]string{"cpu": "1"}, Container: &ServiceInfo{Name: "c", ExitInfo: &ExitInfo{ExitCode: 1}}}},
+			}},
+			"devices": []DeviceInfo{{Name: "d1", LastSeen: &now}},
+			"empty":   map[string]interface{}(nil),
+		},
+		Desire: Desire{"apps": []AppInfo{{Name: "a", Version: "1"}}},
+	}
+	c := n.DeepCopy()
+	assert.Equal(t, n, c)
+	assert.Nil(t, c.Annotations)
+	assert.Nil(t, c.Report["empty"])
+
+	c.Labels["a"] = "2"
+	c.Attributes["nested"].(map[string]interface{})["k"] = "x"
+	c.Attributes["custom"].(*custom).Values[0] = 2
+	c.SysApps[0] = "x"
+	c.Report["node"].(map[string]*NodeInfo)["edge"].Labels["role"] = "worker"
+	stats := c.Report["nodestats"].(map[string]*NodeStats)["edge"]
+	stats.Usage["cpu"] = "2"
+	stats.Extension.(map[string]interface{})["gpu"].([]interface{})[0].(map[string]interface{})["id"] = "1"
+	*stats.Time = now.Add(time.Hour)
+	app := c.Report["appstats"].([]AppStats)[0]
+	app.Refs[0] = "x"
+	app.InstanceStats["a-1"].Usage["cpu"] = "2"
+	app.InstanceStats["a-1"].Container.ExitInfo.ExitCode = 2
+	*c.Report["devices"].([]DeviceInfo)[0].LastSeen = now.Add(time.Hour)
+	c.Desire["apps"].([]AppInfo)[0].Version = "2"
+
+	assert.Equal(t, "1", n.Labels["a"])
+	assert.Equal(t, "v", n.Attributes["nested"].(map[string]interface{})["k"])
+	assert.Equal(t, 1, n.Attributes["custom"].(*custom).Values[0])
+	assert.Equal(t, "core", n.SysApps[0])
+	assert.Equal(t, "master", n.Report["node"].(map[string]*NodeInfo)["edge"].Labels["role"])
+	orig := n.Report["nodestats"].(map[string]*NodeStats)["edge"]
+	assert.Equal(t, "1", orig.Usage["cpu"])
+	assert.Equal(t, "0", orig.Extension.(map[string]interface{})["gpu"].([]interface{})[0].(map[string]interface{})["id"])
+	assert.Equal(t, now, *orig.Time)
+	origApp := n.Report["appstats"].([]AppStats)[0]
+	assert.Equal(t, "cfg", origApp.Refs[0])
+	assert.Equal(t, "1", origApp.InstanceStats["a-1"].Usage["cpu"])
+	assert.Equal(t, int32(1), origApp.InstanceStats["a-1"].Container.ExitInfo.ExitCode)
+	assert.Equal(t, now, *n.Report["devices"].([]DeviceInfo)[0].LastSeen)
+	assert.Equal(t, "1", n.Desire["apps"].([]AppInfo)[0].Version)
+}
+
+func TestSyncReportAndDesire(t *testing.T) {
+	var sr SyncReport
+	assert.Nil(t, sr.AppInfos(false))
+	assert.NoError(t, sr.Merge(Report{"name": "module"}))
+	apps := []AppInfo{{Name: "a", Version: "1"}}
+	sr.SetAppInfos(false, apps)
+	apps[0].Version = "2"
+	assert.Equal(t, []AppInfo{{Name: "a", Version: "1"}}, sr.AppInfos(false))
+	got := sr.AppInfos(false)
+	got[0].Version = "3"
+	assert.Equal(t, "1", sr.AppInfos(false)[0].Version)
+
+	sr.SetAppStats(true, []AppStats{{AppInfo: AppInfo{Name: "core"}}})
+	assert.Equal(t, "core", sr.AppStats(true)[0].Name)
+	sr.SetDeviceInfos([]DeviceInfo{{Name: "d"}})
+	assert.Equal(t, []DeviceInfo{{Name: "d"}}, sr.DeviceInfos())
+	patched, err := sr.Patch(Delta{"name": "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, "x", patched["name"])
+
+	r := sr.Unwrap()
+	assert.Equal(t, "module", r["name"])
+	r["name"] = "y"
+	assert.Equal(t, "module", sr.Unwrap()["name"])
+
+	origin := Report{"name": "module"}
+	sr2 := NewSyncReport(origin)
+	origin["name"] = "x"
+	assert.Equal(t, Report{"name": "module"}, sr2.Unwrap())
+
+	sd := NewSyncDesire(Desire{"apps": []AppInfo{{Name: "a", Version: "1"}}})
+	delta, err := sd.Diff(Report{"apps": []AppInfo{{Name: "a", Version: "0"}}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, delta)
+	delta2, err := sd.DiffWithNil(Report{"apps": []AppInfo{{Name: "a", Version: "1"}}, "x": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, Delta{"x": nil}, delta2)
+	assert.NoError(t, sd.Merge(Desire{"sysapps": []AppInfo{{Name: "core"}}}))
+	assert.Equal(t, "core", sd.AppInfos(true)[0].Name)
+	d, err := sd.Patch(Delta{"name": "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, "x", d["name"])
+	assert.Nil(t, sd.Unwrap()["name"])
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				assert.NoError(t, sr.Merge(Report{"n": j}))
+				sr.SetAppInfos(false, []AppInfo{{Name: "a", Version: strconv.Itoa(i)}})
+				sr.AppInfos(false)
+				sr.Unwrap()
+				sd.SetDeviceInfos([]DeviceInfo{{Name: "d"}})
+				_, _ = sd.Diff(Report{})
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMergeOptionWithMaxDepth(t *testing.T) {
+	nested := func(levels int, leaf string) map[string]interface{} {
+		m := map[string]interface{}{"v": leaf}
+		for i := levels; i > 1; i-- {
+			m = map[string]interface{}{strconv.Itoa(i): m}
+		}
+		return m
+	}
+
+	old, deep := Report(nested(7, "y")), Report(nested(7, "x"))
+	err := old.Merge(deep)
+	assert.EqualError(t, err, ErrJSONLevelExceedsLimit.Error())
+	assert.True(t, errors.Is(err, ErrJSONLevelExceedsLimit))
+	assert.NoError(t, old.Merge(deep, WithMaxDepth(8)))
+	assert.Equal(t, deep, old)
+	err = old.Merge(Report(nested(7, "z")), WithMaxDepth(6))
+	assert.EqualError(t, err, "the level of json exceeds the max limit (6)")
+	assert.True(t, errors.Is(err, ErrJSONLevelExceedsLimit))
+	assert.True(t, IsMalformedInput(err))
+	// the failed merge modifies nothing
+	assert.Equal(t, deep, old)
+	// the default limit is reached by merging the objects at level 5 as before
+	assert.True(t, errors.Is(Report(nested(maxJSONLevel, "y")).Merge(Report(nested(maxJSONLevel, "x"))), ErrJSONLevelExceedsLimit))
+	assert.NoError(t, Report(nested(maxJSONLevel-1, "y")).Merge(Report(nested(maxJSONLevel-1, "x"))))
+
+	d := Desire(nested(7, "x"))
+	assert.NoError(t, d.Merge(Desire(nested(7, "z")), WithMaxDepth(8)))
+	assert.Error(t, Desire(nested(7, "x")).Merge(Desire(nested(7, "z"))))
+
+	delta, err := Desire(nested(7, "x")).Diff(Report(nested(7, "y")))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, delta)
+	_, err = Desire(nested(7, "x")).Diff(Report(nested(7, "y")), WithMaxDepth(6))
+	assert.EqualError(t, err, "the level of json exceeds the max limit (6)")
+	_, err = Desire(nested(7, "x")).Diff(Report{}, WithMaxDepth(7))
+	assert.NoError(t, err)
+	_, err = Desire(nested(7, "x")).DiffWithNil(Report{}, WithMaxDepth(6))
+	assert.True(t, errors.Is(err, ErrJSONLevelExceedsLimit))
+
+	_, err = Report{}.Patch(Delta(nested(7, "x")))
+	assert.NoError(t, err)
+	_, err = Report{}.Patch(Delta(nested(7, "x")), WithMaxDepth(6))
+	assert.True(t, errors.Is(err, ErrJSONLevelExceedsLimit))
+	_, err = Desire{}.Patch(Delta(nested(7, "x")), WithMaxDepth(7))
+	assert.NoError(t, err)
+}
+
+func TestNodeViewVendorAccelerators(t *testing.T) {
+	newNode := func(accelerator string, extension map[string]interface{}) *Node {
+		return &Node{
+			Name:        "baetyl",
+			Accelerator: accelerator,
+			Report: Report{
+				"nodestats": map[string]interface{}{
+					"edge": map[string]interface{}{
+						"usage":     map[string]interface{}{"cpu": "1", "memory": "512Mi"},
+						"capacity":  map[string]interface{}{"cpu": "2", "memory": "1024Mi"},
+						"extension": extension,
+					},
+				},
+			},
+		}
+	}
+
+	view, err := newNode(AMDAccelerator, map[string]interface{}{KeyAMDGPUUsedMemory: 1024, KeyAMDGPUTotalMemory: 4096, KeyAMDGPUCount: 2}).View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	stats := view.Report.NodeStats["edge"]
+	assert.Equal(t, "1073741824", stats.Usage[ResourceGPU])
+	assert.Equal(t, "4294967296", stats.Capacity[ResourceGPU])
+	assert.Equal(t, "0.25", stats.Percent[ResourceGPU])
+	count, memory, ok := stats.GPUCapacity()
+	assert.True(t, ok)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, int64(4294967296), memory)
+
+	amd := view.AcceleratorUsage()
+
+	// the memory of all vendors is in bytes, so the usages are comparable
+	view, err = newNode(NVAccelerator, map[string]interface{}{KeyGPUUsedMemory: 1073741824, KeyGPUTotalMemory: json.Number("4294967296")}).View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	stats = view.Report.NodeStats["edge"]
+	assert.Equal(t, "1073741824", stats.Usage[ResourceGPU])
+	assert.Equal(t, "4294967296", stats.Capacity[ResourceGPU])
+	assert.Equal(t, "0.25", stats.Percent[ResourceGPU])
+	assert.Equal(t, amd, view.AcceleratorUsage())
+
+	view, err = newNode(IntelAccelerator, map[string]interface{}{KeyIntelGPUUsedMemory: 2.0, KeyIntelGPUTotalMemory: 8.0}).View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	stats = view.Report.NodeStats["edge"]
+	assert.Equal(t, "2000000000", stats.Usage[ResourceGPU])
+	assert.Equal(t, "8000000000", stats.Capacity[ResourceGPU])
+	assert.Equal(t, "0.25", stats.Percent[ResourceGPU])
+
+	view, err = newNode(AMDAccelerator, map[string]interface{}{KeyGPUUsedMemory: 1024}).View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	_, ok = view.Report.NodeStats["edge"].Usage[ResourceGPU]
+	assert.False(t, ok)
+
+	assert.NoError(t, newNode(AMDAccelerator, map[string]interface{}{KeyAMDGPUTotalMemory: 4096}).ValidateAccelerator())
+	assert.Error(t, newNode(AMDAccelerator, map[string]interface{}{KeyAMDGPUUsedMemory: 1024}).ValidateAccelerator())
+
+	RegisterAcceleratorParser("vendor", func(s *NodeStats, extension interface{}) {
+		s.Capacity[ResourceGPU] = "1"
+	})
+	defer func() {
+		acceleratorParsers.Lock()
+		delete(acceleratorParsers.parsers, "vendor")
+		acceleratorParsers.Unlock()
+	}()
+	view, err = newNode("vendor", map[string]interface{}{}).View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "1", view.Report.NodeStats["edge"].Capacity[ResourceGPU])
+	view, err = newNode("unknown", map[string]interface{}{KeyGPUTotalMemory: 4096}).View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	_, ok = view.Report.NodeStats["edge"].Capacity[ResourceGPU]
+	assert.False(t, ok)
+}
+
+func TestNodeProtoRoundTrip(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 123, time.UTC)
+	n := &Node{
+		Namespace:         "default",
+		Name:              "baetyl",
+		Version:           "1",
+		CreationTimestamp: now,
+		Accelerator:       NVAccelerator,
+		Mode:              CloudMode,
+		Cluster:           true,
+		Labels:            map[string]string{"a": "1"},
+		Attributes:        map[string]interface{}{"BaetylCoreFrequency": "20s"},
+		Report: Report{
+			"time":     now,
+			"appstats": []AppStats{{AppInfo: AppInfo{Name: "a", Version: "1"}, Status: Running}},
+			"nodestats": map[string]interface{}{"edge": map[string]interface{}{
+				"capacity":  map[string]interface{}{"cpu": "2"},
+				"ready":     true,
+				"extension": []interface{}{1, nil, "x"},
+			}},
+		},
+		Desire:      Desire{"apps": []AppInfo{{Name: "a", Version: "1"}}, "empty": map[string]interface{}{}},
+		SysApps:     []string{"core"},
+		Description: "desc",
+		Conditions:  []Condition{{Type: ConditionReady, Status: ConditionTrue, LastTransitionTime: now, Reason: "NodeReady"}},
+	}
+	data, err := n.MarshalProto()
+	assert.NoError(t, err)
+	var got Node
+	assert.NoError(t, got.UnmarshalProto(data))
+	assert.Equal(t, jsonRoundTrip(t, n), &got)
+	assert.Equal(t, "1", got.Desire.AppInfos(false)[0].Version)
+
+	assert.True(t, IsMalformedInput(got.UnmarshalProto([]byte{0xff})))
+	_, err = (&Node{Report: Report{"c": make(chan int)}}).MarshalProto()
+	assert.True(t, IsMalformedInput(err))
+}
+
+func TestNodeProtoRoundTripRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	str := func() string { return strconv.Itoa(r.Intn(100)) }
+	var value func(depth int) interface{}
+	value = func(depth int) interface{} {
+		switch k := r.Intn(7); {
+		case k == 0:
+			return nil
+		case k == 1:
+			return r.Intn(2) == 0
+		case k == 2:
+			return r.Float64() * 1000
+		case k == 3 || depth > 3:
+			return str()
+		case k == 4:
+			l := []interface{}{}
+			for i := r.Intn(3); i > 0; i-- {
+				l = append(l, value(depth+1))
+			}
+			return l
+		default:
+			m := map[string]interface{}{}
+			for i := r.Intn(3); i > 0; i-- {
+				m[str()] = value(depth + 1)
+			}
+			return m
+		}
+	}
+	object := func() map[string]interface{} {
+		if r.Intn(4) == 0 {
+			return nil
+		}
+		m := map[string]interface{}{}
+		for i := r.Intn(4) + 1; i > 0; i-- {
+			m[str()] = value(1)
+		}
+		return m
+	}
+	for i := 0; i < 200; i++ {
+		n := &Node{
+			Name:              str(),
+			CreationTimestamp: time.Unix(r.Int63n(1<<32), r.Int63n(1e9)).UTC(),
+			Cluster:           r.Intn(2) == 0,
+			Attributes:        object(),
+			Report:            object(),
+			Desire:            object(),
+		}
+		if r.Intn(2) == 0 {
+			n.Labels = map[string]string{str(): str()}
+			n.SysApps = []string{str()}
+		}
+		data, err := n.MarshalProto()
+		assert.NoError(t, err)
+		var got Node
+		assert.NoError(t, got.UnmarshalProto(data))
+		assert.Equal(t, jsonRoundTrip(t, n), &got)
+	}
+}
+
+func jsonRoundTrip(t *testing.T, n *Node) *Node {
+	data, err := json.Marshal(n)
+	assert.NoError(t, err)
+	var res Node
+	assert.NoError(t, json.Unmarshal(data, &res))
+	return &res
+}
+
+func TestReportDesireCompressed(t *testing.T) {
+	r := Report{
+		"apps": []interface{}{map[string]interface{}{"name": "app1", "version": "v1"}},
+		"node": map[string]interface{}{"hostname": strings.Repeat("edge", 100)},
+	}
+	data, err := r.MarshalCompressed()
+	assert.NoError(t, err)
+	assert.True(t, IsCompressed(data))
+	plain, err := json.Marshal(r)
+	assert.NoError(t, err)
+	compressed, uncompressed, err := CompressedSize(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), compressed)
+	assert.Equal(t, len(plain), uncompressed)
+	assert.True(t, compressed < uncompressed)
+
+	var r2 Report
+	assert.NoError(t, r2.UnmarshalCompressed(data))
+	assert.Equal(t, r.AppInfos(false), r2.AppInfos(false))
+	var r3 Report
+	assert.NoError(t, r3.UnmarshalCompressed(plain))
+	assert.Equal(t, r2, r3)
+
+	compressed, uncompressed, err = CompressedSize(plain)
+	assert.NoError(t, err)
+	assert.Equal(t, len(plain), compressed)
+	assert.Equal(t, len(plain), uncompressed)
+
+	d := Desire{"apps": []interface{}{map[string]interface{}{"name": "app1", "version": "v2"}}}
+	data, err = d.MarshalCompressed()
+	assert.NoError(t, err)
+	var d2 Desire
+	assert.NoError(t, d2.UnmarshalCompressed(data))
+	assert.Equal(t, d.AppInfos(false), d2.AppInfos(false))
+
+	err = d2.UnmarshalCompressed(data[:len(data)-4])
+	assert.Error(t, err)
+	assert.True(t, IsMalformedInput(err))
+	_, _, err = CompressedSize(data[:4])
+	assert.True(t, IsMalformedInput(err))
+	assert.True(t, IsMalformedInput(d2.UnmarshalCompressed([]byte("{"))))
+}
+
+func TestReportViewAggregateAppStats(t *testing.T) {
+	view := &ReportView{
+		AppStats: []AppStats{
+			{
+				AppInfo: AppInfo{Name: "app1", Version: "v1"},
+				Status:  Running,
+				InstanceStats: map[string]InstanceStats{
+					"ins1": {Name: "ins1", NodeName: "node1", Status: Running, Usage: map[string]string{"cpu": "500m", "memory": "1Ki"}},
+				},
+			},
+			{
+				AppInfo: AppInfo{Name: "app2", Version: "v1"},
+				Status:  Running,
+			},
+			{
+				AppInfo: AppInfo{Name: "app1", Version: "v1"},
+				Status:  Running,
+				InstanceStats: map[string]InstanceStats{
+					"ins1": {Name: "ins1", NodeName: "node2", Status: Pending, Usage: map[string]string{"cpu": "1", "memory": "1024", "gpu": "bad"}},
+				},
+			},
+		},
+		SysAppStats: []AppStats{
+			{
+				AppInfo: AppInfo{Name: "core"},
+				Status:  Running,
+				InstanceStats: map[string]InstanceStats{
+					"core1": {Name: "core1", NodeName: "node1", Status: Failed},
+				},
+			},
+		},
+	}
+	res := view.AggregateAppStats(false)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "app1", res[0].Name)
+	assert.Equal(t, Pending, res[0].Status)
+	assert.Len(t, res[0].InstanceStats, 2)
+	assert.Equal(t, "node1", res[0].InstanceStats["ins1"].NodeName)
+	assert.Equal(t, "node2", res[0].InstanceStats["node2/ins1"].NodeName)
+	assert.Equal(t, map[string]string{"cpu": "1.5", "memory": "2048"}, res[0].Usage)
+	assert.Equal(t, "app2", res[1].Name)
+	assert.Equal(t, Running, res[1].Status)
+	assert.Nil(t, res[1].Usage)
+	assert.Len(t, res[1].InstanceStats, 0)
+
+	// the view is left untouched
+	assert.Len(t, view.AppStats[0].InstanceStats, 1)
+	assert.Nil(t, view.AppStats[0].Usage)
+
+	res = view.AggregateAppStats(true)
+	assert.Len(t, res, 1)
+	assert.Equal(t, Failed, res[0].Status)
+	assert.Nil(t, res[0].Usage)
+
+	assert.Nil(t, (&ReportView{}).AggregateAppStats(false))
+}
+
+func TestDesireValidate(t *testing.T) {
+	d := Desire{
+		"apps":    []AppInfo{{Name: "app1", Version: "v1", Replicas: 2}},
+		"sysapps": []interface{}{map[string]interface{}{"name": "core", "refs": []interface{}{"cfg"}}},
+		"devices": []DeviceInfo{{Name: "dev1", Status: DeviceConnected}},
+		"custom":  "value",
+	}
+	assert.NoError(t, d.Validate(nil))
+	assert.NoError(t, Desire{}.Validate(nil))
+
+	d = Desire{
+		"apps":    "app1",
+		"sysapps": []interface{}{map[string]interface{}{"version": "v1", "replicas": -1}},
+		"devices": []interface{}{map[string]interface{}{"name": "dev1", "status": "lost"}},
+	}
+	err := d.Validate(nil)
+	assert.Error(t, err)
+	assert.True(t, IsMalformedInput(err))
+	var verrs ValidationErrors
+	assert.True(t, errors.As(err, &verrs))
+	assert.Len(t, verrs, 4)
+	assert.Contains(t, err.Error(), "apps: Invalid type. Expected: array, given: string")
+	assert.Contains(t, err.Error(), "sysapps.0: name is required")
+	assert.Contains(t, err.Error(), "sysapps.0.replicas: Must be greater than or equal to 0")
+	assert.Contains(t, err.Error(), "devices.0.status")
+
+	schema := []byte(`{"type": "object", "required": ["apps"]}`)
+	assert.NoError(t, Desire{"apps": 1}.Validate(schema))
+	err = Desire{}.Validate(schema)
+	assert.EqualError(t, err, "(root): apps is required")
+
+	err = Desire{}.Validate([]byte("{"))
+	assert.True(t, IsMalformedInput(err))
+}
+
+func TestNodeStatsHistory(t *testing.T) {
+	now := time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)
+	h := NewNodeStatsHistory(3)
+	h.now = func() time.Time { return now }
+	assert.Nil(t, h.Average(time.Hour))
+	assert.Nil(t, h.Peak(time.Hour))
+	assert.Nil(t, h.Window(time.Hour))
+
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	h.Record(&NodeStats{Time: at(time.Hour), Usage: map[string]string{"cpu": "4", "memory": "4Gi"}})
+	h.Record(&NodeStats{Time: at(3 * time.Minute), Usage: map[string]string{"cpu": "500m", "memory": "1Ki"}})
+	h.Record(&NodeStats{Time: at(2 * time.Minute), Usage: map[string]string{"cpu": "1", "memory": "1024", "gpu": "bad"}})
+	cur := &NodeStats{Usage: map[string]string{"cpu": "2", "memory": "4096"}, Capacity: map[string]string{"cpu": "4"}}
+	h.Record(cur)
+	cur.Usage["cpu"] = "3"
+	h.Record(nil)
+	assert.Equal(t, 3, h.Len())
+
+	// the oldest sample is evicted
+	window := h.Window(2 * time.Hour)
+	assert.Len(t, window, 3)
+	assert.Equal(t, "500m", window[0].Usage["cpu"])
+	assert.Equal(t, "2", window[2].Usage["cpu"])
+	window[2].Usage["cpu"] = "5"
+	assert.Len(t, h.Window(150*time.Second), 2)
+	assert.Len(t, h.Window(0), 1)
+
+	avg := h.Average(2 * time.Hour)
+	assert.Equal(t, map[string]string{"cpu": "1166m", "memory": "2048"}, avg.Usage)
+	assert.Equal(t, map[string]string{"cpu": "4"}, avg.Capacity)
+	avg = h.Average(150 * time.Second)
+	assert.Equal(t, map[string]string{"cpu": "1500m", "memory": "2560"}, avg.Usage)
+
+	peak := h.Peak(2 * time.Hour)
+	assert.Equal(t, map[string]string{"cpu": "2000m", "memory": "4096"}, peak.Usage)
+	peak = h.Peak(150 * time.Second)
+	assert.Equal(t, map[string]string{"cpu": "2", "memory": "4096"}, peak.Usage)
+
+	assert.Len(t, NewNodeStatsHistory(0).samples, 1)
+
+	// the milli values of exbibytes overflow int64
+	large := NewNodeStatsHistory(3)
+	large.now = func() time.Time { return now }
+	large.Record(&NodeStats{Time: at(time.Minute), Usage: map[string]string{"memory": "7Ei"}})
+	large.Record(&NodeStats{Time: at(time.Second), Usage: map[string]string{"memory": "5Ei"}})
+	assert.Equal(t, map[string]string{"memory": "6917529027641081856"}, large.Average(time.Hour).Usage)
+	assert.Equal(t, map[string]string{"memory": "8070450532247928832"}, large.Peak(time.Hour).Usage)
+}
+
+func TestMergeWithMask(t *testing.T) {
+	r := Report{
+		"node":     map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge", "os": "linux"}},
+		"appstats": map[string]interface{}{"app1": map[string]interface{}{"status": "Pending", "cause": "pulling"}},
+	}
+	incoming := Report{
+		"node":     map[string]interface{}{"edge": map[string]interface{}{"hostname": "other"}},
+		"appstats": map[string]interface{}{"app1": map[string]interface{}{"status": "Running"}, "app2": map[string]interface{}{"status": "Pending"}},
+		"time":     "now",
+	}
+	assert.NoError(t, r.MergeWithMask(incoming, []string{"appstats", "missing"}))
+	assert.Equal(t, Report{
+		"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge", "os": "linux"}},
+		"appstats": map[string]interface{}{
+			"app1": map[string]interface{}{"status": "Running", "cause": "pulling"},
+			"app2": map[string]interface{}{"status": "Pending"},
+		},
+	}, r)
+
+	// the empty mask merges all keys like Merge
+	expected := Report(copyMap(r))
+	assert.NoError(t, expected.Merge(Report(copyMap(incoming))))
+	assert.NoError(t, r.MergeWithMask(Report(copyMap(incoming)), nil))
+	assert.Equal(t, expected, r)
+	assert.Equal(t, "other", r["node"].(map[string]interface{})["edge"].(map[string]interface{})["hostname"])
+
+	d := Desire{"apps": []interface{}{"a"}, "nodeprops": map[string]interface{}{"a": map[string]interface{}{"b": "1", "c": "2"}}}
+	assert.NoError(t, d.MergeWithMask(Desire{
+		"apps":      []interface{}{"b"},
+		"nodeprops": map[string]interface{}{"a": map[string]interface{}{"b": "3"}},
+	}, []string{"nodeprops"}))
+	assert.Equal(t, Desire{"apps": []interface{}{"a"}, "nodeprops": map[string]interface{}{"a": map[string]interface{}{"b": "3", "c": "2"}}}, d)
+	assert.NoError(t, d.MergeWithMask(Desire{"apps": []interface{}{"b"}}, []string{}))
+	assert.Equal(t, []interface{}{"b"}, d["apps"])
+}
+
+func TestDesireHistory(t *testing.T) {
+	h := NewDesireHistory(5)
+	_, err := h.Rollback(1)
+	assert.True(t, errors.Is(err, ErrDesireHistoryOutOfRange))
+
+	for i := 0; i < 10; i++ {
+		d := Desire{"apps": []interface{}{map[string]interface{}{"name": "app", "version": strconv.Itoa(i)}}}
+		h.Push(d)
+		// the snapshot is not affected by the pushed desire
+		d["apps"].([]interface{})[0].(map[string]interface{})["version"] = "modified"
+	}
+	assert.Equal(t, 5, h.Len())
+	for n := 1; n <= 5; n++ {
+		d, err := h.Rollback(n)
+		assert.NoError(t, err)
+		assert.Equal(t, []AppInfo{{Name: "app", Version: strconv.Itoa(10 - n)}}, d.AppInfos(false))
+	}
+	_, err = h.Rollback(6)
+	assert.True(t, errors.Is(err, ErrDesireHistoryOutOfRange))
+	_, err = h.Rollback(0)
+	assert.True(t, errors.Is(err, ErrDesireHistoryOutOfRange))
+
+	// the rolled back desire is a copy of the snapshot
+	d, err := h.Rollback(1)
+	assert.NoError(t, err)
+	d["apps"].([]interface{})[0].(map[string]interface{})["version"] = "modified"
+	d, err = h.Rollback(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []AppInfo{{Name: "app", Version: "9"}}, d.AppInfos(false))
+
+	h.Clear()
+	assert.Equal(t, 0, h.Len())
+	h.Push(nil)
+	d, err = h.Rollback(1)
+	assert.NoError(t, err)
+	assert.Nil(t, d)
+
+	h = NewDesireHistory(0)
+	h.Push(Desire{"a": "1"})
+	h.Push(Desire{"a": "2"})
+	assert.Equal(t, 1, h.Len())
+	d, err = h.Rollback(1)
+	assert.NoError(t, err)
+	assert.Equal(t, Desire{"a": "2"}, d)
+}
+
+func TestSelector(t *testing.T) {
+	sel, err := ParseSelector(" env = prod,region=north ")
+	assert.NoError(t, err)
+	assert.Equal(t, Selector{"env": "prod", "region": "north"}, sel)
+	assert.Equal(t, "env=prod,region=north", sel.String())
+	again, err := ParseSelector(sel.String())
+	assert.NoError(t, err)
+	assert.Equal(t, sel, again)
+
+	assert.True(t, sel.Matches(map[string]string{"env": "prod", "region": "north", "zone": "a"}))
+	assert.False(t, sel.Matches(map[string]string{"env": "prod"}))
+	assert.False(t, sel.Matches(map[string]string{"env": "dev", "region": "north"}))
+	assert.False(t, sel.Matches(nil))
+
+	empty, err := ParseSelector("")
+	assert.NoError(t, err)
+	assert.Equal(t, Selector{}, empty)
+	assert.Equal(t, "", empty.String())
+	assert.True(t, empty.Matches(nil))
+
+	sel, err = ParseSelector("tier=")
+	assert.NoError(t, err)
+	assert.True(t, sel.Matches(map[string]string{"tier": ""}))
+	assert.False(t, sel.Matches(nil))
+
+	for _, s := range []string{"env", "=prod", "env=prod,", "env=prod,env=dev"} {
+		_, err = ParseSelector(s)
+		assert.Error(t, err, s)
+		assert.True(t, IsMalformedInput(err), s)
+	}
+
+	nodes := []*Node{
+		{Name: "n1", Labels: map[string]string{"env": "prod"}},
+		nil,
+		{Name: "n2", Labels: map[string]string{"env": "dev"}},
+		{Name: "n3", Labels: map[string]string{"env": "prod", "gpu": "true"}},
+		{Name: "n4"},
+	}
+	res := FilterNodes(nodes, Selector{"env": "prod"})
+	assert.Len(t, res, 2)
+	assert.Equal(t, "n1", res[0].Name)
+	assert.Equal(t, "n3", res[1].Name)
+	assert.Len(t, FilterNodes(nodes, nil), 4)
+	assert.Nil(t, FilterNodes(nodes, Selector{"gpu": "false"}))
+}
+
+func TestNodeViewNetworkStats(t *testing.T) {
+	node := &Node{
+		Name: "baetyl",
+		Report: Report{
+			"time": time.Now().UTC(),
+			"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}},
+			"nodestats": map[string]interface{}{"edge": map[string]interface{}{
+				"usage":    map[string]interface{}{"cpu": "1", "memory": "1Gi"},
+				"capacity": map[string]interface{}{"cpu": "4", "memory": "4Gi"},
+				"networks": map[string]interface{}{
+					"eth0":  map[string]interface{}{"interface": "eth0", "rxBytes": 100, "txBytes": 50, "capacityBps": 1000, "rxBps": 250, "txBps": 100},
+					"wlan0": map[string]interface{}{"interface": "wlan0", "rxBytes": 20, "txBytes": 10, "rxBps": 5},
+				},
+			}},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	stats := view.Report.NodeStats["edge"]
+	assert.Len(t, stats.Networks, 2)
+	assert.Equal(t, 0.25, stats.Networks["eth0"].RxBandwidthPercent)
+	assert.Equal(t, 0.1, stats.Networks["eth0"].TxBandwidthPercent)
+	assert.Zero(t, stats.Networks["wlan0"].RxBandwidthPercent)
+	assert.Equal(t, int64(120), stats.TotalNetworkRx())
+	assert.Equal(t, int64(60), stats.TotalNetworkTx())
+
+	cp := stats.DeepCopy()
+	cp.Networks["eth0"].RxBytes = 0
+	assert.Equal(t, int64(100), stats.Networks["eth0"].RxBytes)
+
+	empty := &NodeStats{Networks: map[string]*NetworkStats{"lo": nil}}
+	empty.populateNetworkPercent()
+	assert.Zero(t, empty.TotalNetworkRx())
+	assert.Zero(t, empty.TotalNetworkTx())
+}
+
+func TestNodeViewDiskStats(t *testing.T) {
+	node := &Node{
+		Name: "baetyl",
+		Report: Report{
+			"time": time.Now().UTC(),
+			"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}},
+			"nodestats": map[string]interface{}{"edge": map[string]interface{}{
+				"usage":    map[string]interface{}{"cpu": "1", "memory": "1Gi"},
+				"capacity": map[string]interface{}{"cpu": "4", "memory": "4Gi"},
+				"disks": map[string]interface{}{
+					"sda": map[string]interface{}{"device": "sda", "readBytes": 10, "total": 1000, "available": 100},
+					"sdb": map[string]interface{}{"device": "sdb", "total": 1000, "available": 750},
+					"sdc": map[string]interface{}{"device": "sdc"},
+				},
+			}},
+		},
+	}
+	view, err := node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	stats := view.Report.NodeStats["edge"]
+	assert.False(t, stats.DiskPressure)
+	percent, err := stats.DiskUsagePercent("sda")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.9", percent)
+	percent, err = stats.DiskUsagePercent("sdb")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.25", percent)
+	percent, err = stats.DiskUsagePercent("sdc")
+	assert.NoError(t, err)
+	assert.Equal(t, "0", percent)
+	_, err = stats.DiskUsagePercent("sdd")
+	assert.EqualError(t, err, "disk (sdd) not found")
+
+	assert.True(t, stats.UnderDiskPressure(0.85))
+	assert.False(t, stats.UnderDiskPressure(0.9))
+	assert.False(t, (&NodeStats{}).UnderDiskPressure(0))
+
+	view, err = node.ViewWithOptions(&NodeViewOptions{Timeout: time.Minute, DiskPressureThreshold: 0.85})
+	assert.NoError(t, err)
+	assert.True(t, view.Report.NodeStats["edge"].DiskPressure)
+	view, err = node.ViewWithOptions(&NodeViewOptions{Timeout: time.Minute, DiskPressureThreshold: 0.95})
+	assert.NoError(t, err)
+	assert.False(t, view.Report.NodeStats["edge"].DiskPressure)
+
+	cp := stats.DeepCopy()
+	cp.Disks["sda"].Available = 0
+	assert.Equal(t, int64(100), stats.Disks["sda"].Available)
+}
+
+func TestNodeInfoFingerprint(t *testing.T) {
+	info := &NodeInfo{
+		Hostname:      "edge",
+		Address:       "10.0.0.1",
+		Arch:          "amd64",
+		KernelVersion: "5.4.0",
+		MachineID:     "m1",
+		SystemUUID:    "u1",
+		OSImage:       "Ubuntu 20.04",
+		BootID:        "b1",
+	}
+	fp := info.Fingerprint()
+	assert.Len(t, fp, 64)
+	assert.Equal(t, fp, info.HardwareFingerprint)
+	// the digest of canonical json is stable across processes
+	assert.Equal(t, "6f15fdc88df4796e31a573db67ec52f86790a52ffb87da7c9bf52fd6126bda5e", fp)
+
+	same := info.DeepCopy()
+	same.Address = "10.0.0.2"
+	same.BootID = "b2"
+	same.Labels = map[string]string{"a": "b"}
+	assert.Equal(t, fp, same.Fingerprint())
+	assert.False(t, info.HasHardwareChanged(same))
+
+	mutations := []func(*NodeInfo){
+		func(n *NodeInfo) { n.Hostname = "other" },
+		func(n *NodeInfo) { n.Arch = "arm64" },
+		func(n *NodeInfo) { n.MachineID = "m2" },
+		func(n *NodeInfo) { n.SystemUUID = "u2" },
+		func(n *NodeInfo) { n.OSImage = "Ubuntu 22.04" },
+		func(n *NodeInfo) { n.KernelVersion = "5.15.0" },
+	}
+	for i, mutate := range mutations {
+		changed := info.DeepCopy()
+		mutate(changed)
+		// the stale fingerprint copied from info is not compared
+		assert.Equal(t, fp, changed.HardwareFingerprint)
+		assert.True(t, info.HasHardwareChanged(changed), i)
+		// neither node is modified by the comparison
+		assert.Equal(t, fp, changed.HardwareFingerprint, i)
+	}
+	assert.True(t, info.HasHardwareChanged(nil))
+	assert.Equal(t, fp, info.HardwareFingerprint)
+
+	tv, err := Report{"node": map[string]*NodeInfo{"edge": info}}.TelemetryView()
+	assert.NoError(t, err)
+	assert.NotContains(t, tv["node"].(map[string]interface{})["edge"], "fingerprint")
+	assert.NotContains(t, tv["node"].(map[string]interface{})["edge"], "machineID")
+}
+
+func TestReportMask(t *testing.T) {
+	r := Report{
+		"token":   "abc",
+		"node":    map[string]*NodeInfo{"edge": {Hostname: "edge", OS: "linux"}},
+		"apps":    []AppInfo{{Name: "a", Version: "1"}, {Name: "b", Version: "2"}},
+		"devices": []interface{}{map[string]interface{}{"name": "d", "secret": "s1"}},
+		"attr":    map[string]interface{}{"password": "p", "keep": "k", "nested": map[string]interface{}{"secret": "s2"}},
+		"time":    "now",
+	}
+	masked := r.Mask([]string{"token", "node.edge.hostname", "apps.version", "devices.secret", "attr.password", "missing.key", "time.x", ""})
+	assert.Equal(t, Redacted, masked["token"])
+	assert.Equal(t, map[string]interface{}{"edge": map[string]interface{}{"hostname": Redacted, "os": "linux", "containerRuntime": "", "machineID": "", "bootID": "", "systemUUID": "", "osImage": ""}}, masked["node"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "a", "version": Redacted},
+		map[string]interface{}{"name": "b", "version": Redacted},
+	}, masked["apps"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "d", "secret": Redacted}}, masked["devices"])
+	assert.Equal(t, map[string]interface{}{"password": Redacted, "keep": "k", "nested": map[string]interface{}{"secret": "s2"}}, masked["attr"])
+	assert.Equal(t, "now", masked["time"])
+	assert.NotContains(t, masked, "missing")
+
+	// the report is not mutated
+	assert.Equal(t, "abc", r["token"])
+	assert.Equal(t, "edge", r["node"].(map[string]*NodeInfo)["edge"].Hostname)
+	assert.Equal(t, "1", r["apps"].([]AppInfo)[0].Version)
+	assert.Equal(t, "s1", r["devices"].([]interface{})[0].(map[string]interface{})["secret"])
+	assert.Equal(t, "p", r["attr"].(map[string]interface{})["password"])
+
+	data, err := MarshalMasked(r, DefaultMaskPolicy)
+	assert.NoError(t, err)
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, Redacted, doc["token"])
+	assert.Equal(t, map[string]interface{}{"password": Redacted, "keep": "k", "nested": map[string]interface{}{"secret": "s2"}}, doc["attr"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "d", "secret": Redacted}}, doc["devices"])
+	assert.Equal(t, "now", doc["time"])
+
+	assert.Nil(t, Report(nil).Mask(DefaultMaskPolicy))
+	_, err = MarshalMasked(Report{"bad": make(chan int)}, nil)
+	assert.True(t, IsMalformedInput(err))
+}
+
+func TestDesireAppVersions(t *testing.T) {
+	assert.NoError(t, (&AppInfo{Name: "a", Version: "1.2.3"}).ValidateSemver())
+	assert.NoError(t, (&AppInfo{Name: "a", Version: "v1.2.3-rc.1+build"}).ValidateSemver())
+	for _, v := range []string{"", "1.2", "12345", "1.2.x", "latest"} {
+		err := (&AppInfo{Name: "a", Version: v}).ValidateSemver()
+		assert.Error(t, err, v)
+		assert.True(t, IsMalformedInput(err), v)
+	}
+
+	d := Desire{
+		"apps":    []AppInfo{{Name: "a", Version: "1.2.3"}, {Name: "b", Version: "latest"}},
+		"sysapps": []AppInfo{{Name: "core", Version: "2.0.0"}, {Name: "init", Version: "1"}},
+	}
+	err := d.ValidateAppVersions()
+	assert.True(t, IsMalformedInput(err))
+	var verrs ValidationErrors
+	assert.True(t, errors.As(err, &verrs))
+	assert.Len(t, verrs, 2)
+	assert.Contains(t, err.Error(), "the version (latest) of app (b) is not a valid semver")
+	assert.Contains(t, err.Error(), "the version (1) of app (init) is not a valid semver")
+	assert.NoError(t, Desire{"apps": []AppInfo{{Name: "a", Version: "1.0.0"}}}.ValidateAppVersions())
+	assert.NoError(t, Desire{}.ValidateAppVersions())
+
+	assert.NoError(t, d.SatisfiesConstraints(nil))
+	assert.NoError(t, d.SatisfiesConstraints([]AppConstraint{
+		{Name: "a", Constraint: ">=1.2.0,<2.0.0"},
+		{Name: "core", Constraint: "^2"},
+	}))
+	err = d.SatisfiesConstraints([]AppConstraint{
+		{Name: "a", Constraint: ">=1.3.0"},
+		{Name: "b", Constraint: ">=1.0.0"},
+		{Name: "core", Constraint: "bad constraint"},
+		{Name: "missing", Constraint: "*"},
+	})
+	assert.True(t, IsMalformedInput(err))
+	verrs = nil
+	assert.True(t, errors.As(err, &verrs))
+	assert.Len(t, verrs, 4)
+	assert.Contains(t, err.Error(), "the version (1.2.3) of app (a) does not satisfy (>=1.3.0)")
+	assert.Contains(t, err.Error(), "the version (latest) of app (b) is not a valid semver")
+	assert.Contains(t, err.Error(), "invalid constraint (bad constraint) of app (core)")
+	assert.Contains(t, err.Error(), "app (missing) not found")
+}
+
+func TestReportMergeWithConflictHandler(t *testing.T) {
+	newReport := func() Report {
+		return Report{
+			"time": "now",
+			"node": map[string]interface{}{"cpu": "1", "memory": map[string]interface{}{"used": "1Gi"}, "gpu": nil},
+			"apps": []interface{}{"a"},
+		}
+	}
+	incoming := Report{
+		"time": 1.0,
+		"node": map[string]interface{}{"cpu": map[string]interface{}{"used": "500m"}, "memory": map[string]interface{}{"used": "2Gi"}, "gpu": "1"},
+		"apps": []interface{}{"b"},
+		"new":  true,
+	}
+	var conflicts []string
+	r := newReport()
+	assert.NoError(t, r.MergeWithConflictHandler(incoming, func(key string, existing, in interface{}) interface{} {
+		conflicts = append(conflicts, key)
+		return existing
+	}))
+	sort.Strings(conflicts)
+	assert.Equal(t, []string{"node.cpu", "time"}, conflicts)
+	assert.Equal(t, Report{
+		"time": "now",
+		"node": map[string]interface{}{"cpu": "1", "memory": map[string]interface{}{"used": "2Gi"}, "gpu": "1"},
+		"apps": []interface{}{"b"},
+		"new":  true,
+	}, r)
+
+	// the nil handler behaves like merge
+	r, expected := newReport(), newReport()
+	assert.NoError(t, r.MergeWithConflictHandler(incoming, nil))
+	assert.NoError(t, expected.Merge(incoming))
+	assert.Equal(t, expected, r)
+	assert.Equal(t, map[string]interface{}{"used": "500m"}, r["node"].(map[string]interface{})["cpu"])
+}
+
+func TestNodeConditions(t *testing.T) {
+	n := &Node{Name: "baetyl"}
+	_, ok := n.GetCondition("Custom")
+	assert.False(t, ok)
+
+	t1 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	n.SetCondition(Condition{Type: "Custom", Status: ConditionFalse, LastTransitionTime: t1, Reason: "A"})
+	c, ok := n.GetCondition("Custom")
+	assert.True(t, ok)
+	assert.Equal(t, Condition{Type: "Custom", Status: ConditionFalse, LastTransitionTime: t1, Reason: "A"}, c)
+
+	// the transition time is kept if the status is not changed
+	n.SetCondition(Condition{Type: "Custom", Status: ConditionFalse, LastTransitionTime: t1.Add(time.Hour), Reason: "B"})
+	c, _ = n.GetCondition("Custom")
+	assert.Equal(t, t1, c.LastTransitionTime)
+	assert.Equal(t, "B", c.Reason)
+	n.SetCondition(Condition{Type: "Custom", Status: ConditionTrue})
+	c, _ = n.GetCondition("Custom")
+	assert.True(t, c.LastTransitionTime.After(t1))
+	assert.Len(t, n.Conditions, 1)
+
+	now := time.Now().UTC()
+	n.Report = Report{
+		"time": now,
+		"node": map[string]interface{}{"n1": map[string]interface{}{"hostname": "n1"}, "n2": map[string]interface{}{"hostname": "n2"}},
+		"nodestats": map[string]interface{}{
+			"n1": map[string]interface{}{"memoryPressure": true},
+			"n2": map[string]interface{}{"memoryPressure": true, "diskPressure": true},
+		},
+	}
+	view, err := n.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, view.Conditions, 5)
+	c, _ = view.GetCondition("Custom")
+	assert.Equal(t, ConditionTrue, c.Status)
+	c, _ = view.GetCondition(ConditionReady)
+	assert.Equal(t, ConditionTrue, c.Status)
+	assert.Equal(t, now, c.LastTransitionTime.UTC())
+	c, _ = view.GetCondition(ConditionMemoryPressure)
+	assert.Equal(t, Condition{Type: ConditionMemoryPressure, Status: ConditionTrue, LastTransitionTime: c.LastTransitionTime, Reason: "NodeMemoryPressure", Message: "n1,n2"}, c)
+	c, _ = view.GetCondition(ConditionDiskPressure)
+	assert.Equal(t, ConditionTrue, c.Status)
+	assert.Equal(t, "n2", c.Message)
+	c, _ = view.GetCondition(ConditionNetworkUnavailable)
+	assert.Equal(t, ConditionFalse, c.Status)
+	assert.Equal(t, "NodeNetworkAvailable", c.Reason)
+	assert.Len(t, n.Conditions, 1)
+
+	// the transition time of the stored condition is kept by the view
+	n.SetCondition(Condition{Type: ConditionReady, Status: ConditionTrue, LastTransitionTime: t1})
+	view, err = n.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	c, _ = view.GetCondition(ConditionReady)
+	assert.Equal(t, t1, c.LastTransitionTime.UTC())
+
+	view, err = (&Node{Name: "baetyl"}).View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	c, _ = view.GetCondition(ConditionReady)
+	assert.Equal(t, ConditionFalse, c.Status)
+	c, _ = view.GetCondition(ConditionDiskPressure)
+	assert.Equal(t, ConditionUnknown, c.Status)
+}
+
+func TestDesireDiffWithConflicts(t *testing.T) {
+	baseline := Report{
+		"apps":      []interface{}{map[string]interface{}{"name": "a", "version": "1"}},
+		"nodeprops": map[string]interface{}{"mode": "auto", "level": "1", "zone": "a"},
+		"time":      "t1",
+	}
+	reported := Report{
+		"apps":      []interface{}{map[string]interface{}{"name": "a", "version": "1"}},
+		"nodeprops": map[string]interface{}{"mode": "manual", "level": "2", "extra": "x"},
+		"time":      "t2",
+	}
+	desired := Desire{
+		"apps":      []AppInfo{{Name: "a", Version: "2"}},
+		"nodeprops": map[string]interface{}{"mode": "auto", "level": "2", "zone": "b"},
+	}
+	delta, conflicts, err := desired.DiffWithConflicts(reported, baseline)
+	assert.NoError(t, err)
+	expected, err := desired.Diff(reported)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, delta)
+	// the level changed locally equals desired, the apps and extra are not changed or not desired
+	assert.Equal(t, map[string]interface{}{"nodeprops.mode": "manual", "nodeprops.zone": nil}, conflicts)
+
+	_, conflicts, err = desired.DiffWithConflicts(reported, reported)
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	// a section replaced by a different type conflicts as a whole
+	reported = Report{"nodeprops": "off"}
+	_, conflicts, err = desired.DiffWithConflicts(reported, baseline)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"nodeprops": "off", "apps": nil}, conflicts)
+
+	_, _, err = desired.DiffWithConflicts(Report{}, Report{"bad": make(chan int)})
+	assert.True(t, IsMalformedInput(err))
+}
+
+func TestNodeStatsHistoryTrend(t *testing.T) {
+	now := time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)
+	h := NewNodeStatsHistory(10)
+	h.now = func() time.Time { return now }
+	_, err := h.Trend("memory", time.Hour)
+	assert.True(t, errors.Is(err, ErrInsufficientSamples))
+	_, err = h.TimeToExhaustion("memory")
+	assert.True(t, errors.Is(err, ErrInsufficientSamples))
+
+	record := func(ago time.Duration, cpu, memory string) {
+		ts := now.Add(-ago)
+		h.Record(&NodeStats{
+			Time:     &ts,
+			Usage:    map[string]string{"cpu": cpu, "memory": memory},
+			Capacity: map[string]string{"cpu": "2", "memory": "1Ki"},
+		})
+	}
+	record(time.Hour, "2", "bad")
+	_, err = h.Trend("cpu", 2*time.Hour)
+	assert.True(t, errors.Is(err, ErrInsufficientSamples))
+
+	// memory grows 1 byte per second, cpu drops with mixed units
+	record(30*time.Second, "1500m", "100")
+	record(20*time.Second, "1400m", "110")
+	record(10*time.Second, "1300m", "120")
+	record(0, "1.2", "130")
+	slope, err := h.Trend("memory", time.Minute)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, slope, 1e-9)
+	slope, err = h.Trend("cpu", time.Minute)
+	assert.NoError(t, err)
+	assert.InDelta(t, -0.01, slope, 1e-9)
+	_, err = h.Trend("cpu", 0)
+	assert.True(t, errors.Is(err, ErrInsufficientSamples))
+	_, err = h.Trend("gpu", time.Minute)
+	assert.True(t, errors.Is(err, ErrInsufficientSamples))
+
+	d, err := h.TimeToExhaustion("memory")
+	assert.NoError(t, err)
+	assert.Equal(t, 894*time.Second, d)
+	_, err = h.TimeToExhaustion("cpu")
+	assert.True(t, errors.Is(err, ErrNegativeTrend))
+
+	// the usage has reached the capacity
+	record(-10*time.Second, "1.2", "2Ki")
+	d, err = h.TimeToExhaustion("memory")
+	assert.NoError(t, err)
+	assert.Zero(t, d)
+}
+
+func TestNodeViewFunctionalOptions(t *testing.T) {
+	node := &Node{
+		Name: "baetyl",
+		Report: Report{
+			"time":     time.Now().UTC(),
+			"apps":     []AppInfo{{Name: "a", Version: "1"}},
+			"node":     map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge", "machineID": "m1"}},
+			"appstats": []AppStats{{AppInfo: AppInfo{Name: "a", Version: "1"}, Status: Running}},
+			"nodestats": map[string]interface{}{"edge": map[string]interface{}{
+				"usage":    map[string]interface{}{"cpu": "1"},
+				"capacity": map[string]interface{}{"cpu": "2"},
+			}},
+		},
+	}
+	view, err := node.View()
+	assert.NoError(t, err)
+	assert.False(t, view.Ready)
+
+	view, err = node.View(WithReadyTimeout(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, view.Ready)
+	legacy, err := node.ViewWithTimeout(time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, view, legacy)
+
+	view, err = node.View(WithReadyTimeout(time.Minute), WithFieldProjection([]string{KeyNodeStats, KeyNode}))
+	assert.NoError(t, err)
+	assert.True(t, view.Ready)
+	assert.Nil(t, view.Report.Time)
+	assert.Nil(t, view.Report.Apps)
+	assert.Nil(t, view.Report.AppStats)
+	assert.Nil(t, view.Report.NodeInsNum)
+	assert.Equal(t, "0.5", view.Report.NodeStats["edge"].Percent["cpu"])
+	assert.Equal(t, "edge", view.Report.Node["edge"].Hostname)
+
+	view, err = node.View(WithMaskPolicy(MaskPolicy{"node.edge.machineID", "apps.version"}))
+	assert.NoError(t, err)
+	assert.Equal(t, Redacted, view.Report.Node["edge"].MachineID)
+	assert.Equal(t, []AppInfo{{Name: "a", Version: Redacted}}, view.Report.Apps)
+	assert.Equal(t, "m1", node.Report["node"].(map[string]interface{})["edge"].(map[string]interface{})["machineID"])
+}
+
+func TestDesireDryRun(t *testing.T) {
+	current := Report{
+		"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1.0.0"}},
+		"node": map[string]interface{}{"hostname": "edge"},
+	}
+	desire := Desire{
+		"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1.2.0"}},
+	}
+	res, err := desire.DryRun(current)
+	assert.NoError(t, err)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, Desire{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1.2.0"}}}, res.Delta)
+	assert.Equal(t, Report{
+		"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1.2.0"}},
+		"node": map[string]interface{}{"hostname": "edge"},
+	}, res.Projected)
+	// nothing is modified
+	assert.Equal(t, "1.0.0", current["apps"].([]interface{})[0].(map[string]interface{})["version"])
+	assert.Equal(t, "1.2.0", desire["apps"].([]interface{})[0].(map[string]interface{})["version"])
+
+	RegisterAppConstraint(AppConstraint{Name: "a", Constraint: "<1.1.0"})
+	RegisterAppConstraint(AppConstraint{Name: "b", Constraint: ">=1.0.0"})
+	res, err = desire.DryRun(current)
+	assert.NoError(t, err)
+	assert.Len(t, res.Errors, 2)
+	assert.Contains(t, res.Errors[0].Error(), "does not satisfy (<1.1.0)")
+	assert.Contains(t, res.Errors[1].Error(), "app (b) not found")
+	assert.NotNil(t, res.Projected)
+	UnregisterAppConstraint("a")
+	UnregisterAppConstraint("b")
+
+	deep := Desire{"a": map[string]interface{}{"b": map[string]interface{}{"c": map[string]interface{}{"d": map[string]interface{}{"e": map[string]interface{}{"f": 1}}}}}}
+	res, err = deep.DryRun(Report{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Errors, 1)
+	assert.True(t, errors.Is(res.Errors[0], ErrJSONLevelExceedsLimit))
+	assert.True(t, IsMalformedInput(res.Errors[0]))
+}
+
+func TestNodeMarshalFormats(t *testing.T) {
+	ts := time.Date(2021, 6, 1, 8, 30, 0, 0, time.UTC)
+	node := &Node{
+		Namespace:         "default",
+		Name:              "node01",
+		Version:           "1",
+		CreationTimestamp: ts,
+		Mode:              CloudMode,
+		Cluster:           true,
+		Labels:            map[string]string{"a": "b"},
+		Annotations:       map[string]string{"c": "d"},
+		Attributes:        map[string]interface{}{"batch": "b1", "count": float64(2)},
+		Report: Report{
+			"apps": []interface{}{map[string]interface{}{"name": "app1", "version": "1"}},
+			"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge", "arch": "amd64"}},
+			"time": "2021-06-01T08:30:00Z",
+		},
+		Desire: Desire{
+			"apps": []interface{}{map[string]interface{}{"name": "app1", "version": "2"}},
+			"rate": 0.5,
+		},
+		SysApps:       []string{"baetyl-core"},
+		Description:   "desc",
+		SchemaVersion: "v2",
+		Conditions: []Condition{
+			{Type: ConditionReady, Status: ConditionTrue, LastTransitionTime: ts, Reason: "Reported"},
+		},
+	}
+	for _, format := range []string{FormatJSON, FormatYAML, FormatTOML} {
+		t.Run(format, func(t *testing.T) {
+			data, err := node.Marshal(format)
+			assert.NoError(t, err)
+			var res Node
+			assert.NoError(t, res.Unmarshal(data, format))
+			assert.Equal(t, node, &res)
+		})
+	}
+
+	typed := &Node{Name: "typed", Report: Report{"apps": []AppInfo{{Name: "app1", Version: "1"}}}}
+	data, err := typed.Marshal(FormatTOML)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "[[report.apps]]")
+	assert.Contains(t, string(data), `name = "app1"`)
+	var res Node
+	assert.NoError(t, res.Unmarshal(data, FormatTOML))
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "app1", "version": "1"}}, res.Report["apps"])
+
+	// nulls and arrays of mixed types are kept by json and yaml, and rejected by toml which can
+	// not represent them
+	lossy := &Node{
+		Name:       "lossy",
+		Attributes: map[string]interface{}{"n": nil},
+		Report: Report{
+			"x":     nil,
+			"y":     map[string]interface{}{"z": nil},
+			"mixed": []interface{}{1.0, "a", nil, map[string]interface{}{"k": true}, []interface{}{}},
+			"apps":  []interface{}{map[string]interface{}{"name": "a", "replicas": 0.0}},
+		},
+		Desire: Desire{"apps": nil, "nodeprops": map[string]interface{}{"a": nil}},
+	}
+	for _, format := range []string{FormatJSON, FormatYAML} {
+		t.Run("lossy-"+format, func(t *testing.T) {
+			data, err := lossy.Marshal(format)
+			assert.NoError(t, err)
+			var res Node
+			assert.NoError(t, res.Unmarshal(data, format))
+			assert.Equal(t, lossy, &res)
+		})
+	}
+	for _, n := range []*Node{
+		lossy,
+		{Attributes: map[string]interface{}{"n": nil}},
+		{Report: Report{"y": map[string]interface{}{"z": nil}}},
+		{Desire: Desire{"apps": []interface{}{nil}}},
+		{Report: Report{"mixed": []interface{}{1.0, "a"}}},
+	} {
+		_, err = n.Marshal(FormatTOML)
+		assert.True(t, IsMalformedInput(err), "%v", n)
+	}
+	_, err = (&Node{Report: Report{"y": map[string]interface{}{"z": nil}}}).Marshal(FormatTOML)
+	assert.EqualError(t, err, "toml can not represent the null value of (report.y.z)")
+
+	res = Node{}
+	data, err = (&Node{Name: "times", Report: Report{"time": ts, "count": 3}}).Marshal(FormatTOML)
+	assert.NoError(t, err)
+	assert.NoError(t, res.Unmarshal(data, FormatTOML))
+	assert.Equal(t, Report{"time": "2021-06-01T08:30:00Z", "count": float64(3)}, res.Report)
+
+	data, err = (&Node{Name: "zero", Report: Report{"apps": []AppInfo{{Name: "a"}}}}).Marshal(FormatTOML)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "drainTimeout")
+	assert.NotContains(t, string(data), "replicas")
+
+	_, err = node.Marshal("cbor")
+	assert.Error(t, err)
+	assert.True(t, IsMalformedInput(err))
+	assert.True(t, IsMalformedInput(res.Unmarshal([]byte("{"), FormatJSON)))
+
+	RegisterFormat("indent", func(v interface{}) ([]byte, error) {
+		return json.MarshalIndent(v, "", "  ")
+	}, json.Unmarshal)
+	defer func() {
+		formats.Lock()
+		delete(formats.formats, "indent")
+		formats.Unlock()
+	}()
+	data, err = node.Marshal("indent")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "{\n  "))
+	res = Node{}
+	assert.NoError(t, res.Unmarshal(data, "indent"))
+	assert.Equal(t, node, &res)
+}
+
+func TestViewProject(t *testing.T) {
+	ts := time.Now()
+	report := &ReportView{
+		Time:      &ts,
+		Apps:      []AppInfo{{Name: "a", Version: "1"}},
+		Core:      &CoreInfo{GoVersion: "go1.14"},
+		AppStats:  []AppStats{{AppInfo: AppInfo{Name: "a", Version: "1"}, Status: Running}},
+		NodeStats: map[string]*NodeStats{"edge": {Usage: map[string]string{"cpu": "1"}}},
+	}
+	res := report.Project([]string{"appstats", "time"})
+	assert.Equal(t, &ts, res.Time)
+	assert.Equal(t, report.AppStats, res.AppStats)
+	assert.Nil(t, res.Apps)
+	assert.Nil(t, res.Core)
+	assert.Nil(t, res.NodeStats)
+	// the receiver is not modified
+	assert.NotNil(t, report.NodeStats)
+	assert.Equal(t, report, report.Project(nil))
+	assert.Nil(t, (*ReportView)(nil).Project([]string{"apps"}))
+
+	view := &NodeView{
+		Name:       "node01",
+		Labels:     map[string]string{"a": "b"},
+		Report:     report,
+		Desire:     Desire{"apps": []interface{}{}},
+		Ready:      true,
+		Mode:       CloudMode,
+		timeFormat: TimeFormatEpochMillis,
+	}
+	projected := view.Project([]string{"name", "ready", "report"})
+	assert.Equal(t, "node01", projected.Name)
+	assert.True(t, projected.Ready)
+	assert.Equal(t, report, projected.Report)
+	assert.Nil(t, projected.Labels)
+	assert.Nil(t, projected.Desire)
+	assert.Equal(t, SyncMode(""), projected.Mode)
+	assert.Equal(t, TimeFormatEpochMillis, projected.timeFormat)
+	assert.Equal(t, CloudMode, view.Mode)
+	assert.Equal(t, view, view.Project([]string{}))
+
+	data, err := json.Marshal((&NodeView{Name: "node01", Ready: true, Report: report}).Project([]string{"ready"}))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"createTime":"0001-01-01T00:00:00Z","cluster":false,"ready":true,"mode":""}`, string(data))
+
+	// the fields are keyed as MarshalFields keys them
+	tagged := struct {
+		Untagged string
+		Named    string `json:",omitempty"`
+		Skipped  string `json:"-"`
+		Renamed  string `json:"renamed"`
+	}{Untagged: "a", Named: "b", Skipped: "c", Renamed: "d"}
+	projectFields(&tagged, []string{"Untagged", "Named", "-"})
+	assert.Equal(t, "a", tagged.Untagged)
+	assert.Equal(t, "b", tagged.Named)
+	assert.Empty(t, tagged.Skipped)
+	assert.Empty(t, tagged.Renamed)
+}
+
+func TestNodeCordon(t *testing.T) {
+	n := &Node{Name: "node01", DrainTimeout: time.Minute}
+	view, err := n.View()
+	assert.NoError(t, err)
+	assert.False(t, view.Cordoned)
+	assert.Nil(t, view.DrainDeadline)
+
+	n.Cordon()
+	assert.True(t, n.Cordoned)
+	assert.NotNil(t, n.CordonTimestamp)
+	cordonTime := *n.CordonTimestamp
+	// cordoning again keeps the cordon time
+	n.Cordon()
+	assert.Equal(t, cordonTime, *n.CordonTimestamp)
+
+	view, err = n.View()
+	assert.NoError(t, err)
+	assert.True(t, view.Cordoned)
+	assert.Equal(t, cordonTime.Add(time.Minute), *view.DrainDeadline)
+
+	data, err := n.MarshalProto()
+	assert.NoError(t, err)
+	var res Node
+	assert.NoError(t, res.UnmarshalProto(data))
+	assert.True(t, res.Cordoned)
+	assert.Equal(t, cordonTime, *res.CordonTimestamp)
+	assert.Equal(t, time.Minute, res.DrainTimeout)
+	assert.Equal(t, n, n.DeepCopy())
+
+	desire := Desire{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "2"}}}
+	current := Report{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}}}
+	delta, err := desire.Diff(current)
+	assert.NoError(t, err)
+	assert.Equal(t, desire, delta)
+	_, err = Desire{}.Patch(Delta(delta), WithCordonCheck(n))
+	assert.True(t, errors.Is(err, ErrNodeCordoned))
+	_, err = Desire{}.PatchValidated(Delta(delta), nil, WithCordonCheck(n))
+	assert.True(t, errors.Is(err, ErrNodeCordoned))
+	_, err = Desire{}.PatchPrecise(Delta(delta), WithCordonCheck(n))
+	assert.True(t, errors.Is(err, ErrNodeCordoned))
+	_, err = Desire{}.PatchKeyedApps(Delta{"apps": map[string]interface{}{"a": nil}}, WithCordonCheck(n))
+	assert.True(t, errors.Is(err, ErrNodeCordoned))
+	// the guard is opt-in
+	_, err = Desire{}.PatchValidated(Delta(delta), nil)
+	assert.NoError(t, err)
+	_, err = desire.ApplyIfNotCordoned(n, current)
+	assert.True(t, errors.Is(err, ErrNodeCordoned))
+
+	n.Uncordon()
+	assert.False(t, n.Cordoned)
+	assert.Nil(t, n.CordonTimestamp)
+	view, err = n.View()
+	assert.NoError(t, err)
+	assert.Nil(t, view.DrainDeadline)
+	patched, err := Desire{}.Patch(Delta(delta), WithCordonCheck(n))
+	assert.NoError(t, err)
+	assert.Equal(t, desire, patched)
+	patched, err = Desire{}.PatchValidated(Delta(delta), nil, WithCordonCheck(n))
+	assert.NoError(t, err)
+	assert.Equal(t, desire, patched)
+	applied, err := desire.ApplyIfNotCordoned(n, current)
+	assert.NoError(t, err)
+	assert.Equal(t, Report{"apps": []interface{}{map[string]interface{}{"name": "a", "version": "2"}}}, applied)
+	assert.Equal(t, "1", current["apps"].([]interface{})[0].(map[string]interface{})["version"])
+}
+
+func TestServiceInfoIsRestartLooping(t *testing.T) {
+	created := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	restarted := created.Add(5 * time.Minute)
+	svc := &ServiceInfo{Name: "c1", CreateTime: &created, RestartCount: 5, LastRestartTime: &restarted, LastExitCode: 137}
+	assert.True(t, svc.IsRestartLooping(5, 10*time.Minute))
+	assert.True(t, svc.IsRestartLooping(3, 5*time.Minute))
+	assert.False(t, svc.IsRestartLooping(6, 10*time.Minute))
+	assert.False(t, svc.IsRestartLooping(5, time.Minute))
+	assert.False(t, (&ServiceInfo{RestartCount: 5, LastRestartTime: &restarted}).IsRestartLooping(1, time.Hour))
+	assert.False(t, (&ServiceInfo{RestartCount: 5, CreateTime: &created}).IsRestartLooping(1, time.Hour))
+	var nilSvc *ServiceInfo
+	assert.False(t, nilSvc.IsRestartLooping(0, time.Hour))
+
+	var stats Report
+	assert.NoError(t, json.Unmarshal([]byte(`{"appstats":[{"name":"a","instances":{
+		"i1":{"name":"i1","container":{"name":"c1","restartCount":2}},
+		"i2":{"name":"i2","container":{"name":"c2","createTime":"2021-06-01T08:00:00Z","restartCount":5,"lastRestartTime":"2021-06-01T08:05:00Z","lastExitCode":137}},
+		"i3":{"name":"i3"}}}]}`), &stats))
+	apps := stats.AppStats(false)
+	assert.Equal(t, int32(5), apps[0].MaxRestartCount())
+	assert.Equal(t, svc.CreateTime, apps[0].InstanceStats["i2"].Container.CreateTime)
+	assert.Equal(t, int32(137), apps[0].InstanceStats["i2"].Container.LastExitCode)
+	assert.Equal(t, int32(0), (&AppStats{}).MaxRestartCount())
+
+	ins := apps[0].InstanceStats["i2"]
+	cp := ins.DeepCopy()
+	assert.Equal(t, ins, *cp)
+	*cp.Container.LastRestartTime = created
+	assert.Equal(t, restarted, *apps[0].InstanceStats["i2"].Container.LastRestartTime)
+}
+
+func TestReportDeviceExtendedFields(t *testing.T) {
+	seen := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	report := Report{KeyDevices: []interface{}{
+		map[string]interface{}{
+			"name":            "d1",
+			"version":         "1",
+			"firmwareVersion": "fw-2.1",
+			"protocol":        DeviceProtocolModbus,
+			"status":          "connected",
+			"lastSeen":        "2021-06-01T08:00:00Z",
+			"attributes":      map[string]interface{}{"vendor": "acme", "slave": 1},
+		},
+		map[string]interface{}{"name": "d2", "protocol": 3, "connected": false, "attributes": map[string]string{"model": "x"}},
+		map[string]interface{}{"name": "d3", "connected": true, "firmwareVersion": 2},
+		"malformed",
+	}}
+	devs := report.DeviceInfos()
+	assert.Equal(t, []DeviceInfo{
+		{Name: "d1", Version: "1", FirmwareVersion: "fw-2.1", Protocol: DeviceProtocolModbus, Status: DeviceConnected, LastSeen: &seen, Attributes: map[string]string{"vendor": "acme"}},
+		{Name: "d2", Status: DeviceDisconnected, Attributes: map[string]string{"model": "x"}},
+		{Name: "d3", Status: DeviceConnected},
+	}, devs)
+
+	dev, ok := report.DeviceByName("d1")
+	assert.True(t, ok)
+	assert.Equal(t, devs[0], *dev)
+	_, ok = report.DeviceByName("d4")
+	assert.False(t, ok)
+
+	connected := report.ConnectedDevices()
+	assert.Len(t, connected, 2)
+	assert.Equal(t, "d1", connected[0].Name)
+	assert.Equal(t, "d3", connected[1].Name)
+	assert.Nil(t, Report{}.ConnectedDevices())
+
+	typed := Report{}
+	typed.SetDeviceInfos([]DeviceInfo{{Name: "d1", Status: DeviceConnected, Attributes: map[string]string{"vendor": "acme"}}})
+	dev, ok = typed.DeviceByName("d1")
+	assert.True(t, ok)
+	dev.Attributes["vendor"] = "other"
+	assert.Equal(t, "acme", typed.DeviceInfos()[0].Attributes["vendor"])
+
+	// the connected flag is kept as Status by the typed devices and their json
+	typed.SetDeviceInfos(devs)
+	data, err := json.Marshal(typed)
+	assert.NoError(t, err)
+	var decoded Report
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, devs, decoded.DeviceInfos())
+	connected = decoded.ConnectedDevices()
+	assert.Len(t, connected, 2)
+	assert.Equal(t, "d3", connected[1].Name)
+}
+
+func TestViewNewerSchemaVersion(t *testing.T) {
+	cluster := map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}}
+	for _, version := range []string{"1.1", "2.0", "10.0"} {
+		node := &Node{Report: Report{"node": cluster}}
+		node.Report.SetSchemaVersion(version)
+		view, err := node.View()
+		assert.NoError(t, err, version)
+		assert.Equal(t, map[string]*NodeInfo{"edge": {Hostname: "edge"}}, view.Report.Node)
+		assert.NoError(t, (&Node{Report: node.Report, Accelerator: ""}).ValidateAccelerator())
+	}
+
+	res, err := migrateSingleNodeReport(Report{"node": map[string]interface{}{"hostname": "edge"}})
+	assert.NoError(t, err)
+	assert.Equal(t, ReportSchemaVersion, res.SchemaVersion())
+	clusterReport := Report{"node": cluster}
+	res, err = migrateSingleNodeReport(clusterReport)
+	assert.NoError(t, err)
+	assert.Equal(t, ReportSchemaVersion, res.SchemaVersion())
+	assert.Equal(t, "0.0", clusterReport.SchemaVersion())
+
+	assert.Equal(t, -1, compareSchemaVersion("0.0", "1.0"))
+	assert.Equal(t, -1, compareSchemaVersion("1.9", "1.10"))
+	assert.Equal(t, 1, compareSchemaVersion("2.0", "1.0"))
+	assert.Equal(t, 0, compareSchemaVersion("1", "1.0"))
+	assert.Equal(t, 1, compareSchemaVersion("1.0.1", "1.0"))
+}
+
+func TestSyncMergeCopiesSource(t *testing.T) {
+	sr := NewSyncReport(nil)
+	reported := Report{
+		"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}},
+		"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}},
+	}
+	assert.NoError(t, sr.Merge(reported))
+	reported["node"].(map[string]interface{})["edge"].(map[string]interface{})["hostname"] = "changed"
+	reported["apps"].([]interface{})[0].(map[string]interface{})["version"] = "2"
+	assert.Equal(t, Report{
+		"node": map[string]interface{}{"edge": map[string]interface{}{"hostname": "edge"}},
+		"apps": []interface{}{map[string]interface{}{"name": "a", "version": "1"}},
+	}, sr.Unwrap())
+
+	sd := NewSyncDesire(Desire{})
+	desired := Desire{
+		"nodeprops": map[string]interface{}{"a": "1"},
+		"apps":      []interface{}{map[string]interface{}{"name": "a", "version": "1"}},
+	}
+	assert.NoError(t, sd.Merge(desired))
+	desired["nodeprops"].(map[string]interface{})["a"] = "2"
+	desired["apps"].([]interface{})[0].(map[string]interface{})["version"] = "2"
+	assert.Equal(t, Desire{
+		"nodeprops": map[string]interface{}{"a": "1"},
+		"apps":      []interface{}{map[string]interface{}{"name": "a", "version": "1"}},
+	}, sd.Unwrap())
+}
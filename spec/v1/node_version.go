@@ -0,0 +1,117 @@
+package v1
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/baetyl/baetyl-go/v2/errors"
+)
+
+// AppConstraint the semver range which the version of the named app must satisfy,
+// such as ">=1.2.0,<2.0.0"
+type AppConstraint struct {
+	Name       string `json:"name,omitempty" yaml:"name,omitempty"`
+	Constraint string `json:"constraint,omitempty" yaml:"constraint,omitempty"`
+}
+
+// appConstraints the registry of app constraints checked by Desire.DryRun, keyed by app name
+var appConstraints = struct {
+	sync.RWMutex
+	constraints map[string]AppConstraint
+}{constraints: map[string]AppConstraint{}}
+
+// RegisterAppConstraint registers the constraint of the named app, which replaces the
+// one registered for the same app
+func RegisterAppConstraint(c AppConstraint) {
+	appConstraints.Lock()
+	defer appConstraints.Unlock()
+	appConstraints.constraints[c.Name] = c
+}
+
+// UnregisterAppConstraint removes the constraint of the named app registered by RegisterAppConstraint
+func UnregisterAppConstraint(name string) {
+	appConstraints.Lock()
+	defer appConstraints.Unlock()
+	delete(appConstraints.constraints, name)
+}
+
+// registeredAppConstraints returns the registered constraints sorted by app name
+func registeredAppConstraints() []AppConstraint {
+	appConstraints.RLock()
+	defer appConstraints.RUnlock()
+	var res []AppConstraint
+	for _, c := range appConstraints.constraints {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// ValidateSemver checks whether the version of app is a valid semver, the "v" prefix is allowed
+func (s *AppInfo) ValidateSemver() error {
+	if _, err := parseSemver(s.Version); err != nil {
+		return malformed(errors.Errorf("the version (%s) of app (%s) is not a valid semver: %s", s.Version, s.Name, err.Error()))
+	}
+	return nil
+}
+
+// ValidateAppVersions checks the versions of all apps and sysapps of desire by AppInfo.ValidateSemver,
+// all invalid versions are returned as ValidationErrors
+func (d Desire) ValidateAppVersions() error {
+	var errs ValidationErrors
+	for _, isSys := range []bool{false, true} {
+		for _, app := range d.AppInfos(isSys) {
+			if err := app.ValidateSemver(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return malformed(errs)
+}
+
+// SatisfiesConstraints checks whether the versions of the named apps or sysapps of desire
+// satisfy the constraints, the missing apps, invalid versions or constraints and unsatisfied
+// constraints are all returned as ValidationErrors
+func (d Desire) SatisfiesConstraints(constraints []AppConstraint) error {
+	versions := map[string]string{}
+	for _, isSys := range []bool{false, true} {
+		for _, app := range d.AppInfos(isSys) {
+			versions[app.Name] = app.Version
+		}
+	}
+	var errs ValidationErrors
+	for _, c := range constraints {
+		version, ok := versions[c.Name]
+		if !ok {
+			errs = append(errs, errors.Errorf("app (%s) not found", c.Name))
+			continue
+		}
+		constraint, err := semver.NewConstraint(c.Constraint)
+		if err != nil {
+			errs = append(errs, errors.Errorf("invalid constraint (%s) of app (%s): %s", c.Constraint, c.Name, err.Error()))
+			continue
+		}
+		v, err := parseSemver(version)
+		if err != nil {
+			errs = append(errs, errors.Errorf("the version (%s) of app (%s) is not a valid semver: %s", version, c.Name, err.Error()))
+			continue
+		}
+		if !constraint.Check(v) {
+			errs = append(errs, errors.Errorf("the version (%s) of app (%s) does not satisfy (%s)", version, c.Name, c.Constraint))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return malformed(errs)
+}
+
+func parseSemver(version string) (*semver.Version, error) {
+	return semver.StrictNewVersion(strings.TrimPrefix(version, "v"))
+}
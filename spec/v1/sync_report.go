@@ -1,6 +1,13 @@
 package v1
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
 
 type Status string
 
@@ -11,71 +18,551 @@ const (
 	Unknown Status = "Unknown"
 )
 
+// IsTerminal checks whether the status is settled, which is Running or Failed
+func (s Status) IsTerminal() bool {
+	return s == Running || s == Failed
+}
+
+// severity ranks the status from healthy to unhealthy, the empty status ranks lowest
+func (s Status) severity() int {
+	switch s {
+	case Running:
+		return 1
+	case Pending:
+		return 2
+	case Unknown:
+		return 3
+	case Failed:
+		return 4
+	}
+	return 0
+}
+
+// QoSClass the quality of service class of instance
+type QoSClass string
+
+const (
+	QoSGuaranteed QoSClass = "Guaranteed"
+	QoSBurstable  QoSClass = "Burstable"
+	QoSBestEffort QoSClass = "BestEffort"
+)
+
+// PlacementFallback the placement reason of instance placed by fallback
+const PlacementFallback = "Fallback"
+
 // NodeInfo node info
 type NodeInfo struct {
-	Hostname         string            `yaml:"hostname,omitempty" json:"hostname,omitempty"`
-	Address          string            `yaml:"address,omitempty" json:"address,omitempty"`
-	Arch             string            `yaml:"arch,omitempty" json:"arch,omitempty"`
-	KernelVersion    string            `yaml:"kernelVer,omitempty" json:"kernelVer,omitempty"`
-	OS               string            `yaml:"os,omitempty" json:"os,omitempty"`
-	ContainerRuntime string            `yaml:"containerRuntime,omitempty" json:"containerRuntime"`
-	MachineID        string            `yaml:"machineID,omitempty" json:"machineID"`
-	BootID           string            `yaml:"bootID,omitempty" json:"bootID"`
-	SystemUUID       string            `yaml:"systemUUID,omitempty" json:"systemUUID"`
-	OSImage          string            `yaml:"osImage,omitempty" json:"osImage"`
-	Variant          string            `yaml:"variant,omitempty" json:"variant,omitempty"`
-	HostID           string            `yaml:"hostID,omitempty" json:"hostID,omitempty"`
-	Role             string            `yaml:"role,omitempty" json:"role,omitempty"`
-	Labels           map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"  validate:"omitempty,validLabels"`
+	Hostname         string            `yaml:"hostname,omitempty" toml:"hostname,omitempty" json:"hostname,omitempty"`
+	Address          string            `yaml:"address,omitempty" toml:"address,omitempty" json:"address,omitempty"`
+	Arch             string            `yaml:"arch,omitempty" toml:"arch,omitempty" json:"arch,omitempty"`
+	KernelVersion    string            `yaml:"kernelVer,omitempty" toml:"kernelVer,omitempty" json:"kernelVer,omitempty"`
+	OS               string            `yaml:"os,omitempty" toml:"os,omitempty" json:"os,omitempty"`
+	ContainerRuntime string            `yaml:"containerRuntime,omitempty" toml:"containerRuntime,omitempty" json:"containerRuntime"`
+	MachineID        string            `yaml:"machineID,omitempty" toml:"machineID,omitempty" json:"machineID"`
+	BootID           string            `yaml:"bootID,omitempty" toml:"bootID,omitempty" json:"bootID"`
+	SystemUUID       string            `yaml:"systemUUID,omitempty" toml:"systemUUID,omitempty" json:"systemUUID"`
+	OSImage          string            `yaml:"osImage,omitempty" toml:"osImage,omitempty" json:"osImage"`
+	Variant          string            `yaml:"variant,omitempty" toml:"variant,omitempty" json:"variant,omitempty"`
+	HostID           string            `yaml:"hostID,omitempty" toml:"hostID,omitempty" json:"hostID,omitempty"`
+	Role             string            `yaml:"role,omitempty" toml:"role,omitempty" json:"role,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" toml:"labels,omitempty"  validate:"omitempty,validLabels"`
+	// HardwareFingerprint the fingerprint of node hardware, populated by Fingerprint
+	HardwareFingerprint string `yaml:"fingerprint,omitempty" toml:"fingerprint,omitempty" json:"fingerprint,omitempty"`
+}
+
+// Fingerprint computes the sha256 hex digest of the canonical json of the hardware and
+// system identity fields of node, stores it in HardwareFingerprint and returns it
+func (s *NodeInfo) Fingerprint() string {
+	s.HardwareFingerprint = s.fingerprint()
+	return s.HardwareFingerprint
+}
+
+// fingerprint computes the fingerprint of node without storing it
+func (s *NodeInfo) fingerprint() string {
+	data, _ := json.Marshal(struct {
+		Hostname      string `json:"hostname"`
+		Arch          string `json:"arch"`
+		MachineID     string `json:"machineID"`
+		SystemUUID    string `json:"systemUUID"`
+		OSImage       string `json:"osImage"`
+		KernelVersion string `json:"kernelVer"`
+	}{s.Hostname, s.Arch, s.MachineID, s.SystemUUID, s.OSImage, s.KernelVersion})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HasHardwareChanged checks whether the fingerprint of other differs from the one of node,
+// the fingerprints are recomputed but not stored, so the stale ones are not compared and
+// neither node is modified, a nil other is changed
+func (s *NodeInfo) HasHardwareChanged(other *NodeInfo) bool {
+	if other == nil {
+		return true
+	}
+	return s.fingerprint() != other.fingerprint()
 }
 
 // NodeStats node statistics
 type NodeStats struct {
-	DiskPressure       bool              `yaml:"diskPressure,omitempty" json:"diskPressure,omitempty"`
-	MemoryPressure     bool              `yaml:"memoryPressure,omitempty" json:"memoryPressure,omitempty"`
-	PIDPressure        bool              `yaml:"pidPressure,omitempty" json:"pidPressure,omitempty"`
-	NetworkUnavailable bool              `yaml:"networkUnavailable,omitempty" json:"NetworkUnavailable,omitempty"`
-	Ready              bool              `yaml:"ready,omitempty" json:"ready,omitempty"`
-	Usage              map[string]string `yaml:"usage,omitempty" json:"usage,omitempty"`
-	Capacity           map[string]string `yaml:"capacity,omitempty" json:"capacity,omitempty"`
-	Percent            map[string]string `yaml:"percent,omitempty" json:"percent,omitempty"`
-	Extension          interface{}       `yaml:"extension,omitempty" json:"extension,omitempty"`
+	DiskPressure       bool              `yaml:"diskPressure,omitempty" toml:"diskPressure,omitempty" json:"diskPressure,omitempty"`
+	MemoryPressure     bool              `yaml:"memoryPressure,omitempty" toml:"memoryPressure,omitempty" json:"memoryPressure,omitempty"`
+	PIDPressure        bool              `yaml:"pidPressure,omitempty" toml:"pidPressure,omitempty" json:"pidPressure,omitempty"`
+	NetworkUnavailable bool              `yaml:"networkUnavailable,omitempty" toml:"networkUnavailable,omitempty" json:"NetworkUnavailable,omitempty"`
+	Ready              bool              `yaml:"ready,omitempty" toml:"ready,omitempty" json:"ready,omitempty"`
+	Usage              map[string]string `yaml:"usage,omitempty" toml:"usage,omitempty" json:"usage,omitempty"`
+	Capacity           map[string]string `yaml:"capacity,omitempty" toml:"capacity,omitempty" json:"capacity,omitempty"`
+	Percent            map[string]string `yaml:"percent,omitempty" toml:"percent,omitempty" json:"percent,omitempty"`
+	Extension          interface{}       `yaml:"extension,omitempty" toml:"extension,omitempty" json:"extension,omitempty"`
+	Time               *time.Time        `yaml:"time,omitempty" toml:"time,omitempty" json:"time,omitempty"`
+	Mounts             []MountUsage      `yaml:"mounts,omitempty" toml:"mounts,omitempty" json:"mounts,omitempty"`
+	GPUProcessStats    []GPUProcess      `yaml:"gpuProcesses,omitempty" toml:"gpuProcesses,omitempty" json:"gpuProcesses,omitempty"`
+	// Power the power draw of node in watts
+	Power float64 `yaml:"power,omitempty" toml:"power,omitzero" json:"power,omitempty"`
+	// Energy the cumulative energy consumed by node in joules
+	Energy float64 `yaml:"energy,omitempty" toml:"energy,omitzero" json:"energy,omitempty"`
+	// Allocatable the resources of node available for apps, which is capacity minus the
+	// reserved, the percent is computed against allocatable if reported
+	Allocatable map[string]string `yaml:"allocatable,omitempty" toml:"allocatable,omitempty" json:"allocatable,omitempty"`
+	// Networks the statistics of network interfaces keyed by interface name
+	Networks map[string]*NetworkStats `yaml:"networks,omitempty" toml:"networks,omitempty" json:"networks,omitempty"`
+	// Disks the statistics of disks keyed by device name
+	Disks map[string]*DiskStats `yaml:"disks,omitempty" toml:"disks,omitempty" json:"disks,omitempty"`
+}
+
+// GPUProcess the gpu usage of a process
+type GPUProcess struct {
+	PID        int    `yaml:"pid,omitempty" toml:"pid,omitzero" json:"pid,omitempty"`
+	Container  string `yaml:"container,omitempty" toml:"container,omitempty" json:"container,omitempty"`
+	UsedMemory int64  `yaml:"usedMemory,omitempty" toml:"usedMemory,omitzero" json:"usedMemory,omitempty"`
+}
+
+// MountUsage the usage of filesystem mount, usage and capacity are quantities in bytes
+type MountUsage struct {
+	Path     string `yaml:"path,omitempty" toml:"path,omitempty" json:"path,omitempty"`
+	Usage    string `yaml:"usage,omitempty" toml:"usage,omitempty" json:"usage,omitempty"`
+	Capacity string `yaml:"capacity,omitempty" toml:"capacity,omitempty" json:"capacity,omitempty"`
+}
+
+// NetworkStats the statistics of network interface, the bytes, packets and errors are
+// cumulative counters, and the bandwidth percents are computed by the view from the
+// current rates against the capacity of interface
+type NetworkStats struct {
+	Interface string `yaml:"interface,omitempty" toml:"interface,omitempty" json:"interface,omitempty"`
+	RxBytes   int64  `yaml:"rxBytes,omitempty" toml:"rxBytes,omitzero" json:"rxBytes,omitempty"`
+	TxBytes   int64  `yaml:"txBytes,omitempty" toml:"txBytes,omitzero" json:"txBytes,omitempty"`
+	RxPackets int64  `yaml:"rxPackets,omitempty" toml:"rxPackets,omitzero" json:"rxPackets,omitempty"`
+	TxPackets int64  `yaml:"txPackets,omitempty" toml:"txPackets,omitzero" json:"txPackets,omitempty"`
+	RxErrors  int64  `yaml:"rxErrors,omitempty" toml:"rxErrors,omitzero" json:"rxErrors,omitempty"`
+	TxErrors  int64  `yaml:"txErrors,omitempty" toml:"txErrors,omitzero" json:"txErrors,omitempty"`
+	// CapacityBps the capacity of interface in bits per second, zero if unknown
+	CapacityBps int64 `yaml:"capacityBps,omitempty" toml:"capacityBps,omitzero" json:"capacityBps,omitempty"`
+	// RxBps and TxBps the current receive and transmit rates in bits per second
+	RxBps int64 `yaml:"rxBps,omitempty" toml:"rxBps,omitzero" json:"rxBps,omitempty"`
+	TxBps int64 `yaml:"txBps,omitempty" toml:"txBps,omitzero" json:"txBps,omitempty"`
+	// RxBandwidthPercent and TxBandwidthPercent the fractions of capacity used by the current rates
+	RxBandwidthPercent float64 `yaml:"rxBandwidthPercent,omitempty" toml:"rxBandwidthPercent,omitzero" json:"rxBandwidthPercent,omitempty"`
+	TxBandwidthPercent float64 `yaml:"txBandwidthPercent,omitempty" toml:"txBandwidthPercent,omitzero" json:"txBandwidthPercent,omitempty"`
+}
+
+// DiskStats the statistics of disk, the bytes and operations of io are cumulative counters,
+// the total and available are the storage capacity in bytes
+type DiskStats struct {
+	Device     string `yaml:"device,omitempty" toml:"device,omitempty" json:"device,omitempty"`
+	ReadBytes  int64  `yaml:"readBytes,omitempty" toml:"readBytes,omitzero" json:"readBytes,omitempty"`
+	WriteBytes int64  `yaml:"writeBytes,omitempty" toml:"writeBytes,omitzero" json:"writeBytes,omitempty"`
+	ReadOps    int64  `yaml:"readOps,omitempty" toml:"readOps,omitzero" json:"readOps,omitempty"`
+	WriteOps   int64  `yaml:"writeOps,omitempty" toml:"writeOps,omitzero" json:"writeOps,omitempty"`
+	Total      int64  `yaml:"total,omitempty" toml:"total,omitzero" json:"total,omitempty"`
+	Available  int64  `yaml:"available,omitempty" toml:"available,omitzero" json:"available,omitempty"`
 }
 
+// DeviceStatus the connection status of device
+type DeviceStatus string
+
+const (
+	DeviceConnected    DeviceStatus = "connected"
+	DeviceDisconnected DeviceStatus = "disconnected"
+)
+
+// The communication protocols of device
+const (
+	DeviceProtocolMQTT   = "mqtt"
+	DeviceProtocolModbus = "modbus"
+	DeviceProtocolOPCUA  = "opcua"
+)
+
+// DeviceInfo the info of device. The connection state is held by Status rather than a
+// boolean field, a boolean "connected" reported by the agents is parsed into Status as
+// DeviceConnected or DeviceDisconnected, and the last seen time is held by LastSeen
 type DeviceInfo struct {
-	Name    string `yaml:"name,omitempty" json:"name,omitempty"`
-	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+	Name    string `yaml:"name,omitempty" toml:"name,omitempty" json:"name,omitempty"`
+	Version string `yaml:"version,omitempty" toml:"version,omitempty" json:"version,omitempty"`
+	// Status the connection status of device, empty if not reported by older agents
+	Status DeviceStatus `yaml:"status,omitempty" toml:"status,omitempty" json:"status,omitempty"`
+	// LastSeen the last time when the device is seen by the agent
+	LastSeen *time.Time `yaml:"lastSeen,omitempty" toml:"lastSeen,omitempty" json:"lastSeen,omitempty"`
+	// FirmwareVersion the version of firmware running on the device
+	FirmwareVersion string `yaml:"firmwareVersion,omitempty" toml:"firmwareVersion,omitempty" json:"firmwareVersion,omitempty"`
+	// Protocol the communication protocol of device, such as DeviceProtocolMQTT
+	Protocol string `yaml:"protocol,omitempty" toml:"protocol,omitempty" json:"protocol,omitempty"`
+	// Attributes the free-form attributes of device, such as the vendor and model
+	Attributes map[string]string `yaml:"attributes,omitempty" toml:"attributes,omitempty" json:"attributes,omitempty"`
 }
 
 // AppInfo app info
 type AppInfo struct {
-	Name    string `yaml:"name,omitempty" json:"name,omitempty"`
-	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+	Name    string `yaml:"name,omitempty" toml:"name,omitempty" json:"name,omitempty"`
+	Version string `yaml:"version,omitempty" toml:"version,omitempty" json:"version,omitempty"`
+	// Deleting marks the app to be drained and removed by the edge
+	Deleting bool `yaml:"deleting,omitempty" toml:"deleting,omitempty" json:"deleting,omitempty"`
+	// Refs the names of configs and secrets referenced by the app
+	Refs []string `yaml:"refs,omitempty" toml:"refs,omitempty" json:"refs,omitempty"`
+	// Replicas the desired number of instances of the app, zero means unspecified
+	Replicas int `yaml:"replicas,omitempty" toml:"replicas,omitzero" json:"replicas,omitempty"`
 }
 
 // AppStats app statistics
 type AppStats struct {
 	AppInfo       `yaml:",inline" json:",inline"`
-	DeployType    string                   `json:"deployType,omitempty" yaml:"deployType,omitempty"`
-	Status        Status                   `yaml:"status,omitempty" json:"status,omitempty"`
-	Cause         string                   `yaml:"cause,omitempty" json:"cause,omitempty"`
-	InstanceStats map[string]InstanceStats `yaml:"instances,omitempty" json:"instances,omitempty"`
+	DeployType    string                   `json:"deployType,omitempty" yaml:"deployType,omitempty" toml:"deployType,omitempty"`
+	Status        Status                   `yaml:"status,omitempty" toml:"status,omitempty" json:"status,omitempty"`
+	Cause         string                   `yaml:"cause,omitempty" toml:"cause,omitempty" json:"cause,omitempty"`
+	InstanceStats map[string]InstanceStats `yaml:"instances,omitempty" toml:"instances,omitempty" json:"instances,omitempty"`
+	// Annotations the metadata attached to app, such as the owner team and cost center
+	Annotations map[string]string `yaml:"annotations,omitempty" toml:"annotations,omitempty" json:"annotations,omitempty"`
+	// StatusSince the time since when the app is in the current status
+	StatusSince *time.Time `yaml:"statusSince,omitempty" toml:"statusSince,omitempty" json:"statusSince,omitempty"`
+	// Usage the summed usage of all instances of app, only set by ReportView.AggregateAppStats
+	Usage map[string]string `yaml:"usage,omitempty" toml:"usage,omitempty" json:"usage,omitempty"`
+}
+
+// InstancesByNode groups the instances of app by node name,
+// the instances of each node are sorted by instance name
+func (s *AppStats) InstancesByNode() map[string][]InstanceStats {
+	names := make([]string, 0, len(s.InstanceStats))
+	for name := range s.InstanceStats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := map[string][]InstanceStats{}
+	for _, name := range names {
+		ins := s.InstanceStats[name]
+		res[ins.NodeName] = append(res[ins.NodeName], ins)
+	}
+	return res
+}
+
+// TimeToReady returns the span from deployTime to the time when the last instance
+// of app became ready, ok is false if there is no instance, or any instance is not
+// running or has no ready time reported yet
+func (s *AppStats) TimeToReady(deployTime time.Time) (time.Duration, bool) {
+	if len(s.InstanceStats) == 0 {
+		return 0, false
+	}
+	var last time.Time
+	for _, ins := range s.InstanceStats {
+		if ins.Status != Running || ins.ReadyTime == nil {
+			return 0, false
+		}
+		if ins.ReadyTime.After(last) {
+			last = *ins.ReadyTime
+		}
+	}
+	return last.Sub(deployTime), true
+}
+
+// DerivedStatus returns the status of app derived from its instances, which is Failed
+// if the app or any instance failed, Running if all instances are running and the
+// desired replicas are satisfied, otherwise Pending. The reported status is returned
+// if there is no instance, and Unknown if no status is reported either
+func (s *AppStats) DerivedStatus() Status {
+	if s.Status == Failed {
+		return Failed
+	}
+	if len(s.InstanceStats) == 0 {
+		if s.Status == "" {
+			return Unknown
+		}
+		return s.Status
+	}
+	running := 0
+	for _, ins := range s.InstanceStats {
+		switch ins.Status {
+		case Failed:
+			return Failed
+		case Running:
+			running++
+		}
+	}
+	if running == len(s.InstanceStats) && running >= s.Replicas {
+		return Running
+	}
+	return Pending
+}
+
+// TotalLogBytes returns the sum of log sizes on disk of all containers of app
+func (s *AppStats) TotalLogBytes() int64 {
+	var total int64
+	for _, ins := range s.InstanceStats {
+		if ins.Container != nil {
+			total += ins.Container.LogBytes
+		}
+	}
+	return total
+}
+
+// MaxRestartCount returns the max restart count of the containers of all instances of app
+func (s *AppStats) MaxRestartCount() int32 {
+	var max int32
+	for _, ins := range s.InstanceStats {
+		if ins.Container != nil && ins.Container.RestartCount > max {
+			max = ins.Container.RestartCount
+		}
+	}
+	return max
 }
 
 type CoreInfo struct {
-	GoVersion   string `yaml:"goVersion,omitempty" json:"goVersion,omitempty"`
-	BinVersion  string `yaml:"binVersion,omitempty" json:"binVersion,omitempty"`
-	GitRevision string `yaml:"gitRevision,omitempty" json:"gitRevision,omitempty"`
+	GoVersion   string `yaml:"goVersion,omitempty" toml:"goVersion,omitempty" json:"goVersion,omitempty"`
+	BinVersion  string `yaml:"binVersion,omitempty" toml:"binVersion,omitempty" json:"binVersion,omitempty"`
+	GitRevision string `yaml:"gitRevision,omitempty" toml:"gitRevision,omitempty" json:"gitRevision,omitempty"`
 }
 
 // InstanceStats instance stats
 type InstanceStats struct {
-	Name        string            `yaml:"name,omitempty" json:"name,omitempty"`
-	ServiceName string            `yaml:"serviceName,omitempty" json:"serviceName"`
-	Usage       map[string]string `yaml:"usage,omitempty" json:"usage,omitempty"`
-	Status      Status            `yaml:"status,omitempty" json:"status,omitempty"`
-	Cause       string            `yaml:"cause,omitempty" json:"cause,omitempty"`
-	IP          string            `yaml:"ip,omitempty" json:"ip,omitempty"`
-	NodeName    string            `yaml:"nodeName,omitempty" json:"nodeName,omitempty"`
-	CreateTime  time.Time         `yaml:"createTime,omitempty" json:"createTime,omitempty"`
+	Name        string            `yaml:"name,omitempty" toml:"name,omitempty" json:"name,omitempty"`
+	ServiceName string            `yaml:"serviceName,omitempty" toml:"serviceName,omitempty" json:"serviceName"`
+	Usage       map[string]string `yaml:"usage,omitempty" toml:"usage,omitempty" json:"usage,omitempty"`
+	Limit       map[string]string `yaml:"limit,omitempty" toml:"limit,omitempty" json:"limit,omitempty"`
+	Status      Status            `yaml:"status,omitempty" toml:"status,omitempty" json:"status,omitempty"`
+	Cause       string            `yaml:"cause,omitempty" toml:"cause,omitempty" json:"cause,omitempty"`
+	IP          string            `yaml:"ip,omitempty" toml:"ip,omitempty" json:"ip,omitempty"`
+	NodeName    string            `yaml:"nodeName,omitempty" toml:"nodeName,omitempty" json:"nodeName,omitempty"`
+	CreateTime  time.Time         `yaml:"createTime,omitempty" toml:"createTime,omitempty" json:"createTime,omitempty"`
+	LogRef      *LogRef           `yaml:"logRef,omitempty" toml:"logRef,omitempty" json:"logRef,omitempty"`
+	Container   *ServiceInfo      `yaml:"container,omitempty" toml:"container,omitempty" json:"container,omitempty"`
+	Placement   *Placement        `yaml:"placement,omitempty" toml:"placement,omitempty" json:"placement,omitempty"`
+	QoSClass    QoSClass          `yaml:"qosClass,omitempty" toml:"qosClass,omitempty" json:"qosClass,omitempty"`
+	ReadyTime   *time.Time        `yaml:"readyTime,omitempty" toml:"readyTime,omitempty" json:"readyTime,omitempty"`
+	// ScheduledTime the time when the instance is desired to be scheduled
+	ScheduledTime *time.Time `yaml:"scheduledTime,omitempty" toml:"scheduledTime,omitempty" json:"scheduledTime,omitempty"`
+	// StartTime the time when the instance actually started
+	StartTime *time.Time `yaml:"startTime,omitempty" toml:"startTime,omitempty" json:"startTime,omitempty"`
+}
+
+// SchedulingLatency returns the span from the instance being scheduled to being started,
+// ok is false if any of the times is not reported or the start time is before the scheduled time
+func (s *InstanceStats) SchedulingLatency() (time.Duration, bool) {
+	if s.ScheduledTime == nil || s.StartTime == nil || s.StartTime.Before(*s.ScheduledTime) {
+		return 0, false
+	}
+	return s.StartTime.Sub(*s.ScheduledTime), true
+}
+
+// Placement the scheduling info of instance
+type Placement struct {
+	// the node selector matched by the node instance placed on
+	Selector string `yaml:"selector,omitempty" toml:"selector,omitempty" json:"selector,omitempty"`
+	// the reason why instance is placed on the node, PlacementFallback or
+	// prefixed with "Fallback:" if no node matches the selector
+	Reason string `yaml:"reason,omitempty" toml:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// IsFallback checks whether the instance is placed by fallback
+func (p *Placement) IsFallback() bool {
+	return p != nil && (p.Reason == PlacementFallback || strings.HasPrefix(p.Reason, PlacementFallback+":"))
+}
+
+// ServiceInfo the container info of instance
+type ServiceInfo struct {
+	Name     string    `yaml:"name,omitempty" toml:"name,omitempty" json:"name,omitempty"`
+	ID       string    `yaml:"id,omitempty" toml:"id,omitempty" json:"id,omitempty"`
+	ExitInfo *ExitInfo `yaml:"exit,omitempty" toml:"exit,omitempty" json:"exit,omitempty"`
+	// LogBytes the current size in bytes of the container logs on disk
+	LogBytes int64 `yaml:"logBytes,omitempty" toml:"logBytes,omitzero" json:"logBytes,omitempty"`
+	// CreateTime the time when the container is created
+	CreateTime *time.Time `yaml:"createTime,omitempty" toml:"createTime,omitempty" json:"createTime,omitempty"`
+	// RestartCount the number of times the container restarted since created
+	RestartCount int32 `yaml:"restartCount,omitempty" toml:"restartCount,omitzero" json:"restartCount,omitempty"`
+	// LastRestartTime the time when the container restarted last time
+	LastRestartTime *time.Time `yaml:"lastRestartTime,omitempty" toml:"lastRestartTime,omitempty" json:"lastRestartTime,omitempty"`
+	// LastExitCode the exit code of the container before the last restart
+	LastExitCode int32 `yaml:"lastExitCode,omitempty" toml:"lastExitCode,omitzero" json:"lastExitCode,omitempty"`
+}
+
+// ExitInfo the last exit info of container
+type ExitInfo struct {
+	ExitCode  int32  `yaml:"exitCode" toml:"exitCode" json:"exitCode"`
+	Signal    int32  `yaml:"signal,omitempty" toml:"signal,omitzero" json:"signal,omitempty"`
+	Reason    string `yaml:"reason,omitempty" toml:"reason,omitempty" json:"reason,omitempty"`
+	OOMKilled bool   `yaml:"oomKilled,omitempty" toml:"oomKilled,omitempty" json:"oomKilled,omitempty"`
+}
+
+// WasOOMKilled checks whether the container was killed for out of memory last time
+func (s *ServiceInfo) WasOOMKilled() bool {
+	return s != nil && s.ExitInfo != nil && s.ExitInfo.OOMKilled
+}
+
+// IsRestartLooping checks whether the container restarted threshold times at least within the window,
+// that is all restarts since the container created happened no longer than window, false is returned
+// if the create time or the last restart time is not reported
+func (s *ServiceInfo) IsRestartLooping(threshold int32, window time.Duration) bool {
+	if s == nil || s.CreateTime == nil || s.LastRestartTime == nil || s.RestartCount < threshold {
+		return false
+	}
+	return s.LastRestartTime.Sub(*s.CreateTime) <= window
+}
+
+// LogRef reference to the logs of instance
+type LogRef struct {
+	Backend string `yaml:"backend,omitempty" toml:"backend,omitempty" json:"backend,omitempty"`
+	Query   string `yaml:"query,omitempty" toml:"query,omitempty" json:"query,omitempty"`
+}
+
+// HasLogs checks whether the instance carries a reference to its logs
+func (s *InstanceStats) HasLogs() bool {
+	return s.LogRef != nil && s.LogRef.Backend != ""
+}
+
+// DeepCopy returns a deep copy of the node info
+func (s *NodeInfo) DeepCopy() *NodeInfo {
+	if s == nil {
+		return nil
+	}
+	res := *s
+	res.Labels = copyStringMap(s.Labels)
+	return &res
+}
+
+// DeepCopy returns a deep copy of the node stats, the extension is copied recursively
+func (s *NodeStats) DeepCopy() *NodeStats {
+	if s == nil {
+		return nil
+	}
+	res := *s
+	res.Usage = copyStringMap(s.Usage)
+	res.Capacity = copyStringMap(s.Capacity)
+	res.Allocatable = copyStringMap(s.Allocatable)
+	res.Percent = copyStringMap(s.Percent)
+	res.Extension = deepCopyValue(s.Extension)
+	res.Time = copyTime(s.Time)
+	if s.Mounts != nil {
+		res.Mounts = append([]MountUsage{}, s.Mounts...)
+	}
+	if s.GPUProcessStats != nil {
+		res.GPUProcessStats = append([]GPUProcess{}, s.GPUProcessStats...)
+	}
+	if s.Networks != nil {
+		res.Networks = make(map[string]*NetworkStats, len(s.Networks))
+		for k, v := range s.Networks {
+			if v != nil {
+				n := *v
+				v = &n
+			}
+			res.Networks[k] = v
+		}
+	}
+	if s.Disks != nil {
+		res.Disks = make(map[string]*DiskStats, len(s.Disks))
+		for k, v := range s.Disks {
+			if v != nil {
+				d := *v
+				v = &d
+			}
+			res.Disks[k] = v
+		}
+	}
+	return &res
+}
+
+// DeepCopy returns a deep copy of the device info
+func (s *DeviceInfo) DeepCopy() *DeviceInfo {
+	if s == nil {
+		return nil
+	}
+	res := *s
+	res.LastSeen = copyTime(s.LastSeen)
+	res.Attributes = copyStringMap(s.Attributes)
+	return &res
+}
+
+// DeepCopy returns a deep copy of the app info
+func (s *AppInfo) DeepCopy() *AppInfo {
+	if s == nil {
+		return nil
+	}
+	res := *s
+	if s.Refs != nil {
+		res.Refs = append([]string{}, s.Refs...)
+	}
+	return &res
+}
+
+// DeepCopy returns a deep copy of the app stats, including all instances
+func (s *AppStats) DeepCopy() *AppStats {
+	if s == nil {
+		return nil
+	}
+	res := *s
+	res.AppInfo = *s.AppInfo.DeepCopy()
+	if s.InstanceStats != nil {
+		res.InstanceStats = make(map[string]InstanceStats, len(s.InstanceStats))
+		for k, v := range s.InstanceStats {
+			res.InstanceStats[k] = *v.DeepCopy()
+		}
+	}
+	res.Annotations = copyStringMap(s.Annotations)
+	res.StatusSince = copyTime(s.StatusSince)
+	res.Usage = copyStringMap(s.Usage)
+	return &res
+}
+
+// DeepCopy returns a deep copy of the instance stats
+func (s *InstanceStats) DeepCopy() *InstanceStats {
+	if s == nil {
+		return nil
+	}
+	res := *s
+	res.Usage = copyStringMap(s.Usage)
+	res.Limit = copyStringMap(s.Limit)
+	if s.LogRef != nil {
+		ref := *s.LogRef
+		res.LogRef = &ref
+	}
+	if s.Container != nil {
+		container := *s.Container
+		if s.Container.ExitInfo != nil {
+			exit := *s.Container.ExitInfo
+			container.ExitInfo = &exit
+		}
+		container.CreateTime = copyTime(s.Container.CreateTime)
+		container.LastRestartTime = copyTime(s.Container.LastRestartTime)
+		res.Container = &container
+	}
+	if s.Placement != nil {
+		placement := *s.Placement
+		res.Placement = &placement
+	}
+	res.ReadyTime = copyTime(s.ReadyTime)
+	res.ScheduledTime = copyTime(s.ScheduledTime)
+	res.StartTime = copyTime(s.StartTime)
+	return &res
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	res := *t
+	return &res
 }